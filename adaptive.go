@@ -0,0 +1,133 @@
+package schroedinger
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// adaptivePool bounds the number of tests running at once by a limit which
+// follows how the tests fare, see Config.AdaptiveParallel. Every window of
+// finished tests, the limit is halved if the share of them which were flaky
+// or failed went over the target, and otherwise raised by one, unless the
+// average trial got markedly slower since the last raise, which is taken
+// for the machine being oversubscribed. A nil *adaptivePool never waits.
+type adaptivePool struct {
+	mu      sync.Mutex
+	limit   int
+	max     int
+	running int
+	target  float64
+	// closed and replaced whenever a slot may have come free
+	freed chan struct{}
+
+	// the tests finished since the limit last changed
+	settled, unsettled int
+	trials             int
+	trialsDuration     time.Duration
+	// the average trial before the limit was last raised
+	lastAvg time.Duration
+	// what changes of the limit are logged to
+	log *runLogger
+}
+
+// newAdaptivePool starts at half of max, which defaults to the number of
+// CPUs
+func newAdaptivePool(target float64, max int, l *runLogger) *adaptivePool {
+	if target <= 0 {
+		return nil
+	}
+	if max < 1 {
+		max = runtime.NumCPU()
+	}
+	limit := max / 2
+	if limit < 1 {
+		limit = 1
+	}
+	return &adaptivePool{limit: limit, max: max, target: target, freed: make(chan struct{}), log: l}
+}
+
+// acquire blocks until a test may start, or ctx is done
+func (p *adaptivePool) acquire(ctx context.Context) error {
+	for {
+		p.mu.Lock()
+		if p.running < p.limit {
+			p.running++
+			p.mu.Unlock()
+			return nil
+		}
+		freed := p.freed
+		p.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *adaptivePool) release() {
+	p.mu.Lock()
+	p.running--
+	p.wake()
+	p.mu.Unlock()
+}
+
+// wake lets waiting tests look again for a slot; p.mu must be held
+func (p *adaptivePool) wake() {
+	close(p.freed)
+	p.freed = make(chan struct{})
+}
+
+// observe counts the outcome of a finished test, adjusting the limit at
+// the end of a window
+func (p *adaptivePool) observe(r *TestResult) {
+	if p == nil || r.Quarantined {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch r.Outcome {
+	case OutcomePass:
+		p.settled++
+	case OutcomeFlaky, OutcomeFail:
+		p.unsettled++
+	default:
+		return
+	}
+	p.trials += r.Trials
+	p.trialsDuration += r.Duration
+	// enough tests to tell, at the current limit
+	window := p.limit
+	if window < 4 {
+		window = 4
+	}
+	if p.settled+p.unsettled < window {
+		return
+	}
+	rate := float64(p.unsettled) / float64(p.settled+p.unsettled)
+	var avg time.Duration
+	if p.trials > 0 {
+		avg = p.trialsDuration / time.Duration(p.trials)
+	}
+	old := p.limit
+	switch {
+	case rate > p.target:
+		p.limit /= 2
+		if p.limit < 1 {
+			p.limit = 1
+		}
+	case p.lastAvg > 0 && avg > p.lastAvg*3/2:
+		// slower for the last raise; hold
+	case p.limit < p.max:
+		p.lastAvg = avg
+		p.limit++
+		p.wake()
+	}
+	if p.limit != old {
+		p.log.Printf("* adaptive parallel: %d -> %d (%.0f%% of the last %d tests flaky or failed, target %.0f%%; %v a trial)",
+			old, p.limit, 100*rate, p.settled+p.unsettled, 100*p.target, avg.Round(time.Millisecond))
+	}
+	p.settled, p.unsettled, p.trials, p.trialsDuration = 0, 0, 0, 0
+}
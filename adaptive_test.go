@@ -0,0 +1,60 @@
+package schroedinger
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptivePool(t *testing.T) {
+	if p := newAdaptivePool(0, 8, nil); p != nil {
+		t.Fatal("adaptive pool without a target")
+	}
+	p := newAdaptivePool(0.25, 8, nil)
+	if p.limit != 4 {
+		t.Fatalf("limit: got: %d, want: 4", p.limit)
+	}
+	finish := func(outcomes ...Outcome) {
+		for _, o := range outcomes {
+			p.observe(&TestResult{Outcome: o, Trials: 1, Duration: time.Second})
+		}
+	}
+	pass, flaky := OutcomePass, OutcomeFlaky
+
+	finish(pass, pass, pass, flaky)
+	if p.limit != 5 {
+		t.Errorf("under target: got: %d, want: 5", p.limit)
+	}
+	// skips and quarantined tests don't count
+	finish(OutcomeSkip, OutcomeSkip)
+	p.observe(&TestResult{Outcome: OutcomeFail, Quarantined: true})
+	finish(pass, flaky, flaky, pass, flaky)
+	if p.limit != 2 {
+		t.Errorf("over target: got: %d, want: 2", p.limit)
+	}
+	// trials twice as slow as before the last raise hold the limit
+	for i := 0; i < 4; i++ {
+		p.observe(&TestResult{Outcome: pass, Trials: 1, Duration: 2 * time.Second})
+	}
+	if p.limit != 2 {
+		t.Errorf("slower: got: %d, want: 2", p.limit)
+	}
+
+	// the limit bounds the tests running at once
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		if err := p.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.acquire(ctx); err == nil {
+		t.Fatal("acquired over the limit")
+	}
+	acquired := make(chan error)
+	go func() { acquired <- p.acquire(context.Background()) }()
+	p.release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,55 @@
+package schroedinger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// artifactPath returns where the output of trial n of t goes under dir:
+// <dir>/<pkg>/<test>/trial-<n>.log, eg. artifacts/eth/TestSync/trial-2.log,
+// with subtests in directories of their own and the runs of a whole
+// package under _package
+func artifactPath(dir string, t *test, n int) string {
+	pkg := strings.TrimPrefix(filepath.ToSlash(t.pkg), "./")
+	pkg = strings.Replace(pkg, "...", "all", -1)
+	parts := []string{dir}
+	for _, p := range strings.Split(pkg, "/") {
+		if p != "" && p != "." && p != ".." {
+			parts = append(parts, unsafeFileChars.ReplaceAllString(p, "_"))
+		}
+	}
+	if t.name == "" {
+		parts = append(parts, "_package")
+	}
+	for _, p := range strings.Split(t.name, "/") {
+		if p != "" {
+			parts = append(parts, unsafeFileChars.ReplaceAllString(p, "_"))
+		}
+	}
+	return filepath.Join(append(parts, fmt.Sprintf("trial-%d.log", n))...)
+}
+
+// writeArtifact writes the output o of the trial of t just run, which took
+// d and ended with err, into t.artifacts, after a header with the command
+// line it ran, its directory and t's env= options
+func writeArtifact(t *test, start time.Time, d time.Duration, o []byte, err error) error {
+	path := artifactPath(t.artifacts, t, t.trials)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	result := "ok"
+	if err != nil {
+		result = "failed: " + err.Error()
+	}
+	header := fmt.Sprintf("# command: %s\n# dir: %s\n", t.lastCmd, t.lastDir)
+	if len(t.vars) > 0 {
+		header += fmt.Sprintf("# env: %s\n", strings.Join(t.vars, " "))
+	}
+	header += fmt.Sprintf("# started: %s, took %v\n# result: %s\n\n",
+		start.Format(time.RFC3339), d.Round(time.Millisecond), result)
+	return ioutil.WriteFile(path, append([]byte(header), o...), 0644)
+}
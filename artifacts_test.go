@@ -0,0 +1,58 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestArtifactPath(t *testing.T) {
+	cases := []struct {
+		pkg, name, want string
+	}{
+		{"./eth", "TestSync", "a/eth/TestSync/trial-2.log"},
+		{"./eth", "TestSync/fast mode", "a/eth/TestSync/fast_mode/trial-2.log"},
+		{"./p2p/...", "", "a/p2p/all/_package/trial-2.log"},
+		{"github.com/x/les", "TestServe", "a/github.com/x/les/TestServe/trial-2.log"},
+		{"../other", "TestA", "a/other/TestA/trial-2.log"},
+	}
+	for _, c := range cases {
+		if got := filepath.ToSlash(artifactPath("a", &test{pkg: c.pkg, name: c.name}, 2)); got != c.want {
+			t.Errorf("%s %s: got: %s, want: %s", c.pkg, c.name, got, c.want)
+		}
+	}
+}
+
+func TestArtifacts(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	once := filepath.Join(dir, "once")
+	f := filepath.Join(dir, "tests.txt")
+	tests := "flaky cmd=\"test -e " + once + " || { touch " + once + "; echo first; false; }\"\n"
+	if err := ioutil.WriteFile(f, []byte(tests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	artifacts := filepath.Join(dir, "artifacts")
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 2, ArtifactsDir: artifacts}
+	if _, err := run(c); err != nil {
+		t.Fatal(err)
+	}
+	first, err := ioutil.ReadFile(filepath.Join(artifacts, "flaky", "_package", "trial-1.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(first); !strings.HasPrefix(s, "# command: test -e ") || !strings.Contains(s, "# result: failed: exit status 1\n\nfirst\n") {
+		t.Errorf("got:\n%s", first)
+	}
+	second, err := ioutil.ReadFile(filepath.Join(artifacts, "flaky", "_package", "trial-2.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(second), "# result: ok\n") {
+		t.Errorf("got:\n%s", second)
+	}
+}
@@ -0,0 +1,76 @@
+package schroedinger
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// RetryBackoff is how the wait before retrying a failed test grows with
+// each retry.
+type RetryBackoff string
+
+const (
+	// wait Config.RetryDelay before every retry
+	BackoffFixed RetryBackoff = "fixed"
+	// double the wait with each retry: RetryDelay, twice that, and so on
+	BackoffExponential RetryBackoff = "exponential"
+)
+
+// the most times an exponential backoff doubles the delay
+const maxBackoffDoublings = 10
+
+// backoffRand returns a random number in [0, 1) for jitter; tests replace it
+var backoffRand = rand.Float64
+
+// backoff is the wait before each retry of a test
+type backoff struct {
+	delay       time.Duration
+	exponential bool
+	// the share of the delay added or taken at random
+	jitter float64
+}
+
+func (c *Config) backoff() backoff {
+	return backoff{delay: c.RetryDelay, exponential: c.RetryBackoff == BackoffExponential, jitter: c.RetryJitter}
+}
+
+// base returns the wait before retry n, the first being 1, without jitter
+func (b backoff) base(n int) time.Duration {
+	if b.delay <= 0 || n < 1 {
+		return 0
+	}
+	d := b.delay
+	if b.exponential {
+		k := n - 1
+		if k > maxBackoffDoublings {
+			k = maxBackoffDoublings
+		}
+		d <<= uint(k)
+	}
+	return d
+}
+
+// wait returns the wait before retry n, with jitter
+func (b backoff) wait(n int) time.Duration {
+	d := b.base(n)
+	if d == 0 || b.jitter <= 0 {
+		return d
+	}
+	return d + time.Duration((2*backoffRand()-1)*b.jitter*float64(d))
+}
+
+// sleep waits d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package schroedinger
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestBackoffWait(t *testing.T) {
+	defer func(f func() float64) { backoffRand = f }(backoffRand)
+	r := 0.5
+	backoffRand = func() float64 { return r }
+
+	fixed := backoff{delay: time.Second}
+	exp := backoff{delay: time.Second, exponential: true, jitter: 0.2}
+	cases := []struct {
+		b    backoff
+		n    int
+		r    float64
+		want time.Duration
+	}{
+		{backoff{}, 1, 0.5, 0},
+		{fixed, 0, 0.5, 0},
+		{fixed, 1, 0.5, time.Second},
+		{fixed, 3, 0.5, time.Second},
+		{exp, 1, 0.5, time.Second},
+		{exp, 3, 0.5, 4 * time.Second},
+		{exp, 3, 0, 3200 * time.Millisecond},
+		{exp, 3, 1, 4800 * time.Millisecond},
+		{exp, 50, 0.5, 1024 * time.Second},
+	}
+	for _, c := range cases {
+		r = c.r
+		if got := c.b.wait(c.n); got != c.want {
+			t.Errorf("%+v retry %d, rand %v: got: %v, want: %v", c.b, c.n, c.r, got, c.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	tt := &test{pkg: "a", command: "false", trialsAllowed: 3, backoff: backoff{delay: 50 * time.Millisecond, exponential: true}}
+	start := time.Now()
+	tryIndividualTest(tt, make(chan *TestResult, 1))
+	// waits 50ms, then 100ms
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("took %v, want at least 150ms", d)
+	}
+
+	// the wait ends with the run
+	ctx, cancel := context.WithCancel(context.Background())
+	tt = &test{pkg: "a", command: "false", trialsAllowed: 2, backoff: backoff{delay: time.Minute}, ctx: ctx}
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	c := make(chan *TestResult, 1)
+	tryIndividualTest(tt, c)
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("took %v, want the wait cut short", d)
+	}
+	if r := <-c; r.Trials != 2 || r.Outcome != OutcomeFail {
+		t.Errorf("got: %+v", r)
+	}
+}
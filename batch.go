@@ -0,0 +1,136 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// eg. '--- PASS: TestSync (0.01s)' and '--- SKIP: TestSync (0.00s)', not
+// indented, as those of subtests are
+var (
+	topPassLine = regexp.MustCompile(`^--- PASS: (\S+)`)
+	topSkipLine = regexp.MustCompile(`^--- SKIP: (\S+)`)
+)
+
+// batchKey groups the reruns which can share a go test run: top level tests
+// of the same package with a trial left, or "" for those which can't
+func batchKey(t *test) string {
+	if t.name == "" || strings.Contains(t.name, "/") || t.trials >= t.trialsAllowed {
+		return ""
+	}
+	return t.goDir + "\x00" + t.goPkg + "\x00" + t.pkg
+}
+
+// batches splits the failing tests of a package into batches of up to n
+// tests sharing a package, in order, along with those which can't be batched
+func batches(failing []*test, n int) (batched [][]*test, single []*test) {
+	byKey := make(map[string][]*test)
+	var keys []string
+	for _, f := range failing {
+		k := batchKey(f)
+		if k == "" {
+			single = append(single, f)
+			continue
+		}
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], f)
+	}
+	for _, k := range keys {
+		ts := byKey[k]
+		for len(ts) > 0 {
+			m := n
+			if m > len(ts) {
+				m = len(ts)
+			}
+			if m == 1 {
+				single = append(single, ts[0])
+			} else {
+				batched = append(batched, ts[:m])
+			}
+			ts = ts[m:]
+		}
+	}
+	return batched, single
+}
+
+// batchPattern is the go test -run pattern matching exactly the given top
+// level tests, as a single argument; it's quoted only where shown as a
+// command line
+func batchPattern(names []string) string {
+	return "^(" + strings.Join(names, "|") + ")$"
+}
+
+// rerunBatched reruns the failing tests of t's package in batches of up to
+// t.rerunBatch tests, one go test run each. The results of the tests which
+// passed or skipped there are sent to c; the tests left, which failed again
+// or didn't get to run, are returned to be rerun one by one.
+func rerunBatched(t *test, failing []*test, c chan *TestResult) []*test {
+	batched, left := batches(failing, t.rerunBatch)
+	for _, batch := range batched {
+		var names []string
+		for _, f := range batch {
+			names = append(names, f.name)
+		}
+		b := *batch[0]
+		b.name, b.batch, b.trials = "", names, 0
+		t.logf("%s: rerunning %d failing tests together: %v", t.pkg, len(batch), names)
+
+		start := time.Now()
+		o, e := runTest(&b)
+		d := time.Since(start)
+		passed, skipped := grepTopLevel(o)
+		for _, f := range batch {
+			f.trials++
+			// the run is shared out, so the trials add up to the time spent
+			r := newTestResult(f)
+			outcome := OutcomeFail
+			if passed[f.name] {
+				outcome = OutcomePass
+			} else if skipped[f.name] && e == nil {
+				outcome = OutcomeSkip
+			}
+			r.addTrial(d/time.Duration(len(batch)), o, outcome)
+			switch {
+			case passed[f.name]:
+				logTest(f)
+				logTrialf(f, "- PASS (%v, with %d others) %d/%d", d, len(batch)-1, f.trials, f.trialsAllowed)
+				r.pass(f)
+				c <- r
+			case skipped[f.name] && e == nil:
+				logTest(f)
+				logTrialf(f, "- SKIP (%v, with %d others)", d, len(batch)-1)
+				r.skip(f)
+				c <- r
+			default:
+				logTest(f)
+				logTrialf(f, "- FAIL (%v, with %d others) %d/%d", d, len(batch)-1, f.trials, f.trialsAllowed)
+				left = append(left, f)
+			}
+		}
+		if e != nil {
+			logOutput(t, o)
+		}
+	}
+	return left
+}
+
+// grepTopLevel returns the top level tests which passed and were skipped
+// in go test -v output
+func grepTopLevel(gotestout []byte) (passed, skipped map[string]bool) {
+	passed, skipped = make(map[string]bool), make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	for scanner.Scan() {
+		text := scanner.Text()
+		if m := topPassLine.FindStringSubmatch(text); m != nil {
+			passed[m[1]] = true
+		} else if m := topSkipLine.FindStringSubmatch(text); m != nil {
+			skipped[m[1]] = true
+		}
+	}
+	return passed, skipped
+}
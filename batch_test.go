@@ -0,0 +1,91 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestBatches(t *testing.T) {
+	mk := func(pkg, name string, trials int) *test {
+		return &test{pkg: pkg, name: name, trials: trials, trialsAllowed: 3}
+	}
+	a, b, c := mk("./eth", "TestA", 1), mk("./eth", "TestB", 1), mk("./eth", "TestC", 1)
+	sub := mk("./eth", "TestD/sub", 1)
+	done := mk("./eth", "TestE", 3)
+	other := mk("./p2p", "TestF", 1)
+	batched, single := batches([]*test{a, sub, b, other, c, done}, 2)
+	if want := [][]*test{{a, b}}; !reflect.DeepEqual(batched, want) {
+		t.Errorf("batched: got: %v, want: %v", batched, want)
+	}
+	// c is left alone by the batch size, other by its package
+	if want := []*test{sub, done, c, other}; !reflect.DeepEqual(single, want) {
+		t.Errorf("single: got: %v, want: %v", single, want)
+	}
+	if got := batchPattern([]string{"TestA", "TestB"}); got != "^(TestA|TestB)$" {
+		t.Errorf("got: %s", got)
+	}
+}
+
+func TestRerunBatched(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go which logs its arguments, and fails TestB once
+	fake := filepath.Join(dir, "go")
+	script := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(dir, "args") + `
+case "$*" in
+*'^(TestA|TestB|TestC)$'*)
+	echo '--- PASS: TestA (0.00s)'
+	echo '--- FAIL: TestB (0.00s)'
+	echo '--- SKIP: TestC (0.00s)'
+	echo 'FAIL'
+	exit 1;;
+*TestB*)
+	echo '--- PASS: TestB (0.00s)'
+	echo 'PASS';;
+esac
+`
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+
+	pkg := &test{pkg: "./eth", dir: dir, trialsAllowed: 3, rerunBatch: 5}
+	var failing []*test
+	for _, name := range []string{"TestA", "TestB", "TestC"} {
+		failing = append(failing, pkg.rerun(failure{name: name}))
+	}
+	c := make(chan *TestResult, 3)
+	left := rerunBatched(pkg, failing, c)
+	close(c)
+	var got []string
+	for r := range c {
+		got = append(got, r.Name+" "+string(r.Outcome))
+	}
+	sort.Strings(got)
+	// a skip only counts in a passing run
+	if want := []string{"TestA flaky"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if len(left) != 2 || left[0].name != "TestB" || left[0].trials != 2 || left[1].name != "TestC" {
+		t.Fatalf("left: %v", left)
+	}
+	tryIndividualTest(left[0], make(chan *TestResult, 1))
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "-run TestB") {
+		t.Errorf("got runs: %q", lines)
+	}
+}
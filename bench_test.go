@@ -0,0 +1,55 @@
+package schroedinger
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestGrepNsPerOp(t *testing.T) {
+	out := `goos: linux
+goarch: amd64
+pkg: github.com/ethereumproject/go-ethereum/core
+BenchmarkInsertChain_empty-8   	    2000	    612345 ns/op	  20480 B/op	     100 allocs/op
+BenchmarkInsertChain_full-8    	     100	  12345678 ns/op
+PASS
+ok  	github.com/ethereumproject/go-ethereum/core	3.210s
+`
+	ns, ok := grepNsPerOp([]byte(out))
+	if !ok || ns != 12345678 {
+		t.Errorf("got: %v %v, want: %v true", ns, ok, 12345678)
+	}
+	if _, ok := grepNsPerOp([]byte("PASS\nok  \tpkg\t0.01s\n")); ok {
+		t.Error("want no results without benchmark lines")
+	}
+}
+
+func TestBenchTrialOutcomes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := "goos: linux\nBenchmarkInsertChain-8   \t    1000\t   5000 ns/op\nPASS\nok  \t./core\t1.0s\n"
+	cases := []struct {
+		name       string
+		maxNsPerOp float64
+		want       Outcome
+		trials     []Outcome
+	}{
+		{"fast enough", 10000, OutcomePass, []Outcome{OutcomePass}},
+		{"no threshold", 0, OutcomePass, []Outcome{OutcomePass}},
+		{"too slow", 1000, OutcomeFail, []Outcome{OutcomeFail, OutcomeFail}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fakeGo(t, dir, out, 0)
+			ch := make(chan *TestResult, 1)
+			tryBenchTest(&test{pkg: filepath.FromSlash("./core"), name: "BenchmarkInsertChain", dir: dir, trialsAllowed: 2, bench: true, maxNsPerOp: c.maxNsPerOp}, ch)
+			r := <-ch
+			if r.Outcome != c.want || !reflect.DeepEqual(r.TrialOutcomes, c.trials) {
+				t.Errorf("got: %s, trials: %v, want: %s, trials: %v", r.Outcome, r.TrialOutcomes, c.want, c.trials)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package schroedinger
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// clock tells the time budgets are measured by; tests replace it
+var clock = time.Now
+
+// remainingBudget returns the time left before ctx's deadline, and false
+// if it has none
+func remainingBudget(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(clock()), true
+}
+
+// trialTimeout returns the timeout of a trial of t, passed as go test
+// -timeout: the smaller of its own, if any, and the budget left for the
+// run, if limited; 0 for none
+func trialTimeout(t *test) time.Duration {
+	timeout := t.goTestTimeout
+	left, ok := remainingBudget(t.context())
+	if !ok {
+		return timeout
+	}
+	left = left.Truncate(time.Millisecond)
+	if left < time.Millisecond {
+		left = time.Millisecond
+	}
+	if timeout == 0 || left < timeout {
+		return left
+	}
+	return timeout
+}
+
+// roomForTrial reports whether the budget left for the run, if limited,
+// leaves room for another trial taking as long as last did
+func roomForTrial(ctx context.Context, last time.Duration) bool {
+	left, ok := remainingBudget(ctx)
+	return !ok || left > last
+}
+
+// how long past its go test -timeout a trial is killed, for go test to
+// build the package and dump the stacks of a hanging test first
+var timeoutGrace = time.Minute
+
+// errTrialTimeout is the error of a trial killed for running past the
+// timeout of its test
+type errTrialTimeout struct {
+	timeout time.Duration
+}
+
+func (e *errTrialTimeout) Error() string {
+	return fmt.Sprintf("ran past its timeout of %v", e.timeout)
+}
+
+// enforceTimeout makes the trial t is about to run killed if it runs past
+// the test's timeout, if any: cmd= tests right at it, and go test, which
+// is given it as -timeout, timeoutGrace after. It returns how to undo that
+// once the trial is over.
+func enforceTimeout(t *test) (done func()) {
+	if t.goTestTimeout <= 0 {
+		return func() {}
+	}
+	kill := t.goTestTimeout
+	if t.command == "" {
+		kill += timeoutGrace
+	}
+	parent := t.ctx
+	ctx, cancel := context.WithTimeoutCause(t.context(), kill, &errTrialTimeout{t.goTestTimeout})
+	t.ctx = ctx
+	return func() {
+		cancel()
+		t.ctx = parent
+	}
+}
@@ -0,0 +1,122 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// setClock makes the budgets run by a fake clock set to now
+func setClock(t *testing.T, now time.Time) *time.Time {
+	orig := clock
+	t.Cleanup(func() { clock = orig })
+	clock = func() time.Time { return now }
+	return &now
+}
+
+func TestTrialTimeout(t *testing.T) {
+	start := time.Now()
+	now := setClock(t, start)
+	// far enough off for the context not to expire while testing
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(90*time.Second))
+	defer cancel()
+
+	cases := []struct {
+		ctx     context.Context
+		perTest time.Duration
+		elapsed time.Duration
+		want    time.Duration
+	}{
+		{context.Background(), 0, 0, 0},
+		{context.Background(), 10 * time.Minute, 0, 10 * time.Minute},
+		{ctx, 10 * time.Minute, 0, 90 * time.Second},
+		{ctx, 30 * time.Second, 0, 30 * time.Second},
+		{ctx, 0, 0, 90 * time.Second},
+		{ctx, 0, 80*time.Second + 1500*time.Microsecond, 9998 * time.Millisecond},
+		{ctx, 30 * time.Second, 80 * time.Second, 10 * time.Second},
+		// out of budget, but go test needs a timeout
+		{ctx, 30 * time.Second, 2 * time.Minute, time.Millisecond},
+	}
+	for i, c := range cases {
+		*now = start.Add(c.elapsed)
+		tt := &test{ctx: c.ctx, goTestTimeout: c.perTest}
+		if got := trialTimeout(tt); got != c.want {
+			t.Errorf("%d: got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestRoomForTrial(t *testing.T) {
+	start := time.Now()
+	now := setClock(t, start)
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(90*time.Second))
+	defer cancel()
+
+	if !roomForTrial(context.Background(), time.Hour) {
+		t.Error("no room without a deadline")
+	}
+	if !roomForTrial(ctx, time.Minute) {
+		t.Error("no room for a minute with 90s left")
+	}
+	*now = start.Add(45 * time.Second)
+	if roomForTrial(ctx, time.Minute) {
+		t.Error("room for a minute with 45s left")
+	}
+	if left, ok := remainingBudget(ctx); !ok || left != 45*time.Second {
+		t.Errorf("remaining: got: %v %v", left, ok)
+	}
+}
+
+func TestNoRetryPastBudget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	start := time.Now()
+	now := setClock(t, start)
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(time.Hour))
+	defer cancel()
+	// each trial seems to take longer than what's left after it
+	*now = start.Add(time.Hour)
+
+	tt := &test{pkg: "./eth", name: "TestSync", command: "exit 1", trialsAllowed: 3, ctx: ctx}
+	c := make(chan *TestResult, 1)
+	tryIndividualTest(tt, c)
+	r := <-c
+	if r.Outcome != OutcomeFail || r.Trials != 1 {
+		t.Errorf("got: %s after %d trials", r.Outcome, r.Trials)
+	}
+	if !errors.Is(r.err, ErrDeadlineExceeded) {
+		t.Errorf("got: %v, want: %v", r.err, ErrDeadlineExceeded)
+	}
+}
+
+func TestEnforceTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	var tt test
+	if err := tt.setOption("timeout=100ms"); err != nil || tt.goTestTimeout != 100*time.Millisecond {
+		t.Fatalf("got: %v, %v", tt.goTestTimeout, err)
+	}
+	if err := tt.setOption("timeout=-1s"); err == nil {
+		t.Error("no error for a negative timeout")
+	}
+
+	tt = test{pkg: "a", command: "sleep 10", trialsAllowed: 2, goTestTimeout: 100 * time.Millisecond}
+	c := make(chan *TestResult, 1)
+	start := time.Now()
+	tryIndividualTest(&tt, c)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v, want killed", d)
+	}
+	r := <-c
+	// killed, retried and killed again
+	if r.Outcome != OutcomeFail || r.Trials != 2 || !r.TimedOut || len(r.Failures) != 2 || r.Failures[0].Signature != "ran past its timeout of Nms" {
+		t.Errorf("got: %s after %d trials, timed out: %v, failures: %v", r.Outcome, r.Trials, r.TimedOut, r.Failures)
+	}
+	if tt.ctx != nil {
+		t.Error("the trial's context was left on the test")
+	}
+}
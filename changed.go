@@ -0,0 +1,79 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changes are the directories holding .go files changed in a git checkout
+type changes struct {
+	dirs map[string]bool
+	// a go.mod or go.sum changed, which may affect every package
+	all bool
+}
+
+// changedSince asks git which files in the checkout holding dir changed
+// since ref, including uncommitted changes
+func changedSince(dir, ref string) (*changes, error) {
+	top, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := gitOutput(dir, "diff", "--name-only", ref)
+	if err != nil {
+		return nil, err
+	}
+	return parseChanges(strings.TrimSpace(string(top)), diff), nil
+}
+
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v", strings.Join(args, " "), err)
+	}
+	return out, nil
+}
+
+// parseChanges reads git diff --name-only output, of paths relative to top
+func parseChanges(top string, diff []byte) *changes {
+	ch := &changes{dirs: make(map[string]bool)}
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		switch base := filepath.Base(name); {
+		case base == "go.mod" || base == "go.sum":
+			ch.all = true
+		case strings.HasSuffix(base, ".go"):
+			ch.dirs[filepath.Join(top, filepath.Dir(filepath.FromSlash(name)))] = true
+		}
+	}
+	return ch
+}
+
+// touched reports whether any package of t changed. Tests whose packages
+// can't be listed, and command tests, count as touched.
+func (ch *changes) touched(t *test) bool {
+	if ch.all || t.command != "" {
+		return true
+	}
+	dir, pkg := t.goArgs()
+	cmd := exec.Command(goExecutablePath, "list", "-f", "{{.Dir}}", pkg)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return true
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if ch.dirs[strings.TrimSpace(scanner.Text())] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseChanges(t *testing.T) {
+	top := filepath.FromSlash("/src/repo")
+	ch := parseChanges(top, []byte("eth/sync.go\neth/sync_test.go\nREADME.md\np2p/testdata/x.json\nmain.go\n"))
+	want := map[string]bool{
+		filepath.Join(top, "eth"): true,
+		top:                       true,
+	}
+	if len(ch.dirs) != len(want) || ch.all {
+		t.Fatalf("got: %v %v, want: %v", ch.dirs, ch.all, want)
+	}
+	for d := range want {
+		if !ch.dirs[d] {
+			t.Errorf("missing %s in %v", d, ch.dirs)
+		}
+	}
+	if ch := parseChanges(top, []byte("tools/go.sum\n")); !ch.all {
+		t.Error("want all changed for go.sum")
+	}
+}
+
+func TestChangesTouched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"go.mod":   "module example.com/a\n",
+		"x/x.go":   "package x\n",
+		"y/y.go":   "package y\n",
+		"y/z/z.go": "package z\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if root, _ := moduleRoot(dir); root == "" {
+		t.Skip("go runs in GOPATH mode")
+	}
+
+	ch := parseChanges(dir, []byte("y/z/z.go\n"))
+	cases := []struct {
+		pkg  string
+		want bool
+	}{
+		{"./x", false},
+		{"./y", false},
+		{"./y/...", true},
+		{"./...", true},
+		{"example.com/a/y/z", true},
+	}
+	for _, c := range cases {
+		tt := &test{pkg: c.pkg, dir: dir}
+		if got := ch.touched(tt); got != c.want {
+			t.Errorf("%s: got: %v, want: %v", c.pkg, got, c.want)
+		}
+	}
+	if !ch.touched(&test{pkg: "integration", command: "true", dir: dir}) {
+		t.Error("want command tests always touched")
+	}
+}
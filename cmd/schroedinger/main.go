@@ -2,7 +2,14 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/ETCDEVTeam/go-schroedinger"
 )
 
@@ -11,32 +18,587 @@ import (
 // or
 // github.com/ethereumproject/go-ethereum/eth/downloader TestFastCriticalRestarts
 // comments are allowed with the '#' character and usual usage
-var testsFile string
+var testsFiles listFlag
+
+// test files to run the tests of, as path[:line]
+var files stringsFlag
+
+// package pattern to discover tests in
+var discover string
+
+// discover the packages of every module under -dir
+var discoverModules bool
 
 // allowed times to try to get a nondeterministic test to pass
 var trialsAllowed int
 
+// trials of tests matching patterns, as pattern=N
+var trialsFor stringsFlag
+
+// on CI, with its own trials
+var ci bool
+var ciTrialsAllowed int
+
 // string to match to *list tests
 var whitelistMatch string
 var blacklistMatch string
+var matchMode string
+
+// log each test in one block
+var orderedOutput bool
+
+// go binary to test with
+var goBinary string
+
+// tags to select tests by
+var tagsInclude listFlag
+var tagsExclude listFlag
+
+// directory to run tests from
+var workDir string
+
+// commands run around the tests
+var setup stringsFlag
+var teardown stringsFlag
+
+// path to write JSON report to
+var reportFile string
+var junitFile string
+var htmlFile string
+
+// JSON lines of events
+var eventsFile string
+
+// directory for repro files
+var outputDir string
+
+// directory for the output of every trial
+var artifactsDir string
+
+// repro file to replay
+var replay string
+
+// flakiness over many runs
+var historyFile string
+var historyRuns int
+var historyMaxAge time.Duration
+
+// state file to skip recently passed tests with
+var stateFile string
+var stateTTL time.Duration
+
+// concurrency limits
+var maxParallel int
+
+// adapt the number of tests running at once to this flake rate
+var adaptiveParallel float64
+
+// start tests at most this often
+var maxStartsPerSecond float64
+
+var goTestP int
+var goTestParallel int
+var goTestTimeout time.Duration
+var goTestArgs string
+
+// finds the failing tests of a package
+var parser string
+
+// stop after this many failed tests
+var maxFailures int
+var keepGoing bool
+
+// cut the run short after this long
+var timeout time.Duration
+var retryDelay time.Duration
+var retryBackoff string
+var retryJitter float64
+
+// skip tests which passed first try, until their packages change
+var skipStable string
+
+// snapshot of the run, rewritten every few seconds
+var statusFile string
+
+// print a one line JSON summary to stdout, and all else to stderr
+var jsonSummary bool
+
+// tests whose outcomes don't count
+var quarantineFile string
+var writeQuarantine string
+
+// rerun the failures of a package together
+var rerunBatchSize int
+
+// only retry failures with output matching these
+var retryIfMatches stringsFlag
+
+// fail when no tests are selected
+var failOnNoMatch bool
+
+// go test -count=1
+var disableCache bool
+
+// fresh GOCACHE, GOTMPDIR and HOME for every trial
+var isolateCache bool
+var isolateHome bool
+
+// run go test in containers of this image
+var dockerImage string
+var dockerMounts stringsFlag
+var dockerEnv stringsFlag
+
+// don't retry panics
+var noRetryOnPanic bool
+var race bool
+var retryRaces bool
+var precompile bool
+
+// log progress every
+var heartbeat time.Duration
+
+// kill quiet trials after
+var idleTimeout time.Duration
+
+// keep this much of each trial's output
+var maxOutputBytes int
+
+// merged coverage profile
+var coverProfile string
+var coverAllTrials bool
+
+// exit with 2 if tests were flaky
+var exitFlaky bool
+
+// run go test -json and parse its events
+var goJSON bool
+var flakyPolicy string
+
+// exit with 2 if more than this share of tests were flaky
+var failUnder float64
+
+// serve metrics on
+var metricsAddr string
+var metricsPush string
+
+// notify on completion
+var webhookURL string
+var webhookFormat string
+var webhookTemplate string
+var webhookWhen string
+
+// text, or gha for GitHub Actions annotations
+var format string
+
+// show the tests live
+var tui bool
+
+// auto, always or never
+var color string
+
+// list tests instead of running them
+var list bool
+var skeleton bool
+
+// explain which tests would run instead of running them
+var explain bool
+
+// run a single test this many times instead, to see how flaky it is
+var stress string
+var stressRuns int
+var stressMaxFailures int
+var detect bool
+
+// log slowest tests
+var top int
+
+// run only tests which failed or flaked in this report
+var rerunFrom string
+
+// run only tests of packages changed since this git ref
+var changedSince string
+
+// run only shard i/n of the tests
+var shard string
+
+// randomize test order
+var shuffle bool
+var seed int64
+
+// stringsFlag collects the values of a repeated flag
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// listFlag collects the values of a repeated flag, splitting each on commas
+type listFlag struct {
+	stringsFlag
+}
+
+func (l *listFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			l.stringsFlag = append(l.stringsFlag, s)
+		}
+	}
+	return nil
+}
 
 func init() {
-	flag.StringVar(&testsFile, "f", "", "path file to file containing tests to run")
+	flag.Var(&testsFiles, "f", "path to file containing tests to run (repeatable, or comma-separated)")
+	flag.Var(&files, "file", "run the tests of this test file, or with path:line the test or subtest around that line, instead of the tests file's (repeatable)")
+	flag.StringVar(&discover, "discover", "", "also run every package with tests matching this pattern, eg. ./..., which the tests file doesn't list tests of; the tests file may then be left out")
+	flag.BoolVar(&discoverModules, "discover-modules", false, "discover the packages of every module under -dir, each tested from its module's root, matching -discover in each (default ./...)")
+	flag.Var(&trialsFor, "trials-for", "allowed trials of the tests matching a pattern, as PATTERN=N, over any others; repeatable")
+	flag.BoolVar(&ci, "ci", onCI(), "use the citrials= of tests, and -ci-trials, rather than their trials= and -t (default true if CI is set)")
+	flag.IntVar(&ciTrialsAllowed, "ci-trials", 0, "with -ci, allowed trials of tests without their own, 0 for -t")
 	flag.StringVar(&whitelistMatch, "w", "", "whitelist lines containing")
 	flag.StringVar(&blacklistMatch, "b", "", "blacklist lines containing")
+	flag.StringVar(&matchMode, "match", schroedinger.MatchSubstring, "how -w and -b patterns match lines: substring, or regexp for regular expressions, eg. '^./eth TestSync$'")
 	flag.IntVar(&trialsAllowed, "t", 3, "allowed trials before nondeterministic test actually fails")
+	flag.BoolVar(&orderedOutput, "ordered-output", false, "log each test in one block once it has finished, rather than as it goes")
+	flag.StringVar(&goBinary, "go", "", "path to the go binary to test with (default $SCHROEDINGER_GO, else the one of GOROOT, or on PATH)")
+	flag.Var(&tagsInclude, "tags-include", "run only tests with one of these comma-separated tags")
+	flag.Var(&tagsExclude, "tags-exclude", "don't run tests with any of these comma-separated tags")
+	flag.StringVar(&workDir, "dir", "", "directory to run tests from (default current directory)")
+	flag.StringVar(&eventsFile, "events", "", "write an event per line to this file as the run goes")
+	flag.StringVar(&outputDir, "output-dir", "", "write a repro file for each failed test, and the output of each failed trial, into this directory")
+	flag.StringVar(&artifactsDir, "artifacts", "", "write the output of every trial, with its command line, to <dir>/<pkg>/<test>/trial-<n>.log")
+	flag.StringVar(&replay, "replay", "", "run the test of this repro file again as it failed")
+	flag.StringVar(&historyFile, "history", "", "keep the outcomes of tests over many runs in this file and log the most flaky")
+	flag.IntVar(&historyRuns, "history-runs", 100, "keep this many runs in the history file, 0 for all")
+	flag.DurationVar(&historyMaxAge, "history-max-age", 0, "keep only runs this recent in the history file, 0 for all")
+	flag.Var(&setup, "setup", "shell command to run before the tests; repeatable")
+	flag.Var(&teardown, "teardown", "shell command to run after the tests, however they end; repeatable")
+	flag.StringVar(&reportFile, "report", "", "write a JSON report of the run to this file")
+	flag.StringVar(&reportFile, "json-report", "", "the same as -report")
+	flag.StringVar(&junitFile, "junit", "", "write a JUnit XML report of the run to this file")
+	flag.StringVar(&htmlFile, "html", "", "write a standalone HTML report of the run, with the output of every trial, to this file")
+	flag.StringVar(&stateFile, "resume", "", "skip tests recorded as passed in this state file, and record passes to it")
+	flag.DurationVar(&stateTTL, "resume-ttl", 24*time.Hour, "how long a recorded pass is trusted for, 0 for forever")
+	flag.BoolVar(&shuffle, "shuffle", false, "start tests in random order")
+	flag.Int64Var(&seed, "seed", 0, "seed for -shuffle, 0 picks (and logs) a random one")
+	flag.IntVar(&maxParallel, "max-parallel", runtime.NumCPU(), "maximum number of tests to run at once, 0 for no limit")
+	flag.IntVar(&maxParallel, "p", runtime.NumCPU(), "the same as -max-parallel")
+	flag.Float64Var(&adaptiveParallel, "adaptive-parallel", 0, "adapt the number of tests running at once, up to -max-parallel, to keep the share of flaky or failed tests under this, eg. 0.02; 0 for off")
+	flag.Float64Var(&maxStartsPerSecond, "max-starts-per-second", 0, "maximum number of trials to start per second, retries and reruns included, 0 for unlimited")
+	flag.IntVar(&goTestP, "go-p", 0, "pass -p to go test")
+	flag.DurationVar(&goTestTimeout, "go-timeout", 0, "pass -timeout to go test")
+	flag.IntVar(&goTestParallel, "go-parallel", 0, "pass -parallel to go test")
+	flag.StringVar(&goTestArgs, "go-args", "", "further arguments to append to every go test command line, eg. \"-short -integration.url=...\"")
+	flag.BoolVar(&goJSON, "go-json", true, "run go test -json, if go has it, and find failing tests from its events rather than its text output")
+	flag.IntVar(&maxOutputBytes, "max-output-bytes", 0, "keep only the first and last halves of this many bytes of each trial's output, 0 for all")
+	flag.StringVar(&coverProfile, "coverprofile", "", "write a coverage profile merged from every test's last trial to this file")
+	flag.BoolVar(&coverAllTrials, "cover-all-trials", false, "with -coverprofile, merge the profiles of every trial, taking the largest count of each block, rather than of every test's last trial")
+	flag.StringVar(&parser, "parser", schroedinger.ParserText, "how to find the failing tests of a package in its output: "+strings.Join(schroedinger.Parsers(), " or "))
+	flag.DurationVar(&timeout, "timeout", 0, "cut the run short after this long, killing the trials running, 0 for no limit")
+	flag.DurationVar(&retryDelay, "retry-delay", 0, "wait this long before retrying a failed test")
+	flag.StringVar(&retryBackoff, "retry-backoff", string(schroedinger.BackoffFixed), "how the wait grows with each retry: fixed or exponential (doubling)")
+	flag.Float64Var(&retryJitter, "retry-jitter", 0.2, "share of the retry wait added or taken at random, eg. 0.2 for up to 20%")
+	flag.StringVar(&skipStable, "skip-stable", "", "record tests passing first try in this file, and skip them in later runs until their packages' files change")
+	flag.StringVar(&statusFile, "status-file", "", "rewrite this JSON file every few seconds with the tests queued, running and done, and mark it complete at the end")
+	flag.BoolVar(&jsonSummary, "json-summary", false, "print a one line JSON summary of the outcome to stdout at the end, and everything else to stderr")
+	flag.StringVar(&quarantineFile, "quarantine-file", "", "run the tests listed in this file, one per line as 'package name' or 'name', without counting their outcomes")
+	flag.StringVar(&writeQuarantine, "write-quarantine", "", "after the run, write the tests which needed more than one trial to pass to this quarantine file, with suggested trials=")
+	flag.IntVar(&maxFailures, "max-failures", 1, "stop the run once this many tests have failed, killing those running")
+	flag.BoolVar(&keepGoing, "keep-going", false, "run every test however many fail, overriding -max-failures, and report all of the failures at the end")
+	flag.IntVar(&rerunBatchSize, "rerun-batch", 0, "rerun up to this many failing tests of a package in one go test run, then those failing again one by one")
+	flag.Var(&retryIfMatches, "retry-if", "only retry failures with output matching this regexp (repeatable)")
+	flag.BoolVar(&exitFlaky, "exit-flaky", false, "exit with code 2 if any test only passed after retries; the same as -flaky-policy fail")
+	flag.StringVar(&flakyPolicy, "flaky-policy", string(schroedinger.FlakyIgnore), "how to treat tests which only passed after retries: ignore, warn (flag them in the log) or fail (and exit with code 2)")
+	flag.Float64Var(&failUnder, "fail-under", 0, "exit with code 2 if more than this share of the tests which ran were flaky, eg. 0.05; 0 for never")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve Prometheus metrics at this address, eg. :9090")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "the same as -metrics")
+	flag.StringVar(&metricsPush, "metrics-push", "", "push Prometheus metrics to this Pushgateway when the run finishes, eg. http://pushgateway:9091")
+	flag.StringVar(&webhookURL, "webhook", "", "POST a summary to this URL when the run finishes")
+	flag.StringVar(&webhookFormat, "webhook-format", "json", "webhook payload format, json or slack")
+	flag.StringVar(&webhookTemplate, "webhook-template", "", "text/template for the webhook message")
+	flag.StringVar(&webhookWhen, "webhook-when", "always", "when to POST to the webhook: always, flaky (with flaky or failed tests) or fail (with failed tests)")
+	flag.StringVar(&format, "format", defaultFormat(), "text, or gha to annotate failed and flaky tests with GitHub Actions workflow commands and write a job summary (default gha if GITHUB_ACTIONS is true)")
+	flag.BoolVar(&tui, "tui", false, "show a table of the tests, their status, trial and time, updated in place, rather than logging every trial")
+	flag.StringVar(&color, "color", "auto", "compact colored output: auto (if stdout is a terminal), always or never")
+	flag.BoolVar(&list, "list", false, "list the tests in the packages of the tests file instead of running them")
+	flag.BoolVar(&explain, "explain", false, "print whether each test would run and why, instead of running them")
+	flag.StringVar(&stress, "stress", "", "run only this test, as 'TestName' or 'package TestName', -n times, and print how often and how it failed")
+	flag.BoolVar(&detect, "detect", false, "run every test -n times, and print how often each failed")
+	flag.IntVar(&stressRuns, "n", 100, "with -stress or -detect, number of runs")
+	flag.IntVar(&stressMaxFailures, "stress-max-failures", 0, "with -stress or -detect, stop a test after this many failed runs, 0 for no limit")
+	flag.BoolVar(&skeleton, "skeleton", false, "with -list, print a tests file with trials for every test")
+	flag.BoolVar(&failOnNoMatch, "fail-on-no-match", true, "fail if the white and blacklists leave no tests to run")
+	flag.BoolVar(&disableCache, "disable-cache", true, "run go test with -count=1 so results are never cached")
+	flag.BoolVar(&isolateCache, "isolate-cache", false, "run every trial with a fresh, empty GOCACHE and GOTMPDIR")
+	flag.BoolVar(&isolateHome, "isolate-home", false, "run every trial with a fresh, empty HOME too; implies -isolate-cache")
+	flag.StringVar(&dockerImage, "docker", "", "run go test in a fresh container of this image for every trial, eg. golang:1.21")
+	flag.Var(&dockerMounts, "docker-mount", "with -docker, mount this volume too, as for docker run -v; repeatable")
+	flag.Var(&dockerEnv, "docker-env", "with -docker, set this variable, as for docker run -e; repeatable")
+	flag.BoolVar(&noRetryOnPanic, "no-retry-on-panic", false, "don't retry failures which panicked")
+	flag.BoolVar(&race, "race", false, "run go test with -race")
+	flag.BoolVar(&retryRaces, "retry-races", false, "retry failures with a data race like any other, rather than failing them right away")
+	flag.BoolVar(&precompile, "precompile", false, "build each package's test binary once with go test -c, and run it for every trial")
+	flag.DurationVar(&heartbeat, "heartbeat", 30*time.Second, "log progress this often, 0 for never")
+	flag.DurationVar(&idleTimeout, "idle-timeout", 0, "kill and fail a trial producing no output for this long, 0 for never")
+	flag.IntVar(&top, "top", 0, "log this many of the slowest tests with the summary")
+	flag.StringVar(&rerunFrom, "rerun-from", "", "run only the tests which failed or were flaky in this -report")
+	flag.StringVar(&changedSince, "changed-since", "", "run only tests of packages changed since this git ref, eg. origin/master")
+	flag.StringVar(&shard, "shard", "", "run only shard i/n of the tests, eg. 0/4")
 	flag.Parse()
 }
 
 func main() {
-	if testsFile == "" {
-		log.Fatal("testsfile cannot be empty")
+	if flag.Arg(0) == "merge" {
+		mergeReports(flag.Args()[1:])
+		return
+	}
+	if flag.Arg(0) == "history" {
+		showHistory(flag.Args()[1:])
+		return
+	}
+	if replay != "" {
+		r, err := schroedinger.ReadRepro(replay)
+		if err != nil {
+			fatal(err)
+		}
+		if err := schroedinger.Replay(&schroedinger.Config{}, r, os.Stdout); err != nil {
+			log.Println("FAIL:", err)
+			os.Exit(schroedinger.ExitFailed)
+		}
+		log.Println("PASS")
+		return
+	}
+	if len(testsFiles.stringsFlag) == 0 && len(files) == 0 && discover == "" && !discoverModules {
+		fatal("testsfile cannot be empty")
 	}
 	if trialsAllowed < 1 {
-		log.Fatal("trials allowed cannot be less than 1")
+		fatal("trials allowed cannot be less than 1")
 	}
 	if (whitelistMatch != "" && blacklistMatch != "") && whitelistMatch == blacklistMatch {
-		log.Fatal("whitelist cannot match blacklist")
+		fatal("whitelist cannot match blacklist")
+	}
+	var webhook *schroedinger.Webhook
+	if webhookURL != "" {
+		webhook = &schroedinger.Webhook{
+			URL:      webhookURL,
+			Format:   webhookFormat,
+			Template: webhookTemplate,
+			When:     webhookWhen,
+		}
+	}
+	overrides := make(map[string]int)
+	for _, tf := range trialsFor {
+		i := strings.LastIndex(tf, "=")
+		n, err := strconv.Atoi(tf[i+1:])
+		if i < 1 || err != nil || n < 1 {
+			fatal("bad -trials-for, want PATTERN=N:", tf)
+		}
+		overrides[tf[:i]] = n
+	}
+	var docker *schroedinger.Docker
+	if dockerImage != "" {
+		docker = &schroedinger.Docker{
+			Image:  dockerImage,
+			Mounts: dockerMounts,
+			Env:    dockerEnv,
+		}
 	}
-	schroedinger.Run(testsFile, whitelistMatch, blacklistMatch, trialsAllowed)
-}
\ No newline at end of file
+	var shardIndex, shardTotal int
+	if shard != "" {
+		if _, err := fmt.Sscanf(shard, "%d/%d", &shardIndex, &shardTotal); err != nil {
+			fatal("bad shard:", shard)
+		}
+	}
+	c := &schroedinger.Config{
+		TestsFiles:          testsFiles.stringsFlag,
+		Files:               files,
+		Discover:            discover,
+		DiscoverModules:     discoverModules,
+		WhitelistMatch:      whitelistMatch,
+		BlacklistMatch:      blacklistMatch,
+		MatchMode:           matchMode,
+		TrialsAllowed:       trialsAllowed,
+		TrialsFor:           overrides,
+		CI:                  ci,
+		CITrialsAllowed:     ciTrialsAllowed,
+		WorkDir:             workDir,
+		EventsFile:          eventsFile,
+		OutputDir:           outputDir,
+		ArtifactsDir:        artifactsDir,
+		HistoryFile:         historyFile,
+		HistoryRuns:         historyRuns,
+		HistoryMaxAge:       historyMaxAge,
+		Setup:               setup,
+		Teardown:            teardown,
+		ReportFile:          reportFile,
+		JUnitFile:           junitFile,
+		HTMLFile:            htmlFile,
+		StateFile:           stateFile,
+		StateTTL:            stateTTL,
+		MaxParallel:         maxParallel,
+		AdaptiveParallel:    adaptiveParallel,
+		MaxStartsPerSecond:  maxStartsPerSecond,
+		GoTestP:             goTestP,
+		GoTestTimeout:       goTestTimeout,
+		GoTestParallel:      goTestParallel,
+		GoTestArgs:          strings.Fields(goTestArgs),
+		GoTestJSON:          goJSON,
+		Parser:              parser,
+		MaxFailures:         maxFailures,
+		KeepGoing:           keepGoing,
+		StressMaxFailures:   stressMaxFailures,
+		QuarantineFile:      quarantineFile,
+		WriteQuarantineFile: writeQuarantine,
+		RerunBatchSize:      rerunBatchSize,
+		RetryIfMatches:      retryIfMatches,
+		OrderedOutput:       orderedOutput,
+		GoBinary:            goBinary,
+		TagsInclude:         tagsInclude.stringsFlag,
+		TagsExclude:         tagsExclude.stringsFlag,
+		FailOnNoMatch:       failOnNoMatch,
+		DisableCache:        disableCache,
+		IsolateCache:        isolateCache,
+		IsolateHome:         isolateHome,
+		Docker:              docker,
+		NoRetryOnPanic:      noRetryOnPanic,
+		Race:                race,
+		RetryRaces:          retryRaces,
+		Precompile:          precompile,
+		Heartbeat:           heartbeat,
+		IdleTimeout:         idleTimeout,
+		MaxOutputBytes:      maxOutputBytes,
+		CoverProfile:        coverProfile,
+		CoverAllTrials:      coverAllTrials,
+		ExitFlaky:           exitFlaky,
+		FlakyPolicy:         schroedinger.FlakyPolicy(flakyPolicy),
+		FailUnder:           failUnder,
+		JSONSummary:         jsonSummary,
+		StatusFile:          statusFile,
+		SkipStable:          skipStable,
+		Timeout:             timeout,
+		RetryDelay:          retryDelay,
+		RetryBackoff:        schroedinger.RetryBackoff(retryBackoff),
+		RetryJitter:         retryJitter,
+		MetricsAddr:         metricsAddr,
+		MetricsPushURL:      metricsPush,
+		Webhook:             webhook,
+		Format:              format,
+		TUI:                 tui,
+		Color:               color,
+		Top:                 top,
+		RerunFrom:           rerunFrom,
+		ChangedSince:        changedSince,
+		ShardIndex:          shardIndex,
+		ShardTotal:          shardTotal,
+		Shuffle:             shuffle,
+		Seed:                seed,
+	}
+	if explain {
+		if err := schroedinger.Explain(c, os.Stdout); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if stress != "" {
+		res, err := schroedinger.Stress(c, stress, stressRuns, os.Stdout)
+		if err != nil && res == nil {
+			fatal(err)
+		}
+		if err != nil {
+			// interrupted, after writing the runs done
+			log.Println(err)
+			os.Exit(schroedinger.ExitCancelled)
+		}
+		if res.Fails > 0 {
+			os.Exit(schroedinger.ExitFailed)
+		}
+		return
+	}
+	if detect {
+		results, err := schroedinger.Detect(c, stressRuns, os.Stdout)
+		if err != nil && results == nil {
+			fatal(err)
+		}
+		if err != nil {
+			// interrupted, after writing the tests done
+			log.Println(err)
+			os.Exit(schroedinger.ExitCancelled)
+		}
+		for _, res := range results {
+			if res.Fails > 0 {
+				os.Exit(schroedinger.ExitFailed)
+			}
+		}
+		return
+	}
+	if list {
+		if err := schroedinger.List(c, os.Stdout, skeleton); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	os.Exit(schroedinger.Run(c))
+}
+
+// merge -o merged.json shard0.json shard1.json ...
+func mergeReports(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	out := fs.String("o", "", "path to write the merged report to")
+	fs.Parse(args)
+	if *out == "" || fs.NArg() == 0 {
+		fatal("usage: schroedinger merge -o merged.json report.json...")
+	}
+	var reports []*schroedinger.Report
+	for _, p := range fs.Args() {
+		r, err := schroedinger.ReadReport(p)
+		if err != nil {
+			fatal(err)
+		}
+		reports = append(reports, r)
+	}
+	m, err := schroedinger.MergeReports(reports...)
+	if err != nil {
+		fatal(err)
+	}
+	if err := m.WriteFile(*out); err != nil {
+		fatal(err)
+	}
+	log.Println(m.Summary())
+}
+
+// history [-test PATTERN] history.json
+func showHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	test := fs.String("test", "", "list every recorded run of the tests matching this regexp, as 'package TestName'")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fatal("usage: schroedinger history [-test PATTERN] history.json")
+	}
+	if err := schroedinger.ShowHistory(fs.Arg(0), *test, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+// onCI reports whether the CI environment variable, set by most CI
+// services, is set to anything but false
+func onCI() bool {
+	v := os.Getenv("CI")
+	return v != "" && v != "false" && v != "0"
+}
+
+// defaultFormat is gha on GitHub Actions, text elsewhere
+func defaultFormat() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		return schroedinger.FormatGitHub
+	}
+	return schroedinger.FormatText
+}
+
+func fatal(v ...interface{}) {
+	log.Println(v...)
+	os.Exit(schroedinger.ExitError)
+}
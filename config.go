@@ -0,0 +1,636 @@
+package schroedinger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Config configures a run.
+type Config struct {
+	// paths to files containing tests to run; their tests are concatenated
+	TestsFiles []string
+
+	// test files to run the tests of instead, as path/to/foo_test.go, or
+	// path/to/foo_test.go:42 for the test or subtest around that line;
+	// tests listed in TestsFiles, if any, keep their options there
+	Files []string
+
+	// package pattern, eg. './...', whose packages with tests are run too,
+	// each as a plain 'package' line of a tests file would be, unless a
+	// tests file lists tests of it; with it, TestsFiles may be empty
+	Discover string
+
+	// discover the packages of every module under WorkDir, found by their
+	// go.mod files, rather than only those of the module holding it; each
+	// is tested from the root of its module. Discover is the pattern to
+	// match within each module, './...' if not given.
+	DiscoverModules bool
+
+	// comma-separated patterns to match lines of the tests file against
+	WhitelistMatch string
+	BlacklistMatch string
+	// how the patterns match: MatchSubstring (the default) or MatchRegexp
+	MatchMode string
+
+	// path to the go binary to test with; by default that named by the
+	// SCHROEDINGER_GO environment variable, or else that of the GOROOT this
+	// was built with if there is one, otherwise the one on PATH
+	GoBinary string
+
+	// tests tagged with tags=; if TagsInclude is given, only tests carrying
+	// at least one of its tags run, and tests carrying any of TagsExclude
+	// never do. Tags combine with the white and blacklists: a test has to
+	// pass both.
+	TagsInclude []string
+	TagsExclude []string
+
+	// path to a file listing tests to quarantine, one per line as 'package
+	// name' or just 'name', if any, and optionally trials=N to try them at
+	// least that many times; as with quarantine=true, they run as usual, but
+	// their outcomes don't count towards that of the run
+	QuarantineFile string
+
+	// path to write the tests which needed more than one trial to pass to
+	// after the run, as a quarantine file suggesting their trials=, to be fed
+	// back as QuarantineFile
+	WriteQuarantineFile string
+
+	// fail the run if the white and blacklists leave no tests to run, rather
+	// than passing it; the command line sets this by default
+	FailOnNoMatch bool
+
+	// allowed times to try to get a nondeterministic test to pass
+	TrialsAllowed int
+
+	// the run is on CI, where tests use their citrials= rather than their
+	// trials=, and CITrialsAllowed (if set) stands in for TrialsAllowed;
+	// the command line sets this if the CI environment variable is set
+	CI              bool
+	CITrialsAllowed int
+
+	// trials allowed of the tests matching each pattern, overriding every
+	// other source of trials: a pattern matches a test it names exactly,
+	// by name or as 'package name', or else is contained in its line, the
+	// longest such pattern winning
+	TrialsFor map[string]int
+
+	// directory to run go test from, current directory if empty;
+	// tests can override it with dir=<path>
+	WorkDir string
+
+	// shell commands run from WorkDir before the first test, in order, eg. to
+	// start a database; the run fails if one fails. The Teardown commands
+	// all run after the last test, however the run ends, even if setup
+	// failed or the run was interrupted.
+	Setup    []string
+	Teardown []string
+
+	// path to write a JSON report to after the run, if any
+	ReportFile string
+
+	// path to write a JUnit XML report to after the run, if any
+	JUnitFile string
+
+	// path to write a standalone HTML report to after the run, if any,
+	// with the outcome and output of every trial
+	HTMLFile string
+
+	// directory to write files about the run into, if any: a repro-*.json
+	// file for each failed test, to run it again with Replay, and the
+	// output of each failed trial, see TestResult.OutputFiles
+	OutputDir string
+
+	// directory to write the output of every trial into as it finishes, if
+	// any, as <pkg>/<test>/trial-<n>.log after a header with its command
+	// line and directory, for CI to keep
+	ArtifactsDir string
+
+	// path to write an Event per line to as the run goes, if any
+	EventsFile string
+
+	// path to a file keeping the outcomes of tests over many runs, if any;
+	// the most flaky tests over them are logged at the end of each run.
+	// Only the last HistoryRuns runs within HistoryMaxAge are kept, where set.
+	HistoryFile   string
+	HistoryRuns   int
+	HistoryMaxAge time.Duration
+
+	// path to a file recording which tests passed; tests which passed
+	// within StateTTL are not run again (zero TTL never expires)
+	StateFile string
+	StateTTL  time.Duration
+
+	// path to a file recording which tests passed on their first trial,
+	// with a hash of their packages' files; such tests are not run again,
+	// and reported as OutcomeStable, until those files change. Tests which
+	// were flaky or failed are forgotten, and run as usual.
+	SkipStable string
+
+	// cut the run short after this long, if set: trials running are killed,
+	// no more start, and Run exits with ExitCancelled. The go test -timeout
+	// of a trial is kept within the time left, and a failing test isn't
+	// retried if its last trial took longer than that.
+	Timeout time.Duration
+
+	// how long to wait before retrying a failed test, none if 0, to let
+	// eg. ports freed by its last trial be released. RetryBackoff is how
+	// the wait grows with each retry, BackoffFixed if unset, and
+	// RetryJitter the share of it added or taken at random, eg. 0.2 for
+	// up to 20%, so retries of tests failing together spread out.
+	RetryDelay   time.Duration
+	RetryBackoff RetryBackoff
+	RetryJitter  float64
+
+	// maximum number of tests to run at once, unlimited if 0; the command
+	// line and NewRunner default to the number of CPUs
+	MaxParallel int
+
+	// if set, the target share of flaky or failed tests, eg. 0.02 for 2%,
+	// for a limit on the tests running at once which adapts to keep under
+	// it: starting at half of MaxParallel, or of the number of CPUs if
+	// unset, it is halved when too many tests are unsettled and raised by
+	// one otherwise, up to MaxParallel, unless trials got slower for it
+	AdaptiveParallel float64
+
+	// start at most this many trials a second, retries and reruns too,
+	// however many could run at once, eg. for tests sharing a rate limited
+	// service; unlimited if 0
+	MaxStartsPerSecond float64
+
+	// passed through as go test -p and -parallel when set;
+	// tests can override them with p=<n> and parallel=<n>
+	GoTestP        int
+	GoTestParallel int
+
+	// passed through as go test -timeout when set, so a hanging test panics
+	// with a stack of every goroutine; the tests which were running are
+	// then retried as failures. Trials still running a minute after are
+	// killed, eg. hung in cgo. Tests can override it with timeout=<duration>.
+	GoTestTimeout time.Duration
+
+	// appended verbatim to every go test command line, eg. -short or a
+	// flag of the tests' own like -integration.url=...; tests append theirs
+	// with args="..."
+	GoTestArgs []string
+
+	// name of the FailureParser finding the failing tests of a package to
+	// rerun: ParserText (the default), ParserJSON, or one added with
+	// RegisterParser
+	Parser string
+
+	// rerun up to this many of the failing tests found in a package together,
+	// in one go test run, rather than each in its own; those failing again
+	// are then rerun one by one. Off if 0 or 1.
+	RerunBatchSize int
+
+	// stop the run once this many tests have failed all their trials,
+	// killing the tests running and starting no more; those are listed in
+	// the report as not run. The default, 0, stops at the first failure.
+	MaxFailures int
+
+	// run every test however many fail, ignoring MaxFailures, and return the
+	// errors of all of the failed tests, joined, at the end
+	KeepGoing bool
+
+	// with Stress, stop the runs once this many have failed, rather than
+	// run them all; 0 for no limit
+	StressMaxFailures int
+
+	// regular expressions; if any are given, a failed trial is only
+	// retried if its output matches one of them
+	RetryIfMatches []string
+
+	// run go test with -count=1 so it never returns cached results, which
+	// would hide flakiness; the command line sets this by default. A cached
+	// result is counted as skipped either way, never as a pass.
+	DisableCache bool
+
+	// run go test with -json, if the go in use has it, and find the failing
+	// tests of packages from its events rather than by grepping its output;
+	// the command line sets this by default. Output is logged and kept as
+	// text all the same.
+	GoTestJSON bool
+
+	// don't retry a failure which panicked or hit a fatal runtime error,
+	// as those are taken to be real bugs rather than flakiness
+	NoRetryOnPanic bool
+
+	// run go test with -race; tests can override it with race=. A failure
+	// with a data race, found whether or not -race came from here, is
+	// not retried unless RetryRaces, as a race is a bug however rarely it
+	// shows, and the tests which hit one are listed after the summary.
+	Race       bool
+	RetryRaces bool
+
+	// build each package's test binary once, with go test -c, and run it for
+	// every trial of its tests rather than go test; go test's output, eg.
+	// 'ok' or 'FAIL' and the package, is added to the binary's. Tests of
+	// commands, recursive packages, benchmarks and isolated or docker trials
+	// run go test as usual.
+	Precompile bool
+
+	// run every trial with GOCACHE and GOTMPDIR pointing into a fresh
+	// temporary directory, removed after the trial, so no trial sees the
+	// build and test cache of another; slower, as everything is built anew.
+	// IsolateHome gives every trial a fresh HOME as well, keeping GOPATH
+	// and GOMODCACHE as they were, and implies IsolateCache.
+	IsolateCache bool
+	IsolateHome  bool
+
+	// run go test in a fresh container of this image for every trial, with
+	// the directory it would run from on the host mounted as its working
+	// directory, if set; shell commands (cmd=, hooks, Setup) still run on
+	// the host. Containers of trials killed by IdleTimeout are killed too.
+	Docker *Docker
+
+	// kill and fail a trial which produces no output for this long, if set
+	IdleTimeout time.Duration
+
+	// keep only the first and last MaxOutputBytes/2 bytes of the output of
+	// a trial, noting how much was left out in between, so a test writing
+	// gigabytes can't exhaust memory; unlimited if 0. Failures are found in
+	// what is kept, and go test reports them at the end.
+	MaxOutputBytes int
+
+	// path to write the merged coverage profile of the last trial
+	// of every test to, if any
+	CoverProfile string
+	// merge the coverage profiles of every trial, failed or not, rather
+	// than the last of each test, taking the largest count of each block so
+	// a block run by several trials doesn't count more than once
+	CoverAllTrials bool
+
+	// exit with ExitFlaky rather than ExitOK if any test only passed
+	// after failing; the same as FlakyPolicy FlakyFail
+	ExitFlaky bool
+
+	// how tests which only passed after failing are treated, FlakyIgnore
+	// if unset
+	FlakyPolicy FlakyPolicy
+
+	// path to a JSON file rewritten every few seconds with a snapshot of
+	// the run, see Status; marked complete when the run is over
+	StatusFile string
+
+	// print a single line JSON summary of the outcome to stdout at the end
+	// of Run, see JSONSummary, with everything else going to stderr
+	JSONSummary bool
+
+	// exit with ExitFlaky if more than this share of the tests which ran
+	// were flaky, eg. 0.05 for 5%, even if all passed in the end; see
+	// Report.FlakyRate. Off if 0.
+	FailUnder float64
+
+	// log how many tests are running, queued and done, and which have been
+	// running longest, this often; never if 0
+	Heartbeat time.Duration
+
+	// address to serve Prometheus metrics on at /metrics during the run, if any
+	MetricsAddr string
+	// Prometheus Pushgateway to push the metrics of the run to when it
+	// finishes, if any, eg. http://pushgateway:9091, under the job
+	// schroedinger unless the URL names one, eg. .../metrics/job/nightly
+	MetricsPushURL string
+
+	// notified with a summary when the run finishes, if set
+	Webhook *Webhook
+
+	// ColorAuto (default), ColorAlways or ColorNever; with color, a compact
+	// line is printed per test instead of every trial and its output
+	Color string
+
+	// show a table of the tests, their status, trial and time, redrawn in
+	// place as they run, instead of logging every trial, when stdout is a
+	// terminal; the log is held back until the run is over
+	TUI bool
+
+	// FormatText (default) or FormatGitHub; the latter annotates failed and
+	// flaky tests with GitHub Actions workflow commands as they finish, and
+	// appends a summary to the job summary, GITHUB_STEP_SUMMARY, if set
+	Format string
+
+	// without color, hold back what is logged about each test until it has
+	// finished and then log it in one block, so the logs of tests running
+	// at once don't interleave
+	OrderedOutput bool
+
+	// log the Top slowest tests with the summary, if set
+	Top int
+
+	// path to the report of an earlier run; if set, only the tests which
+	// failed or were flaky in it run, with their trials as configured now
+	RerunFrom string
+
+	// git ref; if set, only tests of packages with .go files changed since
+	// then are run, and the rest reported as OutcomeUnchanged. Everything
+	// runs if a go.mod or go.sum changed, or git can't tell.
+	ChangedSince string
+
+	// run only the tests falling in shard ShardIndex (from 0) of ShardTotal;
+	// a test always falls in the same shard
+	ShardIndex int
+	ShardTotal int
+
+	// shuffle the order tests are started in; Seed 0 picks a random seed
+	Shuffle bool
+	Seed    int64
+
+	// OnResult, if set, is called each time a test reaches its final outcome.
+	// Calls are made one at a time from the goroutine collecting results,
+	// so it needs no locking, but it holds up the collection of further
+	// results (not the tests themselves) while it runs and should be quick.
+	OnResult func(TestResult)
+
+	// what the run logs to, set up as it starts
+	log *runLogger
+	// the white and blacklists, compiled by Validate
+	whites, blacks []matcher
+	// the packages found by Discover, once looked for; see discovered
+	discoveredPkgs []string
+}
+
+func (c *Config) onResult(r *TestResult) {
+	if c.OnResult != nil {
+		c.OnResult(*r)
+	}
+}
+
+func (c *Config) testsFiles() []string {
+	var files []string
+	for _, f := range c.TestsFiles {
+		f, _ = filepath.Abs(filepath.Clean(f))
+		files = append(files, f)
+	}
+	return files
+}
+
+// collectTests collects the tests from all of the tests files and the
+// packages of Config.Discover, or those of Config.Files if set
+func (c *Config) collectTests() ([]*test, error) {
+	var tests []*test
+	var errs []error
+	for _, f := range c.testsFiles() {
+		ts, err := collectTestsFromFile(f)
+		tests = append(tests, ts...)
+		errs = append(errs, err)
+	}
+	if c.discovering() {
+		var err error
+		tests, err = c.discoverTests(tests)
+		errs = append(errs, err)
+	}
+	if len(c.Files) > 0 {
+		tests, err := c.collectFileTests(tests)
+		return tests, errors.Join(append(errs, err)...)
+	}
+	return tests, errors.Join(errs...)
+}
+
+// Validate checks the config and the tests files it points to, returning
+// all of the problems found rather than just the first.
+func (c *Config) Validate() error {
+	var errs []error
+	if len(c.TestsFiles) == 0 && len(c.Files) == 0 && !c.discovering() {
+		errs = append(errs, errors.New("TestsFiles: must not be empty"))
+	}
+	if c.TrialsAllowed < 1 {
+		errs = append(errs, fmt.Errorf("TrialsAllowed: must be at least 1, got: %d", c.TrialsAllowed))
+	}
+	for p, n := range c.TrialsFor {
+		if p == "" || n < 1 {
+			errs = append(errs, fmt.Errorf("TrialsFor: bad %q=%d", p, n))
+		}
+	}
+	if c.CITrialsAllowed < 0 {
+		errs = append(errs, fmt.Errorf("CITrialsAllowed: must not be negative, got: %d", c.CITrialsAllowed))
+	}
+	if c.WorkDir != "" {
+		if err := checkDir(c.WorkDir); err != nil {
+			errs = append(errs, fmt.Errorf("WorkDir: %v", err))
+		}
+	}
+	if c.ShardTotal < 0 || c.ShardIndex < 0 || (c.ShardTotal > 0 && c.ShardIndex >= c.ShardTotal) {
+		errs = append(errs, fmt.Errorf("Shard: bad shard %d/%d", c.ShardIndex, c.ShardTotal))
+	}
+	switch c.FlakyPolicy {
+	case "", FlakyIgnore, FlakyWarn, FlakyFail:
+	default:
+		errs = append(errs, fmt.Errorf("FlakyPolicy: unknown policy: %s", c.FlakyPolicy))
+	}
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("Timeout: must not be negative, got: %v", c.Timeout))
+	}
+	if c.RetryDelay < 0 {
+		errs = append(errs, fmt.Errorf("RetryDelay: must not be negative, got: %v", c.RetryDelay))
+	}
+	switch c.RetryBackoff {
+	case "", BackoffFixed, BackoffExponential:
+	default:
+		errs = append(errs, fmt.Errorf("RetryBackoff: unknown backoff: %s", c.RetryBackoff))
+	}
+	if c.RetryJitter < 0 || c.RetryJitter > 1 {
+		errs = append(errs, fmt.Errorf("RetryJitter: must be between 0 and 1, got: %v", c.RetryJitter))
+	}
+	if c.AdaptiveParallel < 0 || c.AdaptiveParallel > 1 {
+		errs = append(errs, fmt.Errorf("AdaptiveParallel: must be between 0 and 1, got: %v", c.AdaptiveParallel))
+	}
+	if c.FailUnder < 0 || c.FailUnder > 1 {
+		errs = append(errs, fmt.Errorf("FailUnder: must be between 0 and 1, got: %v", c.FailUnder))
+	}
+	if c.Docker != nil {
+		if err := c.Docker.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("Docker: %v", err))
+		}
+	}
+	if _, err := lookupParser(c.Parser); err != nil {
+		errs = append(errs, fmt.Errorf("Parser: %v, have: %v", err, Parsers()))
+	}
+	switch c.Color {
+	case "", ColorAuto, ColorAlways, ColorNever:
+	default:
+		errs = append(errs, fmt.Errorf("Color: unknown mode: %s", c.Color))
+	}
+	switch c.MatchMode {
+	case "", MatchSubstring, MatchRegexp:
+		if err := c.compileMatchLists(); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MatchMode: unknown mode: %s", c.MatchMode))
+	}
+	switch c.Format {
+	case "", FormatText, FormatGitHub:
+	default:
+		errs = append(errs, fmt.Errorf("Format: unknown format: %s", c.Format))
+	}
+	for i, p := range c.RetryIfMatches {
+		if _, err := regexp.Compile(p); err != nil {
+			errs = append(errs, fmt.Errorf("RetryIfMatches[%d]: %v", i, err))
+		}
+	}
+	if len(c.TestsFiles) == 0 && len(c.Files) == 0 && !c.discovering() {
+		return errors.Join(errs...)
+	}
+
+	// duplicates are looked for across all files
+	tests, err := c.collectTests()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	resolveTrials(tests, c.trialsAllowed(), c.CI, c.TrialsFor)
+	seen := make(map[string]*test)
+	needsGo := false
+	for _, t := range tests {
+		needsGo = needsGo || t.command == ""
+		where := fmt.Sprintf("%s:%d", t.file, t.line)
+		key := t.pkg + " " + t.name
+		if first, ok := seen[key]; ok {
+			errs = append(errs, fmt.Errorf("%s: duplicate test %s, first listed at %s:%d", where, t, first.file, first.line))
+		} else {
+			seen[key] = t
+		}
+		if t.minPasses > t.trialsAllowed {
+			errs = append(errs, fmt.Errorf("%s: minpasses=%d exceeds trials=%d", where, t.minPasses, t.trialsAllowed))
+		}
+		if t.dir != "" {
+			if err := checkDir(t.dir); err != nil {
+				errs = append(errs, fmt.Errorf("%s: dir: %v", where, err))
+			}
+		}
+	}
+	if needsGo {
+		if err := checkGoBinary(c.goBinary()); err != nil {
+			errs = append(errs, fmt.Errorf("GoBinary: %v; set GoBinary (-go) or SCHROEDINGER_GO, or put go on PATH", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func checkDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s: not a directory", dir)
+	}
+	return nil
+}
+
+// trialsAllowed returns the trials allowed of tests without their own
+func (c *Config) trialsAllowed() int {
+	if c.CI && c.CITrialsAllowed > 0 {
+		return c.CITrialsAllowed
+	}
+	return c.TrialsAllowed
+}
+
+func (c *Config) goBinary() string {
+	if c.GoBinary != "" {
+		return c.GoBinary
+	}
+	return defaultGoPath
+}
+
+// loadTests reads the tests file and fills in the config's defaults
+func (c *Config) loadTests() ([]*test, error) {
+	goExecutablePath = c.goBinary()
+
+	tests, err := c.collectTests()
+	if err != nil {
+		return nil, err
+	}
+
+	var retryIf []*regexp.Regexp
+	for _, p := range c.RetryIfMatches {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad retry pattern: %v", err)
+		}
+		retryIf = append(retryIf, re)
+	}
+
+	var q quarantine
+	if c.QuarantineFile != "" {
+		if q, err = readQuarantine(c.QuarantineFile); err != nil {
+			return nil, fmt.Errorf("quarantine file: %v", err)
+		}
+	}
+	parser, err := lookupParser(c.Parser)
+	if err != nil {
+		return nil, err
+	}
+	goJSON := c.GoTestJSON && (c.Docker != nil || goSupportsJSON(goExecutablePath))
+	iso, err := newIsolation(c)
+	if err != nil {
+		return nil, fmt.Errorf("isolation: %v", err)
+	}
+
+	resolveTrials(tests, c.trialsAllowed(), c.CI, c.TrialsFor)
+	roots := make(map[string]string)
+	for _, t := range tests {
+		if t.dir == "" {
+			t.dir = c.WorkDir
+		}
+		t.resolveModule(roots)
+		if t.p == 0 {
+			t.p = c.GoTestP
+		}
+		if t.parallel == 0 {
+			t.parallel = c.GoTestParallel
+		}
+		t.retryIf = retryIf
+		t.idleTimeout = c.IdleTimeout
+		t.maxOutput = c.MaxOutputBytes
+		t.rerunBatch = c.RerunBatchSize
+		t.parser = parser
+		t.goJSON = goJSON
+		t.quarantined = t.quarantined || q.has(t)
+		// the quarantine file raises the trials as listed, not as given
+		// for the run with TrialsFor
+		if _, ok := trialsOverride(t, c.TrialsFor); !ok && q.trials(t) > t.trialsAllowed {
+			t.trialsAllowed = q.trials(t)
+		}
+		t.noRetryOnPanic = c.NoRetryOnPanic
+		if !t.raceSet {
+			t.race = c.Race
+		}
+		t.retryRaces = c.RetryRaces
+		t.disableCache = c.DisableCache
+		if t.goTestTimeout == 0 {
+			t.goTestTimeout = c.GoTestTimeout
+		}
+		if len(c.GoTestArgs) > 0 {
+			t.args = append(append([]string(nil), c.GoTestArgs...), t.args...)
+		}
+		t.backoff = c.backoff()
+		t.isolation = iso
+		t.docker = c.Docker
+		t.log = c.log
+	}
+	return tests, nil
+}
+
+// compileMatchLists compiles the white and blacklists as MatchMode says
+// they match
+func (c *Config) compileMatchLists() error {
+	var errs []error
+	var err error
+	if c.whites, err = compileMatchList(c.WhitelistMatch, c.MatchMode); err != nil {
+		errs = append(errs, fmt.Errorf("WhitelistMatch: %v", err))
+	}
+	if c.blacks, err = compileMatchList(c.BlacklistMatch, c.MatchMode); err != nil {
+		errs = append(errs, fmt.Errorf("BlacklistMatch: %v", err))
+	}
+	return errors.Join(errs...)
+}
+
+// selected reports whether t is let through by the white and blacklists,
+// as compiled by Validate, and the tag filters
+func (c *Config) selected(t *test) bool {
+	return lineMatchList(t.pkg+" "+t.name, c.whites, c.blacks) && t.tagged(c.TagsInclude, c.TagsExclude)
+}
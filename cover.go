@@ -0,0 +1,103 @@
+package schroedinger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mergeCoverProfiles merges go test coverage profiles into out, summing
+// the counts of blocks seen in several profiles, or keeping the largest
+// count if largest, and returns the percentage of statements covered.
+func mergeCoverProfiles(profiles []string, out string, largest bool) (float64, error) {
+	mode := ""
+	// block -> number of statements, count
+	stmts := make(map[string]int)
+	counts := make(map[string]int)
+
+	for _, p := range profiles {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			// eg. the trial failed to build
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, "mode: ") {
+				m := strings.TrimPrefix(line, "mode: ")
+				if mode != "" && mode != m {
+					f.Close()
+					return 0, fmt.Errorf("%s: mode %s conflicts with %s", p, m, mode)
+				}
+				mode = m
+				continue
+			}
+			// eg. 'github.com/ethereumproject/go-ethereum/p2p/dial.go:12.34,15.2 3 1'
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				continue
+			}
+			n, err1 := strconv.Atoi(fields[1])
+			c, err2 := strconv.Atoi(fields[2])
+			if err1 != nil || err2 != nil {
+				f.Close()
+				return 0, fmt.Errorf("%s: bad line: %s", p, line)
+			}
+			stmts[fields[0]] = n
+			if mode == "set" || largest {
+				if c > counts[fields[0]] {
+					counts[fields[0]] = c
+				}
+			} else {
+				counts[fields[0]] += c
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if mode == "" {
+		mode = "set"
+	}
+
+	blocks := make([]string, 0, len(stmts))
+	for b := range stmts {
+		blocks = append(blocks, b)
+	}
+	sort.Strings(blocks)
+
+	f, err := os.Create(out)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "mode: %s\n", mode)
+	var total, covered int
+	for _, b := range blocks {
+		fmt.Fprintf(w, "%s %d %d\n", b, stmts[b], counts[b])
+		total += stmts[b]
+		if counts[b] > 0 {
+			covered += stmts[b]
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	return 100 * float64(covered) / float64(total), nil
+}
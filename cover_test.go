@@ -0,0 +1,45 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeCoverProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.out")
+	b := filepath.Join(dir, "b.out")
+	ioutil.WriteFile(a, []byte("mode: count\npkg/a.go:1.1,2.2 2 1\npkg/a.go:3.1,4.2 1 0\n"), 0644)
+	ioutil.WriteFile(b, []byte("mode: count\npkg/a.go:1.1,2.2 2 3\npkg/b.go:1.1,2.2 1 0\n"), 0644)
+
+	out := filepath.Join(dir, "merged.out")
+	pct, err := mergeCoverProfiles([]string{a, b, filepath.Join(dir, "missing.out")}, out, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 of 4 statements covered
+	if pct != 50 {
+		t.Errorf("got: %v%%, want: 50%%", pct)
+	}
+	got, _ := ioutil.ReadFile(out)
+	want := "mode: count\npkg/a.go:1.1,2.2 2 4\npkg/a.go:3.1,4.2 1 0\npkg/b.go:1.1,2.2 1 0\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := mergeCoverProfiles([]string{a, b}, out, true); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = ioutil.ReadFile(out)
+	want = "mode: count\npkg/a.go:1.1,2.2 2 3\npkg/a.go:3.1,4.2 1 0\npkg/b.go:1.1,2.2 1 0\n"
+	if string(got) != want {
+		t.Errorf("max: got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Detect runs every selected test of the tests files n times, passed or
+// not, rather than until it passes, and writes the flake rate of each to
+// w, most failing first: eg. '3/50' for a test which failed 3 of 50 runs.
+// For a package, the tests failing in its runs are listed under it. It is
+// the inverse of Run, for deciding which tests to quarantine.
+//
+// Tests run one after the other, each as Stress runs it: up to
+// Config.MaxParallel runs at once, stopping early at
+// Config.StressMaxFailures if set, and always with the go test cache
+// disabled. An interrupt kills the runs going and starts no more tests; the
+// flake rates of the tests run so far are written and returned, along with
+// context.Canceled.
+func Detect(c *Config, n int, w io.Writer) ([]*StressResult, error) {
+	ctx, stop := interruptContext()
+	defer stop()
+	return detectContext(ctx, c, n, w)
+}
+
+// detectContext is Detect, stopping once ctx is done
+func detectContext(ctx context.Context, c *Config, n int, w io.Writer) ([]*StressResult, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, errors.New("detect: runs must be at least 1")
+	}
+	alltests, err := c.loadTests()
+	if err != nil {
+		return nil, err
+	}
+	tests := filterTests(alltests, c.selected)
+	if len(tests) == 0 && c.FailOnNoMatch {
+		return nil, noMatchError(alltests, c)
+	}
+	bins, err := c.precompile(tests)
+	if err != nil {
+		return nil, err
+	}
+	defer bins.remove()
+
+	start := time.Now()
+	var results []*StressResult
+	for _, t := range tests {
+		if ctx.Err() != nil {
+			break
+		}
+		results = append(results, c.stress(ctx, t, n))
+	}
+	writeDetect(w, results, n, time.Since(start))
+	if ctx.Err() != nil {
+		return results, fmt.Errorf("detect: %w", ctx.Err())
+	}
+	return results, nil
+}
+
+// writeDetect writes the failures of each test out of its runs, most
+// failing first, keeping the listed order of tests failing as often
+func writeDetect(w io.Writer, results []*StressResult, n int, d time.Duration) {
+	sorted := append([]*StressResult{}, results...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return flakeRate(sorted[i]) > flakeRate(sorted[j])
+	})
+	fmt.Fprintf(w, "DETECT %d tests, %d runs each, in %v\n", len(results), n, d.Round(time.Millisecond))
+	for _, r := range sorted {
+		note := ""
+		if r.Stopped {
+			note = " (stopped early)"
+		}
+		if r.Interrupted {
+			note = " (interrupted)"
+		}
+		fmt.Fprintf(w, "%7s %5.1f%% %s%s\n", fmt.Sprintf("%d/%d", r.Fails, r.Runs), 100*flakeRate(r), r.Test, note)
+		for _, c := range r.Cases {
+			fmt.Fprintf(w, "%7s        %s\n", fmt.Sprintf("%d/%d", c.Fails, r.Runs), c.Name)
+		}
+	}
+}
+
+func flakeRate(r *StressResult) float64 {
+	if r.Runs == 0 {
+		return 0
+	}
+	return float64(r.Fails) / float64(r.Runs)
+}
@@ -0,0 +1,81 @@
+package schroedinger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go whose package run fails TestA every other run, and TestB as well
+	// every fourth
+	fake := filepath.Join(dir, "go")
+	script := `#!/bin/sh
+n=$(cat ` + filepath.Join(dir, "count") + ` 2>/dev/null || echo 0); n=$((n+1)); echo $n > ` + filepath.Join(dir, "count") + `
+if [ $((n % 2)) = 0 ]; then echo '--- FAIL: TestA (0.00s)'; fi
+if [ $((n % 4)) = 0 ]; then echo '--- FAIL: TestB (0.00s)'; fi
+if [ $((n % 2)) = 0 ]; then echo FAIL; exit 1; fi
+echo ok
+`
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth\n./p2p TestDial cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, GoBinary: fake, WorkDir: dir, TrialsAllowed: 1}
+
+	var out bytes.Buffer
+	res, err := Detect(c, 8, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 || res[0].Fails != 4 || res[0].Runs != 8 || res[1].Fails != 0 {
+		t.Fatalf("got: %+v", res)
+	}
+	if want := []StressCase{{"TestA", 4}, {"TestB", 2}}; !reflect.DeepEqual(res[0].Cases, want) {
+		t.Errorf("cases: got: %v, want: %v", res[0].Cases, want)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 5 || !strings.Contains(lines[1], "4/8  50.0% ./eth") || !strings.Contains(lines[2], "4/8        TestA") || !strings.Contains(lines[4], "0/8   0.0% ./p2p TestDial") {
+		t.Errorf("output:\n%s", out.String())
+	}
+}
+
+func TestDetectCancel(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses /proc")
+	}
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync "+leaveChild(pidFile)+"\n./p2p TestDial cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancelOnFile(cancel, pidFile)
+	var out bytes.Buffer
+	res, err := detectContext(ctx, &Config{TestsFiles: []string{f}, TrialsAllowed: 1}, 3, &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got: %v", err)
+	}
+	// no more tests are started
+	if len(res) != 1 || !res[0].Interrupted {
+		t.Errorf("got: %+v", res)
+	}
+	if !strings.Contains(out.String(), "./eth TestSync (interrupted)") {
+		t.Errorf("output:\n%s", out.String())
+	}
+	waitKilled(t, pidFile)
+}
@@ -0,0 +1,125 @@
+package schroedinger
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// discovering reports whether tests are to be discovered besides those
+// listed
+func (c *Config) discovering() bool {
+	return c.Discover != "" || c.DiscoverModules
+}
+
+// discoverTests returns the tests of the packages matching
+// Config.Discover, eg. './...', after the listed ones: every package with
+// test files which no listed test is of is run as a plain 'package' line
+// would be. The white and blacklists apply to them as to any other test.
+// With Config.DiscoverModules, the pattern is matched within every module
+// under the directory.
+func (c *Config) discoverTests(listed []*test) ([]*test, error) {
+	pkgs, err := c.discovered()
+	if err != nil {
+		return listed, err
+	}
+	have := make(map[string]bool)
+	for _, t := range listed {
+		have[filepath.Clean(t.pkg)] = true
+	}
+	tests := listed
+	for _, pkg := range pkgs {
+		if !have[filepath.Clean(pkg)] {
+			have[filepath.Clean(pkg)] = true
+			tests = append(tests, &test{pkg: pkg})
+		}
+	}
+	return tests, nil
+}
+
+// discovered returns the packages with tests matching Config.Discover,
+// relative to the working directory. They're listed with go list the first
+// time, which Validate does, and kept for loadTests after it.
+func (c *Config) discovered() ([]string, error) {
+	if c.discoveredPkgs != nil {
+		return c.discoveredPkgs, nil
+	}
+	dir := c.WorkDir
+	if dir == "" {
+		dir = "."
+	}
+	pattern := c.Discover
+	if pattern == "" {
+		pattern = "./..."
+	}
+	modules := []string{dir}
+	if c.DiscoverModules {
+		var err error
+		if modules, err = findModules(dir); err != nil {
+			return nil, fmt.Errorf("discover: %v", err)
+		}
+	}
+	// not nil, even if none are found, to tell that they were looked for
+	found := []string{}
+	for _, m := range modules {
+		pkgs, err := discoverPackages(c.goBinary(), m, pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range pkgs {
+			found = append(found, relativePackage(pkg, dir))
+		}
+	}
+	c.discoveredPkgs = found
+	return found, nil
+}
+
+// discoverPackages lists the directories of the packages matching pattern
+// in dir which have test files
+func discoverPackages(goBinary, dir, pattern string) ([]string, error) {
+	cmd := exec.Command(goBinary, "list", "-f", "{{if or .TestGoFiles .XTestGoFiles}}{{.Dir}}{{end}}", pattern)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("discover: go list %s in %s: %v: %s", pattern, dir, err, strings.TrimSpace(string(ee.Stderr)))
+		}
+		return nil, fmt.Errorf("discover: go list %s in %s: %v", pattern, dir, err)
+	}
+	var pkgs []string
+	for _, d := range strings.Split(string(out), "\n") {
+		if d = strings.TrimSpace(d); d != "" {
+			pkgs = append(pkgs, d)
+		}
+	}
+	return pkgs, nil
+}
+
+// findModules returns the directories under dir holding a go.mod, skipping
+// those the go command ignores too: vendor, testdata, and names starting
+// with . or _
+func findModules(dir string) ([]string, error) {
+	var modules []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			name := fi.Name()
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Name() == "go.mod" {
+			modules = append(modules, filepath.Dir(path))
+		}
+		return nil
+	})
+	if err == nil && len(modules) == 0 {
+		err = fmt.Errorf("no go.mod under %s", dir)
+	}
+	return modules, err
+}
@@ -0,0 +1,136 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go listing three packages with tests
+	fake := filepath.Join(dir, "go")
+	script := "#!/bin/sh\necho " + dir + "\necho " + filepath.Join(dir, "eth") + "\necho " + filepath.Join(dir, "p2p") + "\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	testsFile := filepath.Join(dir, "tests")
+	if err := ioutil.WriteFile(testsFile, []byte("./eth TestSync trials=5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{GoBinary: fake, WorkDir: dir, TestsFiles: []string{testsFile}, Discover: "./...", TrialsAllowed: 3}
+	tests, err := c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tt := range tests {
+		got = append(got, tt.String())
+	}
+	if want := []string{"./eth TestSync", ". ", "./p2p "}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("got: %q", got)
+	}
+
+	c = &Config{GoBinary: fake, WorkDir: dir, Discover: "./...", BlacklistMatch: "./p2p", TrialsAllowed: 3}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests, err = c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tests = filterTests(tests, c.selected); len(tests) != 2 || tests[1].pkg != "./eth" {
+		t.Errorf("got %d tests", len(tests))
+	}
+}
+
+func TestDiscoverModules(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	for _, mod := range []string{".", "tools", "tools/lint", "vendor/x", ".git/x", "_old", "tools/testdata"} {
+		if err := os.MkdirAll(filepath.Join(dir, mod), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, mod, "go.mod"), []byte("module x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a go listing the package of the directory it runs from, each its own
+	// module
+	fake := filepath.Join(dir, "go")
+	script := "#!/bin/sh\ncase $1 in\nlist) pwd;;\nenv) echo $(pwd)/go.mod;;\nesac\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Config{GoBinary: fake, WorkDir: dir, DiscoverModules: true, TrialsAllowed: 3}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests, err := c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tt := range tests {
+		goDir, goPkg := tt.goArgs()
+		got = append(got, tt.pkg+" "+goPkg+" "+goDir)
+	}
+	want := []string{
+		". . " + dir,
+		"./tools . " + filepath.Join(dir, "tools"),
+		"./tools/lint . " + filepath.Join(dir, "tools", "lint"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q\nwant: %q", got, want)
+	}
+
+	if _, err := findModules(filepath.Join(dir, "vendor")); err != nil {
+		t.Errorf("got: %v", err)
+	}
+	if _, err := findModules(t.TempDir()); err == nil {
+		t.Error("want error for no modules")
+	}
+}
+
+func TestDiscoverOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go counting its runs
+	fake := filepath.Join(dir, "go")
+	runs := filepath.Join(dir, "runs")
+	script := "#!/bin/sh\necho $1 >> " + runs + "\necho " + filepath.Join(dir, "eth") + "\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{GoBinary: fake, WorkDir: dir, Discover: "./...", TrialsAllowed: 3}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests, err := c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 1 || tests[0].pkg != "./eth" {
+		t.Errorf("got: %v", tests)
+	}
+	b, err := ioutil.ReadFile(runs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "list"); n != 1 {
+		t.Errorf("listed %d times, want once", n)
+	}
+}
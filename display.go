@@ -0,0 +1,180 @@
+package schroedinger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Color modes.
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiGray   = "\x1b[90m"
+)
+
+// where the output of trials and compact results go; stderr, as the log,
+// with Config.JSONSummary
+var stdout io.Writer = os.Stdout
+
+// compact, colored output of one line per test, instead of logging
+// every trial and its output
+var compact bool
+
+// setColor sets up compact output for the given color mode
+func setColor(mode string) error {
+	switch mode {
+	case "", ColorAuto:
+		compact = isTerminal(os.Stdout)
+	case ColorAlways:
+		compact = true
+	case ColorNever:
+		compact = false
+	default:
+		return fmt.Errorf("unknown color mode: %s", mode)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// testLog buffers what is logged about a test, and the reruns of a
+// package, to be written out in one block once it has finished;
+// see Config.OrderedOutput
+type testLog struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *testLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *testLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// logger returns the logger for what happens to t, which may be nil
+func (t *test) logger() Logger {
+	if t == nil {
+		return (*runLogger)(nil)
+	}
+	if t.ordered == nil {
+		return t.log
+	}
+	return log.New(t.ordered, log.Prefix(), log.Flags())
+}
+
+// logf logs about t whatever the output mode
+func (t *test) logf(format string, v ...interface{}) {
+	t.logger().Printf(format, v...)
+}
+
+func logTest(t *test) {
+	if !compact {
+		t.logger().Printf("%s", t)
+	}
+}
+
+func logTrialf(t *test, format string, v ...interface{}) {
+	if !compact {
+		t.logger().Printf(format, v...)
+	}
+}
+
+func logOutput(t *test, o []byte) {
+	if compact {
+		return
+	}
+	w := stdout
+	if t != nil && t.ordered != nil {
+		w = t.ordered
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, string(o))
+}
+
+// logFailure logs the output of a failed trial of t and records how it
+// failed on r; output the same as that of an earlier trial, but for the
+// numbers, is left out
+func logFailure(t *test, r *TestResult, o []byte, e error) {
+	if prev, seen := r.noteFailure(t, o, e); seen {
+		logTrialf(t, "  same failure as trial %d: %s", prev.Trial, prev.Signature)
+		return
+	}
+	logOutput(t, o)
+}
+
+// flushOrdered writes out the buffered log of a finished test in one block
+func flushOrdered(l Logger, r *TestResult) {
+	if r.ordered == nil {
+		return
+	}
+	label := strings.ToUpper(string(r.Outcome))
+	l.Printf("=== BEGIN %s\n%s=== END %s: %s (%d trials, %v)",
+		r, r.ordered, r, label, r.Trials, r.Duration.Round(time.Millisecond))
+}
+
+// printResult prints the one line status of a finished test in compact
+// mode, followed by the output of its last trial if it failed
+func printResult(r *TestResult) {
+	if !compact {
+		return
+	}
+	color := ansiGreen
+	switch r.Outcome {
+	case OutcomeFlaky:
+		color = ansiYellow
+	case OutcomeFail:
+		color = ansiRed
+	case OutcomeSkip, OutcomeResumed, OutcomeUnchanged, OutcomeStable:
+		color = ansiGray
+	}
+	label := strings.ToUpper(string(r.Outcome))
+	fmt.Fprintf(stdout, "%s%-7s%s %s %s(%d trials, %v)%s\n", color, label, ansiReset, r,
+		ansiGray, r.Trials, r.Duration.Round(time.Millisecond), ansiReset)
+	for _, rr := range r.Reruns {
+		fmt.Fprint(stdout, "  ")
+		printResult(rr)
+	}
+	if r.Outcome == OutcomeFail && len(r.Reruns) == 0 && len(r.output) > 0 {
+		fmt.Fprintln(stdout, string(r.output))
+	}
+}
+
+// logPanics logs the stacks of the panics in a failed test and its reruns,
+// which are more use than the rest of the output
+func logPanics(l Logger, r *TestResult) {
+	if r.Outcome != OutcomeFail {
+		return
+	}
+	if r.Panic != "" && len(r.Reruns) == 0 {
+		l.Printf("PANIC in %s %s:\n%s", r.Package, r.PanicIn, r.Panic)
+	}
+	for _, rr := range r.Reruns {
+		logPanics(l, rr)
+	}
+}
@@ -0,0 +1,37 @@
+package schroedinger
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestOrderedOutput(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	var out bytes.Buffer
+	log.SetOutput(&out)
+
+	tt := &test{pkg: "./eth", name: "TestSync", trials: 1, ordered: &testLog{}}
+	logTest(tt)
+	logTrialf(tt, "- FAIL %d", 1)
+	logOutput(tt, []byte("--- FAIL: TestSync"))
+	tt.logf("not retrying")
+	if out.Len() != 0 {
+		t.Fatalf("logged before the test finished: %s", out.String())
+	}
+
+	r := newTestResult(tt)
+	r.fail(tt, errors.New("FAIL ./eth TestSync"))
+	flushOrdered(log.Default(), r)
+	got := out.String()
+	for _, want := range []string{"=== BEGIN ./eth TestSync\n", "- FAIL 1", "--- FAIL: TestSync", "not retrying", "=== END ./eth TestSync: FAIL (1 trials"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, "BEGIN") > strings.Index(got, "- FAIL 1") {
+		t.Errorf("header after the log:\n%s", got)
+	}
+}
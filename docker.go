@@ -0,0 +1,120 @@
+package schroedinger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// Docker runs go test in a fresh container for every trial, rather than
+// on the host; see Config.Docker.
+type Docker struct {
+	// image to run, which must have go on its PATH, eg. golang:1.21
+	Image string
+	// further volumes, as given to docker run -v, eg. /srv/fixtures:/fixtures
+	Mounts []string
+	// environment variables, as given to docker run -e, eg. GOFLAGS=-mod=mod
+	Env []string
+}
+
+// the directory go test is run from is mounted here
+const dockerWorkDir = "/src"
+
+// numbers containers, to name them
+var dockerRuns uint64
+
+func (d *Docker) validate() error {
+	if d.Image == "" {
+		return errors.New("no image")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// args returns the docker run arguments to run go with args, eg. test
+// ./eth, in a container named name, if any, from dir mounted at
+// dockerWorkDir. The volumes are mounted at the same paths as on the host.
+func (d *Docker) args(name, dir string, args []string, volumes ...string) []string {
+	argv := []string{"run", "--rm"}
+	if name != "" {
+		argv = append(argv, "--name", name)
+	}
+	argv = append(argv, "-v", dir+":"+dockerWorkDir, "-w", dockerWorkDir)
+	for _, v := range volumes {
+		argv = append(argv, "-v", v+":"+v)
+	}
+	for _, m := range d.Mounts {
+		argv = append(argv, "-v", m)
+	}
+	for _, e := range d.Env {
+		argv = append(argv, "-e", e)
+	}
+	argv = append(argv, d.Image, "go")
+	return append(argv, args...)
+}
+
+// withEnv returns d with the environment variables vars set in the
+// container as well, eg. a test's env= options
+func (d *Docker) withEnv(vars []string) *Docker {
+	if d == nil || len(vars) == 0 {
+		return d
+	}
+	dd := *d
+	dd.Env = append(append([]string(nil), d.Env...), vars...)
+	return &dd
+}
+
+// command returns the command running go test with args from dir in a
+// container, and the name of the container
+func (d *Docker) command(t *test, dir string, args []string) (*exec.Cmd, string) {
+	abs, _ := filepath.Abs(dir)
+	name := fmt.Sprintf("schroedinger-%d-%d", os.Getpid(), atomic.AddUint64(&dockerRuns, 1))
+	var volumes []string
+	if t.coverDir != "" {
+		// for -coverprofile
+		volumes = append(volumes, t.coverDir)
+	}
+	argv := d.args(name, abs, args, volumes...)
+	logTrialf(t, "| docker %s", shellJoin(argv))
+	return exec.Command("docker", argv...), name
+}
+
+// commandLine returns a shell command line running go test with args from
+// dir in a container, as for a Repro
+func (d *Docker) commandLine(dir string, args []string) string {
+	abs, _ := filepath.Abs(dir)
+	return "docker " + shellJoin(d.args("", abs, args))
+}
+
+// dockerKill kills the container name, if it's still around; killing the
+// docker client, as an idle timeout does, leaves the container running
+func dockerKill(name string) {
+	exec.Command("docker", "kill", name).Run()
+}
+
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + strings.Replace(s, `"`, `\"`, -1) + `"`
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellJoin returns the command line of argv, quoting the arguments the
+// shell would take apart, as for a Repro or the logs
+func shellJoin(argv []string) string {
+	line := make([]string, len(argv))
+	for i, a := range argv {
+		if a == "" || strings.ContainsAny(a, " \t'\"$\\*?;&|<>()^%") {
+			a = shellQuote(a)
+		}
+		line[i] = a
+	}
+	return strings.Join(line, " ")
+}
@@ -0,0 +1,28 @@
+package schroedinger
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDockerArgs(t *testing.T) {
+	d := &Docker{Image: "golang:1.21", Mounts: []string{"/fixtures:/fixtures"}, Env: []string{"GOFLAGS=-mod=mod"}}
+	got := d.args("trial-1", "/repo", []string{"test", "./eth", "-v", "-run", "TestSync"}, "/tmp/cover")
+	want := []string{
+		"run", "--rm", "--name", "trial-1",
+		"-v", "/repo:/src", "-w", "/src",
+		"-v", "/tmp/cover:/tmp/cover",
+		"-v", "/fixtures:/fixtures",
+		"-e", "GOFLAGS=-mod=mod",
+		"golang:1.21", "go", "test", "./eth", "-v", "-run", "TestSync",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q\nwant: %q", got, want)
+	}
+
+	line := d.commandLine("/repo", []string{"test", "./eth", "-v", "-run", "^TestSync$/^fast$"})
+	wantLine := "docker run --rm -v /repo:/src -w /src -v /fixtures:/fixtures -e GOFLAGS=-mod=mod golang:1.21 go test ./eth -v -run '^TestSync$/^fast$'"
+	if line != wantLine {
+		t.Errorf("got: %s\nwant: %s", line, wantLine)
+	}
+}
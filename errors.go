@@ -0,0 +1,113 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by a run, so callers can tell why it failed with
+// errors.Is and errors.As. Any other error is one of the configuration,
+// the tests files or the environment, eg. a setup command failing.
+var (
+	// the white and blacklists and tags left no tests to run, with
+	// Config.FailOnNoMatch
+	ErrNoTestsMatched = errors.New("no tests match")
+
+	// the run was cut short by a deadline; it is context.DeadlineExceeded,
+	// so either matches
+	ErrDeadlineExceeded = context.DeadlineExceeded
+)
+
+// ErrBuildFailed is the error of a test whose package failed to build or
+// set up.
+type ErrBuildFailed struct {
+	Pkg string
+	Err error
+}
+
+func (e *ErrBuildFailed) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("FAIL %s: build failed", e.Pkg)
+}
+
+func (e *ErrBuildFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrTestsFailed is the error of tests which didn't pass within their
+// trials: a test, or the tests of a package which failed their reruns.
+type ErrTestsFailed struct {
+	Tests []string
+	Err   error
+}
+
+func (e *ErrTestsFailed) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return "FAIL " + strings.Join(e.Tests, ", ")
+}
+
+func (e *ErrTestsFailed) Unwrap() error {
+	return e.Err
+}
+
+// failedError is the error of a run which stopped after the given tests
+// failed, see Config.MaxFailures
+func failedError(failed []*TestResult) error {
+	var names []string
+	for _, r := range failed {
+		var tf *ErrTestsFailed
+		if errors.As(r.err, &tf) {
+			names = append(names, tf.Tests...)
+		} else {
+			names = append(names, r.String())
+		}
+	}
+	return &ErrTestsFailed{Tests: names, Err: fmt.Errorf("stopped after %d failed tests: %s", len(failed), strings.Join(names, ", "))}
+}
+
+// keepGoingError is the error of a run which went on past the given
+// failed tests, see Config.KeepGoing: that of the only one, or all of them
+// joined, so errors.As finds any of them
+func keepGoingError(failed []*TestResult) error {
+	if len(failed) == 1 {
+		return failed[0].err
+	}
+	errs := make([]error, len(failed))
+	for i, r := range failed {
+		errs[i] = r.err
+	}
+	return errors.Join(errs...)
+}
+
+// failError wraps the error e of the failed test r as an ErrBuildFailed or
+// ErrTestsFailed, unless a rerun of r already did
+func failError(r *TestResult, e error) error {
+	if r.BuildFailed {
+		return &ErrBuildFailed{Pkg: r.Package, Err: e}
+	}
+	var bf *ErrBuildFailed
+	if errors.As(e, &bf) {
+		return e
+	}
+	var failed []string
+	for _, rr := range r.Reruns {
+		if rr.Outcome == OutcomeFail {
+			failed = append(failed, rr.String())
+		}
+	}
+	if len(failed) == 0 {
+		failed = []string{r.String()}
+	}
+	var tf *ErrTestsFailed
+	if errors.As(e, &tf) {
+		// the error of a rerun, only the first of those failed
+		e = tf.Err
+	}
+	return &ErrTestsFailed{Tests: failed, Err: e}
+}
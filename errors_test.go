@@ -0,0 +1,49 @@
+package schroedinger
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFailError(t *testing.T) {
+	tt := &test{pkg: "./eth", name: "TestSync", trials: 1}
+	r := newTestResult(tt)
+	r.fail(tt, errors.New("FAIL ./eth TestSync"))
+	var tf *ErrTestsFailed
+	if !errors.As(r.err, &tf) || !reflect.DeepEqual(tf.Tests, []string{"./eth TestSync"}) {
+		t.Errorf("got: %#v", r.err)
+	}
+	if r.Error != "FAIL ./eth TestSync" || r.err.Error() != r.Error {
+		t.Errorf("got: %q, %q", r.Error, r.err)
+	}
+
+	// a package names its failed reruns
+	pt := &test{pkg: "./p2p", trials: 1}
+	p := newTestResult(pt)
+	p.Reruns = []*TestResult{{Package: "./p2p", Name: "TestDial", Outcome: OutcomePass}, r}
+	p.fail(pt, r.err)
+	if !errors.As(p.err, &tf) || !reflect.DeepEqual(tf.Tests, []string{"./eth TestSync"}) {
+		t.Errorf("got: %#v", p.err)
+	}
+
+	b := newTestResult(pt)
+	b.BuildFailed = true
+	b.fail(pt, errors.New("FAIL ./p2p: build failed"))
+	var bf *ErrBuildFailed
+	if !errors.As(b.err, &bf) || bf.Pkg != "./p2p" || errors.As(b.err, &tf) {
+		t.Errorf("got: %#v", b.err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	c := &Config{
+		TestsFiles:     []string{"./example.txt"},
+		WhitelistMatch: "nothing matches this",
+		TrialsAllowed:  1,
+		FailOnNoMatch:  true,
+	}
+	if _, err := run(c); !errors.Is(err, ErrNoTestsMatched) {
+		t.Errorf("got: %v, want: ErrNoTestsMatched", err)
+	}
+}
@@ -0,0 +1,97 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Types of Event.
+const (
+	EventTestStarted  = "test-started"
+	EventTrialDone    = "trial-finished"
+	EventTestFinished = "test-finished"
+	EventRunFinished  = "run-finished"
+)
+
+// Event is a line of the events file, written as things happen during a run.
+type Event struct {
+	// numbers events from 1 in the order they were written
+	Seq  int64     `json:"seq"`
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	Package string `json:"package,omitempty"`
+	Name    string `json:"name,omitempty"`
+
+	// trial number of a trial-finished event
+	Trial int `json:"trial,omitempty"`
+	// of a trial, of a test over all its trials, or of the run
+	Duration time.Duration `json:"duration,omitempty"`
+	// pass or fail for a trial, the test's outcome for a test
+	Outcome Outcome `json:"outcome,omitempty"`
+	Error   string  `json:"error,omitempty"`
+
+	// outcome counts of a run-finished event
+	Counts map[Outcome]int `json:"counts,omitempty"`
+}
+
+// eventLog writes events as JSON lines, straight to the file so it can be
+// followed during the run. All methods are safe to call on a nil *eventLog,
+// which does nothing, and from several goroutines.
+type eventLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	seq int64
+}
+
+func createEventLog(path string) (*eventLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *eventLog) write(e *Event) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seq++
+	e.Seq = l.seq
+	e.Time = time.Now()
+	// unbuffered, so every line is on disk as soon as it's encoded
+	l.enc.Encode(e)
+}
+
+func (l *eventLog) testStarted(t *test) {
+	l.write(&Event{Type: EventTestStarted, Package: t.pkg, Name: t.name})
+}
+
+func (l *eventLog) trialFinished(t *test, d time.Duration, err error) {
+	e := &Event{Type: EventTrialDone, Package: t.pkg, Name: t.name, Trial: t.trials, Duration: d, Outcome: OutcomePass}
+	if err != nil {
+		e.Outcome, e.Error = OutcomeFail, err.Error()
+	}
+	l.write(e)
+}
+
+func (l *eventLog) testFinished(r *TestResult) {
+	l.write(&Event{Type: EventTestFinished, Package: r.Package, Name: r.Name,
+		Duration: r.Duration, Outcome: r.Outcome, Error: r.Error})
+}
+
+func (l *eventLog) runFinished(r *Report) {
+	l.write(&Event{Type: EventRunFinished, Duration: r.Duration, Counts: r.Counts()})
+}
+
+func (l *eventLog) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
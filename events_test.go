@@ -0,0 +1,71 @@
+package schroedinger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.ndjson")
+
+	l, err := createEventLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := &test{pkg: "./eth", name: "TestSync", trials: 1}
+	l.testStarted(tt)
+	l.trialFinished(tt, time.Second, errors.New("exit status 1"))
+	tt.trials++
+	l.trialFinished(tt, time.Second, nil)
+	r := newTestResult(tt)
+	r.pass(tt)
+	l.testFinished(r)
+
+	// readable before the log is closed
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Event
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	l.close()
+
+	want := []struct {
+		typ     string
+		trial   int
+		outcome Outcome
+	}{
+		{EventTestStarted, 0, ""},
+		{EventTrialDone, 1, OutcomeFail},
+		{EventTrialDone, 2, OutcomePass},
+		{EventTestFinished, 0, OutcomeFlaky},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		e := got[i]
+		if e.Seq != int64(i+1) || e.Type != w.typ || e.Trial != w.trial || e.Outcome != w.outcome || e.Time.IsZero() {
+			t.Errorf("%d: got: %+v", i, e)
+		}
+	}
+}
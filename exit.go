@@ -0,0 +1,105 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exit codes returned by Run.
+const (
+	// all tests passed, possibly after retries
+	ExitOK = 0
+	// all tests passed, but some only after retries; only with FlakyFail,
+	// or with Config.FailUnder when too many did
+	ExitFlaky = 2
+	// some tests failed all their trials
+	ExitFailed = 3
+	// the configuration was bad, or a package failed to build
+	ExitError = 4
+	// the run was interrupted (SIGINT or SIGTERM), or cut short by a
+	// deadline (ErrDeadlineExceeded) or a cancelled context
+	ExitCancelled = 5
+)
+
+// FlakyPolicy is how tests which only passed after failing are treated.
+type FlakyPolicy string
+
+const (
+	// flaky tests pass, as any other
+	FlakyIgnore FlakyPolicy = "ignore"
+	// flaky tests pass, but are flagged in the log as they finish and
+	// listed again after the summary
+	FlakyWarn FlakyPolicy = "warn"
+	// as FlakyWarn, and the run exits with ExitFlaky rather than ExitOK
+	FlakyFail FlakyPolicy = "fail"
+)
+
+// flakyPolicy returns the policy in effect, taking ExitFlaky into account
+func (c *Config) flakyPolicy() FlakyPolicy {
+	if c.ExitFlaky {
+		return FlakyFail
+	}
+	if c.FlakyPolicy == "" {
+		return FlakyIgnore
+	}
+	return c.FlakyPolicy
+}
+
+// flakyNotice returns the line flagging the flaky tests of the report under
+// policy, after the summary, or "" if there is none
+func (r *Report) flakyNotice(policy FlakyPolicy) string {
+	var names []string
+	for _, t := range r.Tests {
+		if t.Outcome == OutcomeFlaky && !t.Quarantined {
+			names = append(names, t.String())
+		}
+	}
+	if policy == FlakyIgnore || len(names) == 0 {
+		return ""
+	}
+	label := "WARNING"
+	if policy == FlakyFail {
+		label = "FAIL"
+	}
+	return fmt.Sprintf("%s %d flaky tests passed only after failing: %s", label, len(names), strings.Join(names, ", "))
+}
+
+func exitCode(c *Config, report *Report, err error) int {
+	if report == nil {
+		return ExitError
+	}
+	if errors.Is(err, ErrDeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return ExitCancelled
+	}
+	var failed, flaky bool
+	for _, t := range report.Tests {
+		if t.Quarantined {
+			continue
+		}
+		if t.BuildFailed {
+			return ExitError
+		}
+		switch t.Outcome {
+		case OutcomeFail:
+			failed = true
+		case OutcomeFlaky:
+			flaky = true
+		}
+	}
+	if failed {
+		return ExitFailed
+	}
+	if err != nil {
+		// failed before any test did
+		return ExitError
+	}
+	if flaky && c.flakyPolicy() == FlakyFail {
+		return ExitFlaky
+	}
+	if c.FailUnder > 0 && report.FlakyRate() > c.FailUnder {
+		return ExitFlaky
+	}
+	return ExitOK
+}
@@ -0,0 +1,114 @@
+package schroedinger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExitCode(t *testing.T) {
+	pass := &TestResult{Outcome: OutcomePass}
+	flaky := &TestResult{Outcome: OutcomeFlaky}
+	fail := &TestResult{Outcome: OutcomeFail}
+	build := &TestResult{Outcome: OutcomeFail, BuildFailed: true}
+	quarantined := &TestResult{Outcome: OutcomeFail, BuildFailed: true, Quarantined: true}
+	errFail := errors.New("FAIL")
+
+	cases := []struct {
+		c      *Config
+		report *Report
+		err    error
+		want   int
+	}{
+		{&Config{}, nil, errFail, ExitError},
+		{&Config{}, &Report{}, errFail, ExitError},
+		{&Config{}, &Report{Tests: []*TestResult{pass, flaky}}, nil, ExitOK},
+		{&Config{ExitFlaky: true}, &Report{Tests: []*TestResult{pass, flaky}}, nil, ExitFlaky},
+		{&Config{ExitFlaky: true}, &Report{Tests: []*TestResult{flaky, fail}}, errFail, ExitFailed},
+		{&Config{}, &Report{Tests: []*TestResult{fail, build}}, errFail, ExitError},
+		{&Config{}, &Report{Tests: []*TestResult{pass}}, fmt.Errorf("run: %w", ErrDeadlineExceeded), ExitCancelled},
+		{&Config{FailUnder: 0.5}, &Report{Tests: []*TestResult{pass, flaky}}, nil, ExitOK},
+		{&Config{FailUnder: 0.4}, &Report{Tests: []*TestResult{pass, flaky}}, nil, ExitFlaky},
+		{&Config{FailUnder: 0.4}, &Report{Tests: []*TestResult{flaky, fail}}, errFail, ExitFailed},
+		{&Config{}, &Report{Tests: []*TestResult{pass, quarantined}}, nil, ExitOK},
+	}
+	for i, c := range cases {
+		if got := exitCode(c.c, c.report, c.err); got != c.want {
+			t.Errorf("%d: got: %d, want: %d", i, got, c.want)
+		}
+	}
+}
+
+func TestFlakyRate(t *testing.T) {
+	report := &Report{}
+	if rate := report.FlakyRate(); rate != 0 {
+		t.Errorf("empty: got: %v, want: 0", rate)
+	}
+	for _, o := range []Outcome{OutcomePass, OutcomePass, OutcomeFlaky, OutcomeFail, OutcomeSkip, OutcomeResumed, OutcomeUnchanged} {
+		report.Tests = append(report.Tests, &TestResult{Outcome: o})
+	}
+	if rate := report.FlakyRate(); rate != 0.25 {
+		t.Errorf("got: %v, want: 0.25", rate)
+	}
+}
+
+func TestWriteJSONSummary(t *testing.T) {
+	report := &Report{Duration: 1500 * time.Millisecond, Tests: []*TestResult{
+		{Outcome: OutcomePass},
+		{Outcome: OutcomeFlaky},
+		{Outcome: OutcomeSkip},
+		{Outcome: OutcomeResumed},
+		{Outcome: OutcomeUnchanged},
+		{Outcome: OutcomeUnchanged},
+		{Outcome: OutcomeStable},
+		{Outcome: OutcomeFail, Quarantined: true},
+	}}
+	var out bytes.Buffer
+	if err := writeJSONSummary(&out, report, ExitOK); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"passed":1,"flaky":1,"failed":0,"skipped":1,"resumed":1,"unchanged":2,"stable":1,"duration_ms":1500,"success":true}` + "\n"
+	if out.String() != want {
+		t.Errorf("got: %s, want: %s", out.String(), want)
+	}
+	out.Reset()
+	if err := writeJSONSummary(&out, nil, ExitError); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"success":false`) {
+		t.Errorf("got: %s", out.String())
+	}
+}
+
+func TestFlakyPolicy(t *testing.T) {
+	pass := &TestResult{Package: "./eth", Name: "TestSync", Outcome: OutcomePass}
+	flaky := &TestResult{Package: "./eth", Name: "TestFetch", Outcome: OutcomeFlaky}
+	quarantined := &TestResult{Package: "./les", Outcome: OutcomeFlaky, Quarantined: true}
+	report := &Report{Tests: []*TestResult{pass, flaky, quarantined}}
+	cases := []struct {
+		c      *Config
+		code   int
+		notice string
+	}{
+		{&Config{}, ExitOK, ""},
+		{&Config{FlakyPolicy: FlakyIgnore}, ExitOK, ""},
+		{&Config{FlakyPolicy: FlakyWarn}, ExitOK, "WARNING 1 flaky tests passed only after failing: ./eth TestFetch"},
+		{&Config{FlakyPolicy: FlakyFail}, ExitFlaky, "FAIL 1 flaky tests passed only after failing: ./eth TestFetch"},
+		{&Config{ExitFlaky: true}, ExitFlaky, "FAIL 1 flaky tests passed only after failing: ./eth TestFetch"},
+	}
+	for i, c := range cases {
+		if got := exitCode(c.c, report, nil); got != c.code {
+			t.Errorf("%d: code: got: %d, want: %d", i, got, c.code)
+		}
+		if got := report.flakyNotice(c.c.flakyPolicy()); got != c.notice {
+			t.Errorf("%d: notice: got: %q, want: %q", i, got, c.notice)
+		}
+	}
+	// nothing to flag without flaky tests
+	if got := (&Report{Tests: []*TestResult{pass, quarantined}}).flakyNotice(FlakyFail); got != "" {
+		t.Errorf("got: %q", got)
+	}
+}
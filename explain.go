@@ -0,0 +1,126 @@
+package schroedinger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Explain writes to w whether a run of c would run each test of its tests
+// files, and the rule which decided it, without running any. Tests are
+// listed in order, one tab-separated line each:
+//
+//	run	./eth TestSync	tests.txt:3	matches whitelist "eth"
+//	skip	./p2p TestDial	tests.txt:4	matches blacklist "p2p"
+//
+// A skipped test gives the first rule which left it out, in the order a
+// run applies them: the white and blacklists, tags, Config.RerunFrom,
+// Config.StateFile, Config.SkipStable, Config.ChangedSince and the shard. A test which runs
+// gives each rule which let it through, if any.
+func Explain(c *Config, w io.Writer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	tests, err := c.loadTests()
+	if err != nil {
+		return err
+	}
+	var prev *Report
+	if c.RerunFrom != "" {
+		if prev, err = ReadReport(c.RerunFrom); err != nil {
+			return err
+		}
+	}
+	var st *state
+	if c.StateFile != "" {
+		if st, err = readState(c.StateFile); err != nil {
+			return err
+		}
+	}
+	var stable *stableSet
+	if c.SkipStable != "" {
+		if stable, err = readStable(c.SkipStable); err != nil {
+			return err
+		}
+	}
+	var ch *changes
+	var chErr error
+	if c.ChangedSince != "" {
+		dir := c.WorkDir
+		if dir == "" {
+			dir = "."
+		}
+		ch, chErr = changedSince(dir, c.ChangedSince)
+	}
+
+	now := time.Now()
+	explain := func(t *test) (bool, []string) {
+		var why []string
+		add := func(reason string) {
+			if reason != "" {
+				why = append(why, reason)
+			}
+		}
+		ok, reason := matchList(t.pkg+" "+t.name, c.whites, c.blacks)
+		if !ok {
+			return false, []string{reason}
+		}
+		add(reason)
+		ok, reason = t.matchTags(c.TagsInclude, c.TagsExclude)
+		if !ok {
+			return false, []string{reason}
+		}
+		add(reason)
+		if prev != nil {
+			if !prev.unsettled(t) {
+				return false, []string{fmt.Sprintf("neither failed nor flaky in %s", c.RerunFrom)}
+			}
+			add(fmt.Sprintf("failed or flaky in %s", c.RerunFrom))
+		}
+		if st != nil && st.fresh(t, c.StateTTL, now) {
+			return false, []string{fmt.Sprintf("passed at %s, per %s", st.Passed[t.pkg+" "+t.name].Format(time.RFC3339), c.StateFile)}
+		}
+		if stable != nil && stable.stable(t) {
+			return false, []string{fmt.Sprintf("passed first try, package unchanged since, per %s", c.SkipStable)}
+		}
+		switch {
+		case c.ChangedSince == "":
+		case chErr != nil:
+			add(fmt.Sprintf("could not tell what changed since %s", c.ChangedSince))
+		case ch.all:
+			add(fmt.Sprintf("go.mod or go.sum changed since %s", c.ChangedSince))
+		case !ch.touched(t):
+			return false, []string{fmt.Sprintf("package unchanged since %s", c.ChangedSince)}
+		default:
+			add(fmt.Sprintf("package changed since %s", c.ChangedSince))
+		}
+		if c.ShardTotal > 1 {
+			if s := shardOf(t, c.ShardTotal); s != c.ShardIndex {
+				return false, []string{fmt.Sprintf("in shard %d/%d", s, c.ShardTotal)}
+			}
+			add(fmt.Sprintf("in shard %d/%d", c.ShardIndex, c.ShardTotal))
+		}
+		return true, why
+	}
+
+	cwd, _ := os.Getwd()
+	for _, t := range tests {
+		decision := "skip"
+		ok, why := explain(t)
+		if ok {
+			decision = "run"
+		}
+		if len(why) == 0 {
+			why = []string{"no filters"}
+		}
+		file := t.file
+		if rel, err := filepath.Rel(cwd, file); err == nil && !strings.HasPrefix(rel, "..") {
+			file = rel
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s:%d\t%s\n", decision, strings.TrimSpace(t.String()), file, t.line, strings.Join(why, "; "))
+	}
+	return nil
+}
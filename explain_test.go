@@ -0,0 +1,59 @@
+package schroedinger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	lines := []string{
+		`db cmd="true" tags=db`,
+		`slow cmd="true" tags=db,slow`,
+		`net cmd="true"`,
+		`eth cmd="true" tags=db`,
+	}
+	if err := ioutil.WriteFile(f, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		TestsFiles:     []string{f},
+		BlacklistMatch: "eth",
+		TagsExclude:    []string{"slow"},
+		TrialsAllowed:  1,
+	}
+	var out bytes.Buffer
+	if err := Explain(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		"run\tdb\t" + f + ":1\tno filters",
+		"skip\tslow\t" + f + ":2\ttagged excluded \"slow\"",
+		"run\tnet\t" + f + ":3\tno filters",
+		"skip\teth\t" + f + ":4\tmatches blacklist \"eth\"",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got: %q", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got: %q, want: %q", got[i], want[i])
+		}
+	}
+
+	c.TagsInclude = []string{"db"}
+	c.ShardTotal = 2
+	c.ShardIndex = shardOf(&test{pkg: "db"}, 2)
+	out.Reset()
+	if err := Explain(c, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "\tdb\t") || !strings.Contains(out.String(), "tagged included \"db\"") ||
+		!strings.Contains(out.String(), "tagged none of [\"db\"]") || !strings.Contains(out.String(), "in shard ") {
+		t.Errorf("got: %s", out.String())
+	}
+}
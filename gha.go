@@ -0,0 +1,113 @@
+package schroedinger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Output formats.
+const (
+	// the log, as usual
+	FormatText = "text"
+	// the log, plus GitHub Actions workflow commands annotating failed and
+	// flaky tests, and a job summary
+	FormatGitHub = "gha"
+)
+
+// the file and line a failure signature starts with, eg. 'sync_test.go:42: '
+var signatureFileLine = regexp.MustCompile(`^(\S+_test\.go):(\d+): `)
+
+// annotate writes an ::error workflow command for each test of r which
+// failed for good, and a ::warning for each which was flaky, pointing at
+// the file and line they failed at when known
+func annotate(w io.Writer, r *TestResult) {
+	if len(r.Reruns) > 0 {
+		for _, rr := range r.Reruns {
+			annotate(w, rr)
+		}
+		return
+	}
+	if r.Quarantined || len(r.Failures) == 0 {
+		return
+	}
+	var command, title, msg string
+	switch r.Outcome {
+	case OutcomeFail:
+		last := r.Failures[len(r.Failures)-1]
+		command, title = "error", "FAIL "+r.String()
+		msg = fmt.Sprintf("failed all %d trials: %s", r.Trials, last.Signature)
+	case OutcomeFlaky:
+		command, title = "warning", "FLAKY "+r.String()
+		msg = fmt.Sprintf("passed on trial %d, after failing: %s", r.Trials, r.Failures[0].Signature)
+	default:
+		return
+	}
+	props := "title=" + escapeProperty(title)
+	if m := signatureFileLine.FindStringSubmatch(r.Failures[len(r.Failures)-1].Signature); m != nil && strings.HasPrefix(r.Package, ".") {
+		file := path.Join(strings.TrimSuffix(r.Package, "/..."), m[1])
+		props = fmt.Sprintf("file=%s,line=%s,%s", escapeProperty(file), m[2], props)
+	}
+	fmt.Fprintf(w, "::%s %s::%s\n", command, props, escapeData(msg))
+}
+
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeGitHubSummary appends the summary of the run, and the tables of its
+// failed and flaky tests, to the job summary at path, as Markdown
+func (r *Report) writeGitHubSummary(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	r.writeMarkdownSummary(f)
+	return f.Close()
+}
+
+func (r *Report) writeMarkdownSummary(w io.Writer) {
+	counts := r.Counts()
+	fmt.Fprintf(w, "### schroedinger: %d passed, %d flaky, %d failed, %d skipped\n\n",
+		counts[OutcomePass], counts[OutcomeFlaky], counts[OutcomeFail], counts[OutcomeSkip])
+	if r.Error != "" {
+		fmt.Fprintf(w, "**%s**\n\n", markdownCell(r.Error))
+	}
+	for _, section := range []struct {
+		outcome Outcome
+		heading string
+	}{{OutcomeFail, "Failed"}, {OutcomeFlaky, "Flaky"}} {
+		var rows []string
+		var add func(t *TestResult)
+		add = func(t *TestResult) {
+			if len(t.Reruns) > 0 {
+				for _, rt := range t.Reruns {
+					add(rt)
+				}
+				return
+			}
+			if t.Outcome != section.outcome || t.Quarantined || len(t.Failures) == 0 {
+				return
+			}
+			rows = append(rows, fmt.Sprintf("| `%s` | %d | %s |", t, t.Trials, markdownCell(t.Failures[len(t.Failures)-1].Signature)))
+		}
+		for _, t := range r.Tests {
+			add(t)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "#### %s\n\n| Test | Trials | Last failure |\n| --- | --- | --- |\n%s\n\n", section.heading, strings.Join(rows, "\n"))
+	}
+}
+
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,41 @@
+package schroedinger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAnnotate(t *testing.T) {
+	var b bytes.Buffer
+	annotate(&b, &TestResult{Package: "./eth", Outcome: OutcomeFail, Trials: 3, Reruns: []*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomeFail, Trials: 3, Failures: []TrialFailure{{1, "sync_test.go:42: got N peers"}}},
+		{Package: "./eth", Name: "TestFetch", Outcome: OutcomeFlaky, Trials: 2, Failures: []TrialFailure{{1, "panic: boom, 50% of the time"}}},
+		{Package: "./eth", Name: "TestPeer", Outcome: OutcomePass, Trials: 1},
+	}})
+	annotate(&b, &TestResult{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFail, Quarantined: true, Failures: []TrialFailure{{1, "failed"}}})
+	want := "::error file=eth/sync_test.go,line=42,title=FAIL ./eth TestSync::failed all 3 trials: sync_test.go:42: got N peers\n" +
+		"::warning title=FLAKY ./eth TestFetch::passed on trial 2, after failing: panic: boom, 50%25 of the time\n"
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestMarkdownSummary(t *testing.T) {
+	report := &Report{Tests: []*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomeFail, Trials: 3, Failures: []TrialFailure{{3, "sync_test.go:42: a | b"}}},
+		{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFlaky, Trials: 2, Failures: []TrialFailure{{1, "failed"}}},
+		{Package: "./core", Outcome: OutcomePass, Trials: 1},
+	}}
+	var b bytes.Buffer
+	report.writeMarkdownSummary(&b)
+	for _, want := range []string{
+		"### schroedinger: 1 passed, 1 flaky, 1 failed, 0 skipped\n",
+		"#### Failed\n\n| Test | Trials | Last failure |\n| --- | --- | --- |\n| `./eth TestSync` | 3 | sync_test.go:42: a \\| b |\n",
+		"#### Flaky\n\n| Test | Trials | Last failure |\n| --- | --- | --- |\n| `./p2p TestDial` | 2 | failed |\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+}
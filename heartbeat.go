@@ -0,0 +1,113 @@
+package schroedinger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progress tracks which tests are queued, running and done.
+// All methods are safe to call concurrently.
+type progress struct {
+	mu      sync.Mutex
+	queued  int
+	done    int
+	running map[string]time.Time
+	// the latest trial started by each running test
+	trials map[string]currentTrial
+	counts map[Outcome]int
+	// the results of the tests done, by key
+	results map[string]*TestResult
+	// what the heartbeat logs to
+	log *runLogger
+}
+
+type currentTrial struct {
+	trial int
+	// the failing test of a package being rerun, if any
+	rerun string
+}
+
+func newProgress(queued int, l *runLogger) *progress {
+	return &progress{
+		log:     l,
+		queued:  queued,
+		running: make(map[string]time.Time),
+		trials:  make(map[string]currentTrial),
+		counts:  make(map[Outcome]int),
+		results: make(map[string]*TestResult),
+	}
+}
+
+// started is called once a test gets a slot in the pool
+func (p *progress) started(t *test, now time.Time) {
+	p.mu.Lock()
+	p.queued--
+	p.running[t.pkg+" "+t.name] = now
+	p.mu.Unlock()
+}
+
+func (p *progress) finished(r *TestResult) {
+	p.mu.Lock()
+	p.done++
+	key := r.Package + " " + r.Name
+	delete(p.running, key)
+	delete(p.trials, key)
+	p.counts[r.Outcome]++
+	p.results[key] = r
+	p.mu.Unlock()
+}
+
+// status summarizes progress, listing up to n of the longest running tests
+func (p *progress) status(now time.Time, n int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	type running struct {
+		name  string
+		since time.Time
+	}
+	var rs []running
+	for name, since := range p.running {
+		rs = append(rs, running{name, since})
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		if !rs[i].since.Equal(rs[j].since) {
+			return rs[i].since.Before(rs[j].since)
+		}
+		return rs[i].name < rs[j].name
+	})
+	s := fmt.Sprintf("running: %d, queued: %d, done: %d", len(rs), p.queued, p.done)
+	if len(rs) > n {
+		rs = rs[:n]
+	}
+	var longest []string
+	for _, r := range rs {
+		longest = append(longest, fmt.Sprintf("%s (%v)", strings.TrimSpace(r.name), now.Sub(r.since).Round(time.Second)))
+	}
+	if len(longest) > 0 {
+		s += "; longest: " + strings.Join(longest, ", ")
+	}
+	return s
+}
+
+// heartbeat logs the status every interval until the returned func is called
+func (p *progress) heartbeat(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				p.log.Printf("HEARTBEAT %s", p.status(now, 3))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
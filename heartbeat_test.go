@@ -0,0 +1,21 @@
+package schroedinger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressStatus(t *testing.T) {
+	now := time.Now()
+	p := newProgress(5, nil)
+	p.started(&test{pkg: "./eth", name: "TestSync"}, now.Add(-3*time.Minute))
+	p.started(&test{pkg: "./p2p"}, now.Add(-time.Minute))
+	p.started(&test{pkg: "./les", name: "TestOdr"}, now.Add(-2*time.Minute))
+	p.started(&test{pkg: "./core"}, now.Add(-4*time.Minute))
+	p.finished(&TestResult{Package: "./core"})
+
+	want := "running: 3, queued: 1, done: 1; longest: ./eth TestSync (3m0s), ./les TestOdr (2m0s)"
+	if got := p.status(now, 2); got != want {
+		t.Errorf("got: %s\nwant: %s", got, want)
+	}
+}
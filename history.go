@@ -0,0 +1,305 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyDecay weighs each run before the latest this much less than the
+// run after it, so a test's score follows how it has behaved lately
+const historyDecay = 0.9
+
+// most flaky tests to log at the end of a run
+const historyTop = 10
+
+// history keeps the outcomes of tests over many runs, to tell which are
+// chronically flaky rather than flaky once.
+type history struct {
+	// oldest first
+	Runs []historyRun `json:"runs"`
+}
+
+type historyRun struct {
+	Start time.Time `json:"start"`
+	// keyed by package and name
+	Outcomes map[string]Outcome `json:"outcomes"`
+	// how the tests went, keyed as Outcomes; missing from older files
+	Tests map[string]historyTest `json:"tests,omitempty"`
+}
+
+// historyTest is how a test went in a recorded run
+type historyTest struct {
+	Trials   int           `json:"trials"`
+	Duration time.Duration `json:"duration"`
+	// signatures of its failed trials, in order
+	Failures []string `json:"failures,omitempty"`
+}
+
+// flakyScore is how often a test flaked or failed over the recorded runs,
+// from 0 to 1, with recent runs weighing most
+type flakyScore struct {
+	Test  string
+	Score float64
+	// runs the test ran in, and flaked or failed in
+	Runs   int
+	Flakes int
+}
+
+// readHistory reads the history file at path. A missing file is an empty history.
+func readHistory(path string) (*history, error) {
+	h := &history{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// add records the outcomes of the tests run in a report. The failing tests
+// found in a package are recorded rather than the package, and tests which
+// didn't run aren't recorded.
+func (h *history) add(r *Report) {
+	run := historyRun{Start: r.Start, Outcomes: make(map[string]Outcome), Tests: make(map[string]historyTest)}
+	var add func(*TestResult)
+	add = func(t *TestResult) {
+		if len(t.Reruns) > 0 {
+			for _, rr := range t.Reruns {
+				add(rr)
+			}
+			return
+		}
+		switch t.Outcome {
+		case OutcomePass, OutcomeFlaky, OutcomeFail:
+			key := t.Package + " " + t.Name
+			run.Outcomes[key] = t.Outcome
+			ht := historyTest{Trials: t.Trials, Duration: t.Duration}
+			for _, f := range t.Failures {
+				ht.Failures = append(ht.Failures, f.Signature)
+			}
+			run.Tests[key] = ht
+		}
+	}
+	for _, t := range r.Tests {
+		add(t)
+	}
+	h.Runs = append(h.Runs, run)
+}
+
+// prune keeps only the last keep runs, if keep is set, and the runs
+// within maxAge of now, if maxAge is set
+func (h *history) prune(keep int, maxAge time.Duration, now time.Time) {
+	if keep > 0 && len(h.Runs) > keep {
+		h.Runs = h.Runs[len(h.Runs)-keep:]
+	}
+	if maxAge > 0 {
+		i := 0
+		for i < len(h.Runs) && now.Sub(h.Runs[i].Start) > maxAge {
+			i++
+		}
+		h.Runs = h.Runs[i:]
+	}
+}
+
+// scores returns the tests which flaked or failed in any recorded run,
+// most flaky first
+func (h *history) scores() []flakyScore {
+	type acc struct {
+		flaky, total float64
+		runs, flakes int
+	}
+	accs := make(map[string]*acc)
+	w := 1.0
+	for i := len(h.Runs) - 1; i >= 0; i-- {
+		for test, o := range h.Runs[i].Outcomes {
+			a, ok := accs[test]
+			if !ok {
+				a = &acc{}
+				accs[test] = a
+			}
+			a.total += w
+			a.runs++
+			if o != OutcomePass {
+				a.flaky += w
+				a.flakes++
+			}
+		}
+		w *= historyDecay
+	}
+	var scores []flakyScore
+	for test, a := range accs {
+		if a.flakes > 0 {
+			scores = append(scores, flakyScore{test, a.flaky / a.total, a.runs, a.flakes})
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Test < scores[j].Test
+	})
+	return scores
+}
+
+// updateHistory adds the run to the history file, prunes it and logs the
+// most flaky tests
+func updateHistory(c *Config, r *Report) error {
+	h, err := readHistory(c.HistoryFile)
+	if err != nil {
+		return err
+	}
+	h.add(r)
+	h.prune(c.HistoryRuns, c.HistoryMaxAge, time.Now())
+	if err := h.write(c.HistoryFile); err != nil {
+		return err
+	}
+	scores := h.scores()
+	if len(scores) > historyTop {
+		scores = scores[:historyTop]
+	}
+	if len(scores) > 0 {
+		c.logf("MOST FLAKY over the last %d runs:", len(h.Runs))
+	}
+	for _, s := range scores {
+		c.logf("  %.2f %s (flaked or failed %d/%d runs)", s.Score, s.Test, s.Flakes, s.Runs)
+	}
+	return nil
+}
+
+func (h *history) write(path string) error {
+	b, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// most recent runs charted by ShowHistory
+const historyChart = 40
+
+// ShowHistory writes the trends of the history file at path to w. Without
+// a pattern, it lists the tests which flaked or failed in any recorded run,
+// most flaky first, each with a chart of its outcomes over the latest runs
+// and how often it flaked or failed in the earlier and the later half of
+// them, to tell whether it's getting flakier. With a pattern, it lists
+// every recorded run of the tests matching it instead: when, the outcome,
+// trials, duration and the signatures of its failed trials.
+func ShowHistory(path, pattern string, w io.Writer) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	h, err := readHistory(path)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if pattern != "" {
+		return h.showRuns(pattern, w)
+	}
+	fmt.Fprintf(w, "HISTORY %d runs", len(h.Runs))
+	if len(h.Runs) > 0 {
+		fmt.Fprintf(w, ", %s to %s", h.Runs[0].Start.Format("2006-01-02"), h.Runs[len(h.Runs)-1].Start.Format("2006-01-02"))
+	}
+	fmt.Fprintln(w)
+	runs := h.Runs
+	if len(runs) > historyChart {
+		runs = runs[len(runs)-historyChart:]
+	}
+	for _, sc := range h.scores() {
+		earlier, later := h.halves(sc.Test)
+		fmt.Fprintf(w, "%.2f %-*s earlier %s, later %s  %s\n", sc.Score, len(runs), chartOutcomes(runs, sc.Test), earlier, later, sc.Test)
+	}
+	return nil
+}
+
+// chartOutcomes charts the outcomes of test over runs, oldest first: '.'
+// passed, 'f' flaky, 'F' failed, ' ' not run
+func chartOutcomes(runs []historyRun, test string) string {
+	var b strings.Builder
+	for _, r := range runs {
+		switch r.Outcomes[test] {
+		case OutcomePass:
+			b.WriteByte('.')
+		case OutcomeFlaky:
+			b.WriteByte('f')
+		case OutcomeFail:
+			b.WriteByte('F')
+		default:
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// halves returns how often test flaked or failed in the earlier and the
+// later half of the runs it ran in, eg. '2/10'
+func (h *history) halves(test string) (string, string) {
+	var outcomes []Outcome
+	for _, r := range h.Runs {
+		if o, ok := r.Outcomes[test]; ok {
+			outcomes = append(outcomes, o)
+		}
+	}
+	count := func(outs []Outcome) string {
+		k := 0
+		for _, o := range outs {
+			if o != OutcomePass {
+				k++
+			}
+		}
+		return fmt.Sprintf("%d/%d", k, len(outs))
+	}
+	mid := len(outcomes) / 2
+	return count(outcomes[:mid]), count(outcomes[mid:])
+}
+
+// showRuns writes every recorded run of the tests matching pattern
+func (h *history) showRuns(pattern string, w io.Writer) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("bad test pattern: %v", err)
+	}
+	var tests []string
+	seen := make(map[string]bool)
+	for _, r := range h.Runs {
+		for test := range r.Outcomes {
+			if !seen[test] && re.MatchString(test) {
+				seen[test] = true
+				tests = append(tests, test)
+			}
+		}
+	}
+	if len(tests) == 0 {
+		return fmt.Errorf("no test matching %q in the history", pattern)
+	}
+	sort.Strings(tests)
+	for _, test := range tests {
+		fmt.Fprintln(w, test)
+		for _, r := range h.Runs {
+			o, ok := r.Outcomes[test]
+			if !ok {
+				continue
+			}
+			line := fmt.Sprintf("  %s %-5s", r.Start.Format("2006-01-02 15:04"), o)
+			if ht, ok := r.Tests[test]; ok {
+				line += fmt.Sprintf(" %d trials, %v", ht.Trials, ht.Duration.Round(time.Millisecond))
+				if len(ht.Failures) > 0 {
+					line += ": " + strings.Join(ht.Failures, "; ")
+				}
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	return nil
+}
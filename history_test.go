@@ -0,0 +1,128 @@
+package schroedinger
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+
+	start := time.Now().Add(-time.Hour)
+	outcomes := [][]Outcome{
+		// ./eth TestSync, ./p2p TestDial
+		{OutcomeFlaky, OutcomePass},
+		{OutcomePass, OutcomePass},
+		{OutcomePass, OutcomeFail},
+	}
+	for i, o := range outcomes {
+		h, err := readHistory(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := newReport(nil, nil, nil, 3)
+		r.Start = start.Add(time.Duration(i) * time.Minute)
+		r.Tests = []*TestResult{
+			{Package: "./eth", Name: "TestSync", Outcome: o[0]},
+			// a package, recorded by its reruns
+			{Package: "./p2p/...", Outcome: o[1], Reruns: []*TestResult{
+				{Package: "./p2p", Name: "TestDial", Outcome: o[1]},
+			}},
+			{Package: "./les", Outcome: OutcomeSkip},
+		}
+		if o[1] == OutcomePass {
+			r.Tests[1] = &TestResult{Package: "./p2p", Name: "TestDial", Outcome: OutcomePass}
+		}
+		h.add(r)
+		if err := h.write(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(h.Runs))
+	}
+	scores := h.scores()
+	if len(scores) != 2 {
+		t.Fatalf("got: %+v, want 2 scores", scores)
+	}
+	// the latest failure weighs more than the oldest flake
+	if scores[0].Test != "./p2p TestDial" || scores[1].Test != "./eth TestSync" {
+		t.Errorf("got: %+v", scores)
+	}
+	total := 1 + historyDecay + historyDecay*historyDecay
+	if want := 1 / total; math.Abs(scores[0].Score-want) > 1e-9 || scores[0].Runs != 3 || scores[0].Flakes != 1 {
+		t.Errorf("got: %+v, want score %v", scores[0], want)
+	}
+	if want := historyDecay * historyDecay / total; math.Abs(scores[1].Score-want) > 1e-9 {
+		t.Errorf("got: %+v, want score %v", scores[1], want)
+	}
+
+	h.prune(2, 0, time.Now())
+	if len(h.Runs) != 2 || !h.Runs[0].Start.Equal(start.Add(time.Minute)) {
+		t.Errorf("got: %+v, want the last 2 runs", h.Runs)
+	}
+	h.prune(0, time.Hour-90*time.Second, time.Now())
+	if len(h.Runs) != 1 {
+		t.Errorf("got: %+v, want the last run", h.Runs)
+	}
+}
+
+func TestShowHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	h := &history{}
+	for i, o := range []Outcome{OutcomePass, OutcomePass, OutcomeFlaky, OutcomeFail} {
+		r := newReport(nil, nil, nil, 3)
+		r.Start = start.Add(time.Duration(i) * time.Hour)
+		r.Tests = []*TestResult{
+			{Package: "./eth", Name: "TestSync", Outcome: o, Trials: 2, Duration: time.Second,
+				Failures: []TrialFailure{{1, "panic: boom"}}},
+			{Package: "./p2p", Name: "TestDial", Outcome: OutcomePass, Trials: 1},
+		}
+		if i == 0 {
+			r.Tests = r.Tests[1:]
+		}
+		h.add(r)
+	}
+	if err := h.write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := ShowHistory(path, "", &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "HISTORY 4 runs, 2026-10-01 to 2026-10-01\n" +
+		"0.70  .fF earlier 0/1, later 2/2  ./eth TestSync\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := ShowHistory(path, "Sync$", &out); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 4 || lines[0] != "./eth TestSync" ||
+		lines[3] != "  2026-10-01 15:00 fail  2 trials, 1s: panic: boom" {
+		t.Errorf("got:\n%s", out.String())
+	}
+	if err := ShowHistory(path, "TestServe", &out); err == nil {
+		t.Error("no error for no matching test")
+	}
+}
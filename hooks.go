@@ -0,0 +1,74 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// HookResult records how a setup or teardown command went.
+type HookResult struct {
+	Command  string        `json:"command"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// how long the teardown commands get to run once the run was stopped
+var teardownGrace = 30 * time.Second
+
+// runHook runs a shell command from dir until it's done or ctx is. Whatever
+// it left running in the background is killed along with it.
+func (c *Config) runHook(ctx context.Context, kind, command, dir string) (*HookResult, error) {
+	c.logf("%s %s", kind, command)
+	cmd := exec.Command(commandPrefix[0], commandPrefix[1], command)
+	cmd.Dir = dir
+	start := time.Now()
+	o, err := combinedOutput(ctx, cmd, 0, 0)
+	killProcessGroup(cmd)
+	r := &HookResult{Command: command, Duration: time.Since(start), Output: string(o)}
+	if err != nil {
+		r.Error = err.Error()
+		c.logf("%s FAILED (%v): %s: %v\n%s", kind, r.Duration, command, err, o)
+		return r, fmt.Errorf("%s %s: %w", kind, command, err)
+	}
+	c.logf("- done (%v)", r.Duration)
+	return r, nil
+}
+
+// setUp runs the setup commands of the run in order, stopping at the first
+// which fails or once ctx is done, and returns how to tear down again.
+// Tearing down runs every teardown command, whether or not setup succeeded,
+// and only once however often it's called; once ctx is done, they get
+// teardownGrace longer to run.
+func setUp(ctx context.Context, c *Config, report *Report) (teardown func(), err error) {
+	var once sync.Once
+	teardown = func() {
+		once.Do(func() {
+			tctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+			defer cancel()
+			defer context.AfterFunc(ctx, func() { time.AfterFunc(teardownGrace, cancel) })()
+			var errs []error
+			for _, command := range c.Teardown {
+				r, err := c.runHook(tctx, "TEARDOWN", command, c.WorkDir)
+				report.Teardown = append(report.Teardown, r)
+				errs = append(errs, err)
+			}
+			if err := errors.Join(errs...); err != nil {
+				c.logln("WARNING teardown failed:", err)
+			}
+		})
+	}
+
+	for _, command := range c.Setup {
+		r, err := c.runHook(ctx, "SETUP", command, c.WorkDir)
+		report.Setup = append(report.Setup, r)
+		if err != nil {
+			return teardown, err
+		}
+	}
+	return teardown, nil
+}
@@ -0,0 +1,147 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetupTeardown(t *testing.T) {
+	c := &Config{
+		TestsFiles:     []string{"./example.txt"},
+		WhitelistMatch: "Dog",
+		TrialsAllowed:  1,
+		Setup:          []string{"echo up", "exit 3", "echo never"},
+		Teardown:       []string{"exit 1", "echo down"},
+	}
+	report, err := run(c)
+	if err == nil || !strings.Contains(err.Error(), "SETUP exit 3") {
+		t.Errorf("got: %v, want failed setup", err)
+	}
+	if len(report.Setup) != 2 || strings.TrimSpace(report.Setup[0].Output) != "up" || report.Setup[1].Error == "" {
+		t.Errorf("got setup: %+v", report.Setup)
+	}
+	// every teardown command runs, even after a failed setup
+	if len(report.Teardown) != 2 || report.Teardown[0].Error == "" || strings.TrimSpace(report.Teardown[1].Output) != "down" {
+		t.Errorf("got teardown: %+v", report.Teardown)
+	}
+
+	c.Setup = []string{"echo up"}
+	report, err = run(c)
+	if err != nil || len(report.Setup) != 1 || len(report.Teardown) != 2 {
+		t.Errorf("got: %v, setup: %+v, teardown: %+v", err, report.Setup, report.Teardown)
+	}
+}
+
+func TestBeforeAfterHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// before fails the first trial only
+	tt, err := handleLine(`hooked cmd="true" before="test -f ready || { touch ready; exit 1; }" after="echo >> afters"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.dir, tt.trialsAllowed = dir, 3
+	c := make(chan *TestResult, 1)
+	tryTest(tt, c)
+	r := <-c
+	if r.Outcome != OutcomeFlaky || r.Trials != 2 {
+		t.Errorf("got: %s after %d trials, want: flaky after 2", r.Outcome, r.Trials)
+	}
+	afters, err := ioutil.ReadFile(filepath.Join(dir, "afters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(afters), "\n"); n != 2 {
+		t.Errorf("after ran %d times, want 2", n)
+	}
+
+	// a package whose before always fails isn't run at all
+	tt = &test{pkg: "./nowhere", dir: dir, trialsAllowed: 2, before: "exit 1"}
+	tryTest(tt, c)
+	r = <-c
+	if r.Outcome != OutcomeFail || r.Trials != 2 || !strings.Contains(r.Error, "before hook") {
+		t.Errorf("got: %+v", r)
+	}
+}
+
+func TestHooksStopped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	defer func(d time.Duration) { teardownGrace = d }(teardownGrace)
+	teardownGrace = 200 * time.Millisecond
+
+	// setup stops with the run, and teardown still runs, for a while
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	c := &Config{Setup: []string{"sleep 10"}, Teardown: []string{"echo down", "sleep 10"}}
+	report := &Report{}
+	start := time.Now()
+	teardown, err := setUp(ctx, c, report)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got: %v, want setup stopped", err)
+	}
+	teardown()
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v", d)
+	}
+	if len(report.Teardown) != 2 || strings.TrimSpace(report.Teardown[0].Output) != "down" || report.Teardown[1].Error == "" {
+		t.Errorf("got teardown: %+v", report.Teardown)
+	}
+}
+
+func TestHookKillsBackground(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses /proc")
+	}
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	c := &Config{}
+	if _, err := c.runHook(context.Background(), "SETUP", "sleep 30 >/dev/null 2>&1 & echo $! > "+pidFile, ""); err != nil {
+		t.Fatal(err)
+	}
+	waitKilled(t, pidFile)
+}
+
+func TestSetupFirst(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go noting each of its runs in the same log as the setup
+	calls := filepath.Join(dir, "calls")
+	fake := filepath.Join(dir, "go")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\necho go $1 >> "+calls+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := goExecutablePath
+	defer func() { goExecutablePath = p }()
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, GoBinary: fake, WorkDir: dir, TrialsAllowed: 1, GoTestJSON: true,
+		Precompile: true, Setup: []string{"echo setup >> " + calls}}
+	run(c)
+	b, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) < 2 || lines[0] != "setup" {
+		t.Errorf("got calls: %q, want setup first", lines)
+	}
+}
@@ -0,0 +1,115 @@
+package schroedinger
+
+import (
+	"html/template"
+	"io"
+	"os"
+	"time"
+)
+
+// htmlTest is a test as the HTML report shows it
+type htmlTest struct {
+	Name     string
+	Outcome  Outcome
+	Duration time.Duration
+	Trials   []htmlTrial
+	Reruns   []htmlTest
+}
+
+// htmlTrial is a trial of a test, with its output if it was kept: that of
+// every failed trial, and of the last
+type htmlTrial struct {
+	N         int
+	Failed    bool
+	Duration  time.Duration
+	Signature string
+	Output    string
+}
+
+func newHTMLTest(r *TestResult) htmlTest {
+	t := htmlTest{Name: r.String(), Outcome: r.Outcome, Duration: r.Duration.Round(time.Millisecond)}
+	failed := make(map[int]int)
+	for i, f := range r.Failures {
+		failed[f.Trial] = i
+	}
+	for i, d := range r.TrialDurations {
+		trial := htmlTrial{N: i + 1, Duration: d.Round(time.Millisecond)}
+		if fi, ok := failed[trial.N]; ok {
+			trial.Failed = true
+			trial.Signature = r.Failures[fi].Signature
+			if fi < len(r.failureOutputs) {
+				trial.Output = string(r.failureOutputs[fi])
+			}
+		} else if trial.N == len(r.TrialDurations) {
+			trial.Output = string(r.output)
+		}
+		t.Trials = append(t.Trials, trial)
+	}
+	for _, rr := range r.Reruns {
+		t.Reruns = append(t.Reruns, newHTMLTest(rr))
+	}
+	return t
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>schroedinger {{.Start.Format "2006-01-02 15:04:05"}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+summary { cursor: pointer; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; max-height: 40em; }
+.test { margin: .3em 0; }
+.trials, .reruns { margin-left: 2em; }
+.pass { color: #1a7f37; } .flaky { color: #9a6700; } .fail { color: #cf222e; }
+.skip, .resumed, .unchanged, .stable, .quiet { color: #6e7781; }
+</style>
+</head>
+<body>
+<h1>schroedinger</h1>
+<p>{{.Summary}}</p>
+<p class="quiet">started {{.Start.Format "2006-01-02 15:04:05 MST"}}, took {{.Duration}}{{if .Error}}; <span class="fail">{{.Error}}</span>{{end}}</p>
+{{range .Tests}}{{template "test" .}}{{end}}
+</body>
+</html>
+{{define "test"}}<details class="test"{{if eq .Outcome "fail"}} open{{end}}>
+<summary><b class="{{.Outcome}}">{{.Outcome}}</b> {{.Name}} <span class="quiet">({{len .Trials}} trials, {{.Duration}})</span></summary>
+<div class="trials">{{range .Trials}}
+<details>
+<summary>trial {{.N}}: {{if .Failed}}<span class="fail">fail</span> {{.Signature}}{{else}}<span class="pass">ok</span>{{end}} <span class="quiet">({{.Duration}})</span></summary>
+{{if .Output}}<pre>{{.Output}}</pre>{{else}}<p class="quiet">no output kept</p>{{end}}
+</details>{{end}}
+</div>
+{{if .Reruns}}<div class="reruns">{{range .Reruns}}{{template "test" .}}{{end}}</div>{{end}}
+</details>
+{{end}}`))
+
+// WriteHTML writes the report to path as a standalone HTML page: every
+// test with its outcome, and each of its trials, with the output of those
+// which failed and of the last, collapsed.
+func (r *Report) WriteHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.writeHTML(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Report) writeHTML(w io.Writer) error {
+	tests := make([]htmlTest, len(r.Tests))
+	for i, t := range r.Tests {
+		tests[i] = newHTMLTest(t)
+	}
+	return htmlReport.Execute(w, struct {
+		Start    time.Time
+		Duration time.Duration
+		Summary  string
+		Error    string
+		Tests    []htmlTest
+	}{r.Start, r.Duration.Round(time.Millisecond), r.Summary(), r.Error, tests})
+}
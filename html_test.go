@@ -0,0 +1,45 @@
+package schroedinger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTML(t *testing.T) {
+	flaky := &TestResult{
+		Package:        "./eth",
+		Name:           "TestSync",
+		Outcome:        OutcomeFlaky,
+		Trials:         2,
+		TrialDurations: []time.Duration{time.Second, 2 * time.Second},
+		Failures:       []TrialFailure{{1, "sync_test.go:42: got N peers"}},
+		failureOutputs: [][]byte{[]byte("--- FAIL: TestSync\n    sync_test.go:42: got 3 peers <want 5>\n")},
+		output:         []byte("--- PASS: TestSync\n"),
+	}
+	report := &Report{Tests: []*TestResult{
+		flaky,
+		{Package: "./p2p", Outcome: OutcomeFail, Trials: 1, TrialDurations: []time.Duration{time.Second}, Reruns: []*TestResult{
+			{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFail, Trials: 1, TrialDurations: []time.Duration{time.Second}, Failures: []TrialFailure{{1, "failed"}}},
+		}},
+	}}
+	var b bytes.Buffer
+	if err := report.writeHTML(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`<b class="flaky">flaky</b> ./eth TestSync <span class="quiet">(2 trials, 0s)</span>`,
+		`trial 1: <span class="fail">fail</span> sync_test.go:42: got N peers <span class="quiet">(1s)</span>`,
+		`got 3 peers &lt;want 5&gt;`,
+		`trial 2: <span class="pass">ok</span> <span class="quiet">(2s)</span>`,
+		"<pre>--- PASS: TestSync\n</pre>",
+		`<details class="test" open>`,
+		`<b class="fail">fail</b> ./p2p TestDial`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
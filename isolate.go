@@ -0,0 +1,101 @@
+package schroedinger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// isolation gives every trial of a test fresh GOCACHE and GOTMPDIR
+// directories, and a fresh HOME if home is set, so nothing a trial leaves
+// behind in them can affect the next one; see Config.IsolateCache
+type isolation struct {
+	home bool
+	// GOPATH and GOMODCACHE as they were, so that a fresh HOME doesn't
+	// also mean downloading every module again
+	keep []string
+}
+
+func newIsolation(c *Config) (*isolation, error) {
+	if !c.IsolateCache && !c.IsolateHome {
+		return nil, nil
+	}
+	iso := &isolation{home: c.IsolateHome}
+	if iso.home {
+		cmd := exec.Command(goExecutablePath, "env", "GOPATH", "GOMODCACHE")
+		cmd.Dir = c.WorkDir
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("go env: %v", err)
+		}
+		vals := strings.Split(strings.TrimSpace(string(out)), "\n")
+		for i, k := range []string{"GOPATH", "GOMODCACHE"} {
+			if i < len(vals) && strings.TrimSpace(vals[i]) != "" {
+				iso.keep = append(iso.keep, k+"="+strings.TrimSpace(vals[i]))
+			}
+		}
+	}
+	return iso, nil
+}
+
+// enter points the environment of t's next trial at a fresh temporary
+// directory, returning a func which points it back and removes the directory
+func (iso *isolation) enter(t *test) (func(), error) {
+	dir, err := ioutil.TempDir("", "schroedinger-trial-")
+	if err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(dir, "tmp")
+	env := []string{"GOCACHE=" + filepath.Join(dir, "cache"), "GOTMPDIR=" + tmp}
+	err = os.Mkdir(tmp, 0755)
+	if err == nil && iso.home {
+		home := filepath.Join(dir, "home")
+		env = append(env, "HOME="+home)
+		if runtime.GOOS == "windows" {
+			env = append(env, "USERPROFILE="+home)
+		}
+		env = append(env, iso.keep...)
+		err = os.Mkdir(home, 0755)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	logTrialf(t, "| isolated in %s", dir)
+	t.env = env
+	return func() {
+		t.env = nil
+		if err := removeAll(dir); err != nil {
+			t.logf("WARNING %s: removing %s: %v", t, dir, err)
+		}
+	}, nil
+}
+
+// removeAll removes dir like os.RemoveAll, making whatever is read-only in
+// it writable first if need be, as the go module cache is
+func removeAll(dir string) error {
+	if os.RemoveAll(dir) == nil {
+		return nil
+	}
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode()&0200 == 0 {
+			os.Chmod(path, fi.Mode()|0200)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// environ returns the environment to run t's commands with: nil, for that of
+// this process, or that with t's own variables added, its env= options last
+func (t *test) environ() []string {
+	if t == nil || len(t.env)+len(t.vars) == 0 {
+		return nil
+	}
+	env := append(os.Environ(), t.env...)
+	return append(env, t.vars...)
+}
@@ -0,0 +1,76 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestIsolation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+
+	// each trial, hooks included, sees its own existing directories
+	tt, err := handleLine(`isolated cmd="test -d $GOTMPDIR -a -d $HOME && echo $GOCACHE $HOME >> trials" after="echo $GOCACHE >> afters"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.dir, tt.trialsAllowed = dir, 2
+	tt.isolation = &isolation{home: true}
+	for i := 0; i < 2; i++ {
+		if o, err := runTest(tt); err != nil {
+			t.Fatalf("%v: %s", err, o)
+		}
+		if tt.env != nil {
+			t.Errorf("env left set: %v", tt.env)
+		}
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "trials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trials := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(trials) != 2 || trials[0] == trials[1] {
+		t.Fatalf("want 2 different environments, got: %q", trials)
+	}
+	afters, err := ioutil.ReadFile(filepath.Join(dir, "afters"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	afterCaches := strings.Fields(string(afters))
+	for i, tr := range trials {
+		dirs := strings.Fields(tr)
+		if i >= len(afterCaches) || afterCaches[i] != dirs[0] {
+			t.Errorf("%d: after hook saw GOCACHE: %q, want: %s", i, afterCaches, dirs[0])
+		}
+		for _, d := range dirs {
+			if _, err := os.Stat(d); !os.IsNotExist(err) {
+				t.Errorf("%s not removed: %v", d, err)
+			}
+		}
+	}
+}
+
+func TestRemoveAllReadOnly(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "modcache")
+	if err := os.MkdirAll(filepath.Join(dir, "mod"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "mod", "go.mod"), nil, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "mod"), 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := removeAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("not removed: %v", err)
+	}
+}
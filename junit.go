@@ -0,0 +1,196 @@
+package schroedinger
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// The JUnit XML of a run, as Jenkins, GitLab and CircleCI read it: a
+// testsuite per package, and a testcase per test. The failed trials of a
+// test are recorded as retries the way Maven Surefire does: a flaky test
+// has a flakyFailure for each, and a failed test a failure for the first
+// and a rerunFailure for each after it.
+type junitSuites struct {
+	XMLName  xml.Name      `xml:"testsuites"`
+	Tests    int           `xml:"tests,attr"`
+	Failures int           `xml:"failures,attr"`
+	Errors   int           `xml:"errors,attr"`
+	Skipped  int           `xml:"skipped,attr"`
+	Time     string        `xml:"time,attr"`
+	Suites   []*junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string       `xml:"name,attr"`
+	Tests     int          `xml:"tests,attr"`
+	Failures  int          `xml:"failures,attr"`
+	Errors    int          `xml:"errors,attr"`
+	Skipped   int          `xml:"skipped,attr"`
+	Time      string       `xml:"time,attr"`
+	Timestamp string       `xml:"timestamp,attr,omitempty"`
+	Cases     []*junitCase `xml:"testcase"`
+
+	duration time.Duration
+}
+
+type junitCase struct {
+	Name          string          `xml:"name,attr"`
+	Classname     string          `xml:"classname,attr"`
+	Time          string          `xml:"time,attr"`
+	Skipped       *junitSkipped   `xml:"skipped"`
+	Error         *junitAttempt   `xml:"error"`
+	Failure       *junitAttempt   `xml:"failure"`
+	RerunFailures []*junitAttempt `xml:"rerunFailure"`
+	FlakyFailures []*junitAttempt `xml:"flakyFailure"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// junitAttempt is a failed trial; the output of a failure or error is its
+// text, that of a retry its system-out
+type junitAttempt struct {
+	Message   string `xml:"message,attr"`
+	Type      string `xml:"type,attr"`
+	Time      string `xml:"time,attr,omitempty"`
+	Text      string `xml:",chardata"`
+	SystemOut string `xml:"system-out,omitempty"`
+}
+
+// WriteJUnit writes the report as JUnit XML to path.
+func (r *Report) WriteJUnit(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.writeJUnit(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *Report) writeJUnit(w io.Writer) error {
+	all := &junitSuites{}
+	suites := make(map[string]*junitSuite)
+	add := func(t *TestResult) {
+		s := suites[t.Package]
+		if s == nil {
+			s = &junitSuite{Name: t.Package}
+			if !t.Finished.IsZero() {
+				s.Timestamp = t.Finished.Add(-t.Duration).UTC().Format("2006-01-02T15:04:05")
+			}
+			suites[t.Package] = s
+			all.Suites = append(all.Suites, s)
+		}
+		c := junitTestCase(t)
+		s.Cases = append(s.Cases, c)
+		s.Tests++
+		s.duration += t.Duration
+		switch {
+		case c.Skipped != nil:
+			s.Skipped++
+		case c.Error != nil:
+			s.Errors++
+		case c.Failure != nil:
+			s.Failures++
+		}
+	}
+	for _, t := range r.Tests {
+		// the failing tests found in a package run stand for it, unless it
+		// didn't build
+		if len(t.Reruns) > 0 && !t.BuildFailed {
+			for _, rr := range t.Reruns {
+				add(rr)
+			}
+			continue
+		}
+		add(t)
+	}
+	for _, s := range all.Suites {
+		s.Time = junitSeconds(s.duration)
+		all.Tests += s.Tests
+		all.Failures += s.Failures
+		all.Errors += s.Errors
+		all.Skipped += s.Skipped
+	}
+	all.Time = junitSeconds(r.Duration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(all); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitTestCase(t *TestResult) *junitCase {
+	c := &junitCase{Name: t.Name, Classname: t.Package, Time: junitSeconds(t.Duration)}
+	if c.Name == "" {
+		// the whole package, or a cmd= test
+		c.Name = t.Package
+	}
+	if t.Quarantined {
+		// ran, but doesn't count either way
+		c.Skipped = &junitSkipped{Message: fmt.Sprintf("quarantined, %s", t.Outcome)}
+		return c
+	}
+	switch t.Outcome {
+	case OutcomePass:
+		return c
+	case OutcomeSkip:
+		c.Skipped = &junitSkipped{Message: "skipped"}
+		return c
+	case OutcomeFlaky:
+		for i := range t.Failures {
+			c.FlakyFailures = append(c.FlakyFailures, junitRetry(t, i))
+		}
+		return c
+	case OutcomeFail:
+	default:
+		// resumed, unchanged or stable: not run
+		c.Skipped = &junitSkipped{Message: string(t.Outcome) + " (not run)"}
+		return c
+	}
+
+	first := &junitAttempt{Message: t.Error, Type: "failure", Text: string(t.output)}
+	if len(t.Failures) > 0 {
+		first = junitRetry(t, 0)
+		first.Text, first.SystemOut = first.SystemOut, ""
+	}
+	if t.BuildFailed {
+		first.Type = "build failed"
+		c.Error = first
+	} else {
+		c.Failure = first
+	}
+	for i := 1; i < len(t.Failures); i++ {
+		c.RerunFailures = append(c.RerunFailures, junitRetry(t, i))
+	}
+	return c
+}
+
+// junitRetry is the i-th failed trial of t
+func junitRetry(t *TestResult, i int) *junitAttempt {
+	f := t.Failures[i]
+	a := &junitAttempt{Message: f.Signature, Type: fmt.Sprintf("trial %d", f.Trial)}
+	if i < len(t.failureOutputs) {
+		a.SystemOut = string(t.failureOutputs[i])
+	}
+	if n := f.Trial - 1; n >= 0 && n < len(t.TrialDurations) {
+		a.Time = junitSeconds(t.TrialDurations[n])
+	}
+	return a
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
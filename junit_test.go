@@ -0,0 +1,56 @@
+package schroedinger
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	once := filepath.Join(dir, "once")
+	tests := "pass cmd=true\n" +
+		"flaky cmd=\"test -e " + once + " || { touch " + once + "; echo first; false; }\"\n" +
+		"fail cmd=\"echo boom; false\"\n"
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte(tests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "junit.xml")
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 2, MaxFailures: 10, JUnitFile: out}
+	if report, err := runAndReport(context.Background(), c); exitCode(c, report, err) != ExitFailed {
+		t.Fatalf("got: %v", err)
+	}
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("%v\n%s", err, b)
+	}
+	if got.Tests != 3 || got.Failures != 1 || len(got.Suites) != 3 {
+		t.Fatalf("got:\n%s", b)
+	}
+	cases := make(map[string]*junitCase)
+	for _, s := range got.Suites {
+		cases[s.Name] = s.Cases[0]
+	}
+	if c := cases["pass"]; c.Failure != nil || len(c.FlakyFailures) != 0 {
+		t.Errorf("pass: %+v", c)
+	}
+	if c := cases["flaky"]; c.Failure != nil || len(c.FlakyFailures) != 1 || c.FlakyFailures[0].Type != "trial 1" || !strings.Contains(c.FlakyFailures[0].SystemOut, "first") {
+		t.Errorf("flaky: %+v", c)
+	}
+	c2 := cases["fail"]
+	if c2.Failure == nil || !strings.Contains(c2.Failure.Text, "boom") || len(c2.RerunFailures) != 1 || c2.RerunFailures[0].Type != "trial 2" || c2.RerunFailures[0].Time == "" {
+		t.Errorf("fail: %+v", c2)
+	}
+}
@@ -0,0 +1,69 @@
+package schroedinger
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLimiterReserve(t *testing.T) {
+	l := newLimiter(4)
+	now := time.Now()
+	for i, want := range []time.Duration{0, 250 * time.Millisecond, 500 * time.Millisecond} {
+		if got := l.reserve(now); got != want {
+			t.Errorf("%d: got: %v, want: %v", i, got, want)
+		}
+	}
+	// tokens don't pile up while idle
+	later := now.Add(time.Minute)
+	for i, want := range []time.Duration{0, 250 * time.Millisecond} {
+		if got := l.reserve(later); got != want {
+			t.Errorf("idle %d: got: %v, want: %v", i, got, want)
+		}
+	}
+	if newLimiter(0) != nil {
+		t.Error("want no limiter for rate 0")
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	l := newLimiter(0.001)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := l.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	done := make(chan error)
+	go func() { done <- l.wait(ctx) }()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("got: %v, want: %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("wait ignored cancellation")
+	}
+}
+
+func TestLimiterRetries(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("flaky cmd=false trials=3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a trial every 200ms, the retries too
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 3, MaxStartsPerSecond: 5}
+	start := time.Now()
+	report, err := run(c)
+	if err == nil || len(report.Tests) != 1 || report.Tests[0].Trials != 3 {
+		t.Fatalf("got: %v, %+v", err, report.Tests)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("3 trials took %v, want at least 400ms", d)
+	}
+}
@@ -0,0 +1,91 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// List writes the test functions of the packages in the configured tests
+// files to w, one 'package TestName' line each. With skeleton, the lines
+// carry the configured trials and can be used as a tests file.
+func List(c *Config, w io.Writer, skeleton bool) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	tests, err := c.loadTests()
+	if err != nil {
+		return err
+	}
+	tests = filterTests(tests, c.selected)
+
+	if skeleton {
+		fmt.Fprintln(w, "# generated by schroedinger -list -skeleton")
+	}
+	seen := make(map[string]bool)
+	listed := make(map[listedTest]bool)
+	for _, t := range tests {
+		if t.command != "" {
+			continue
+		}
+		dir, pkg := t.goArgs()
+		key := dir + " " + pkg
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// no tests are run with -list
+		o, err := goCommand(nil, dir, "test", pkg, "-list", ".").CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v\n%s", t.pkg, err, o)
+		}
+		for _, l := range parseTestList(o) {
+			// eg. listed by both ./eth and ./eth/...
+			if listed[l] {
+				continue
+			}
+			listed[l] = true
+			if skeleton {
+				fmt.Fprintf(w, "%s %s trials=%d\n", l.pkg, l.name, t.trialsAllowed)
+			} else {
+				fmt.Fprintf(w, "%s %s\n", l.pkg, l.name)
+			}
+		}
+	}
+	return nil
+}
+
+type listedTest struct {
+	pkg  string
+	name string
+}
+
+// parseTestList parses go test -list output, where each package's test
+// names are followed by its 'ok' line
+func parseTestList(gotestout []byte) []listedTest {
+	var out, pending []listedTest
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	for scanner.Scan() {
+		text := scanner.Text()
+		// eg. 'ok  	github.com/ethereumproject/go-ethereum/p2p	0.002s'
+		if strings.HasPrefix(text, "ok ") {
+			fields := strings.Fields(text)
+			if len(fields) < 2 {
+				continue
+			}
+			for _, p := range pending {
+				out = append(out, listedTest{pkg: fields[1], name: p.name})
+			}
+			pending = pending[:0]
+			continue
+		}
+		if strings.HasPrefix(text, "Test") || strings.HasPrefix(text, "Benchmark") ||
+			strings.HasPrefix(text, "Example") || strings.HasPrefix(text, "Fuzz") {
+			pending = append(pending, listedTest{name: strings.TrimSpace(text)})
+		}
+	}
+	return out
+}
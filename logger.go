@@ -0,0 +1,69 @@
+package schroedinger
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Logger is what a run logs to: the tests starting, their trials and
+// outcomes, and the summary. *log.Logger is one; see also SlogLogger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// runLogger is what a run logs to: the standard logger, unless a Runner
+// was given another, which the live view swaps out while it's shown. A nil
+// *runLogger logs to the standard logger.
+type runLogger struct {
+	mu sync.Mutex
+	l  Logger
+}
+
+func newRunLogger(l Logger) *runLogger {
+	return &runLogger{l: l}
+}
+
+func (r *runLogger) Printf(format string, v ...interface{}) {
+	if r == nil {
+		log.Printf(format, v...)
+		return
+	}
+	r.mu.Lock()
+	l := r.l
+	r.mu.Unlock()
+	l.Printf(format, v...)
+}
+
+// swap logs to l from now on, and returns the logger logged to until now
+func (r *runLogger) swap(l Logger) Logger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.l
+	r.l = l
+	return old
+}
+
+// SlogLogger returns a Logger logging each message to l at level Info.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Printf(format string, v ...interface{}) {
+	s.l.Info(strings.TrimSuffix(fmt.Sprintf(format, v...), "\n"))
+}
+
+func (c *Config) logf(format string, v ...interface{}) {
+	c.log.Printf(format, v...)
+}
+
+// logln logs its operands as log.Println does
+func (c *Config) logln(v ...interface{}) {
+	c.log.Printf("%s", strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
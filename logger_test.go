@@ -0,0 +1,38 @@
+package schroedinger
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestRunLogger(t *testing.T) {
+	var std bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	defer log.SetFlags(log.Flags())
+	log.SetOutput(&std)
+	log.SetFlags(0)
+
+	// nil logs to the standard logger
+	var rl *runLogger
+	rl.Printf("one")
+	(&Config{}).logln("two", 2)
+	if got := std.String(); got != "one\ntwo 2\n" {
+		t.Errorf("got: %q", got)
+	}
+
+	var a, b bytes.Buffer
+	rl = newRunLogger(log.New(&a, "", 0))
+	c := &Config{log: rl}
+	c.logf("to %s", "a")
+	if old := rl.swap(log.New(&b, "", 0)); old == nil {
+		t.Fatal("got no logger back")
+	}
+	c.logf("to %s", "b")
+	if a.String() != "to a\n" || b.String() != "to b\n" {
+		t.Errorf("got: %q, %q", a.String(), b.String())
+	}
+	if std.String() != "one\ntwo 2\n" {
+		t.Errorf("logged to the standard logger: %q", std.String())
+	}
+}
@@ -0,0 +1,230 @@
+package schroedinger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metrics exposes run progress in the Prometheus text format.
+// All methods are safe to call on a nil *metrics, which does nothing.
+type metrics struct {
+	mu         sync.Mutex
+	trials     map[trialKey]int
+	durSum     map[string]float64
+	durCount   map[string]int
+	inProgress int
+	// tests finished, by outcome, and histograms of all of them
+	tests         map[Outcome]int
+	trialDuration *histogram
+	testTrials    *histogram
+}
+
+type trialKey struct {
+	test    string
+	outcome Outcome
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		trials:   make(map[trialKey]int),
+		durSum:   make(map[string]float64),
+		durCount: make(map[string]int),
+		tests:    make(map[Outcome]int),
+		// from a quick unit test to a slow package
+		trialDuration: newHistogram(0.1, 0.5, 1, 5, 10, 30, 60, 300, 600),
+		testTrials:    newHistogram(1, 2, 3, 5, 10, 20),
+	}
+}
+
+func (m *metrics) started() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.inProgress++
+	m.mu.Unlock()
+}
+
+// finished records a test's result, including the reruns of a package
+func (m *metrics) finished(r *TestResult) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.inProgress--
+	m.record(r)
+	m.mu.Unlock()
+}
+
+func (m *metrics) record(r *TestResult) {
+	name := r.String()
+	for i, d := range r.TrialDurations {
+		// eg. a result of an older report without them
+		o := OutcomeFail
+		if i < len(r.TrialOutcomes) {
+			o = r.TrialOutcomes[i]
+		}
+		m.trials[trialKey{name, o}]++
+		m.durSum[name] += d.Seconds()
+		m.durCount[name]++
+		m.trialDuration.observe(d.Seconds())
+	}
+	m.tests[r.Outcome]++
+	m.testTrials.observe(float64(r.Trials))
+	for _, rr := range r.Reruns {
+		m.record(rr)
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// write writes m in the Prometheus text format
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]trialKey, 0, len(m.trials))
+	for k := range m.trials {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].test != keys[j].test {
+			return keys[i].test < keys[j].test
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	fmt.Fprintln(w, "# HELP schroedinger_trials_total Trials run, by test and outcome.")
+	fmt.Fprintln(w, "# TYPE schroedinger_trials_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "schroedinger_trials_total{test=%s,outcome=%s} %d\n",
+			promLabel(k.test), promLabel(string(k.outcome)), m.trials[k])
+	}
+
+	names := make([]string, 0, len(m.durCount))
+	for n := range m.durCount {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "# HELP schroedinger_test_duration_seconds Duration of trials, by test.")
+	fmt.Fprintln(w, "# TYPE schroedinger_test_duration_seconds summary")
+	for _, n := range names {
+		fmt.Fprintf(w, "schroedinger_test_duration_seconds_sum{test=%s} %g\n", promLabel(n), m.durSum[n])
+		fmt.Fprintf(w, "schroedinger_test_duration_seconds_count{test=%s} %d\n", promLabel(n), m.durCount[n])
+	}
+
+	fmt.Fprintln(w, "# HELP schroedinger_tests_in_progress Tests currently running.")
+	fmt.Fprintln(w, "# TYPE schroedinger_tests_in_progress gauge")
+	fmt.Fprintf(w, "schroedinger_tests_in_progress %d\n", m.inProgress)
+
+	outcomes := make([]string, 0, len(m.tests))
+	for o := range m.tests {
+		outcomes = append(outcomes, string(o))
+	}
+	sort.Strings(outcomes)
+	fmt.Fprintln(w, "# HELP schroedinger_tests_total Tests finished, by outcome.")
+	fmt.Fprintln(w, "# TYPE schroedinger_tests_total counter")
+	for _, o := range outcomes {
+		fmt.Fprintf(w, "schroedinger_tests_total{outcome=%s} %d\n", promLabel(o), m.tests[Outcome(o)])
+	}
+
+	m.trialDuration.write(w, "schroedinger_trial_duration_seconds", "Duration of trials of all tests.")
+	m.testTrials.write(w, "schroedinger_test_trials", "Trials run per test.")
+}
+
+// histogram is a Prometheus histogram with the given upper bounds
+type histogram struct {
+	bounds []float64
+	// observations up to each bound, not cumulative
+	counts []int
+	sum    float64
+	count  int
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]int, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	n := 0
+	for i, b := range h.bounds {
+		n += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%s} %d\n", name, promLabel(fmt.Sprint(b)), n)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func promLabel(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return `"` + v + `"`
+}
+
+// serveMetrics serves m on addr until the returned func is called
+func serveMetrics(addr string, m *metrics) (func(), error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}, nil
+}
+
+// pushMetrics pushes m to a Prometheus Pushgateway at url, eg.
+// http://pushgateway:9091, under the job schroedinger; or to url as it is
+// if it names a job, eg. http://pushgateway:9091/metrics/job/nightly
+func pushMetrics(url string, m *metrics) error {
+	if !strings.Contains(url, "/metrics/job/") {
+		url = strings.TrimSuffix(url, "/") + "/metrics/job/schroedinger"
+	}
+	var body bytes.Buffer
+	m.write(&body)
+	req, err := http.NewRequest(http.MethodPut, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newMetrics()
+	m.started()
+	m.started()
+	m.finished(&TestResult{
+		Package:        "./eth",
+		Name:           "TestSync",
+		Outcome:        OutcomeFlaky,
+		Trials:         2,
+		TrialDurations: []time.Duration{time.Second, 2 * time.Second},
+		TrialOutcomes:  []Outcome{OutcomeFail, OutcomePass},
+	})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	for _, want := range []string{
+		`schroedinger_trials_total{test="./eth TestSync",outcome="fail"} 1`,
+		`schroedinger_trials_total{test="./eth TestSync",outcome="pass"} 1`,
+		`schroedinger_test_duration_seconds_sum{test="./eth TestSync"} 3`,
+		`schroedinger_test_duration_seconds_count{test="./eth TestSync"} 2`,
+		`schroedinger_tests_in_progress 1`,
+		`schroedinger_tests_total{outcome="flaky"} 1`,
+		`schroedinger_trial_duration_seconds_bucket{le="1"} 1`,
+		`schroedinger_trial_duration_seconds_bucket{le="5"} 2`,
+		`schroedinger_trial_duration_seconds_bucket{le="+Inf"} 2`,
+		`schroedinger_trial_duration_seconds_sum 3`,
+		`schroedinger_test_trials_bucket{le="2"} 1`,
+		`schroedinger_test_trials_count 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestMetricsTrialOutcomes(t *testing.T) {
+	m := newMetrics()
+	sec := time.Second
+	// minpasses=2 of 4, passing with a failed trial in between
+	m.finished(&TestResult{
+		Package:        "./eth",
+		Name:           "TestSync",
+		Outcome:        OutcomeFlaky,
+		Trials:         4,
+		TrialDurations: []time.Duration{sec, sec, sec, sec},
+		TrialOutcomes:  []Outcome{OutcomePass, OutcomeFail, OutcomeSkip, OutcomePass},
+	})
+	// a package failing once, then its failing test passing on rerun
+	m.finished(&TestResult{
+		Package:        "./p2p",
+		Outcome:        OutcomeFlaky,
+		Trials:         1,
+		TrialDurations: []time.Duration{sec},
+		TrialOutcomes:  []Outcome{OutcomeFail},
+		Reruns: []*TestResult{{
+			Package:        "./p2p",
+			Name:           "TestDial",
+			Outcome:        OutcomePass,
+			Trials:         2,
+			TrialDurations: []time.Duration{sec},
+			TrialOutcomes:  []Outcome{OutcomePass},
+		}},
+	})
+
+	var b strings.Builder
+	m.write(&b)
+	out := b.String()
+	for _, want := range []string{
+		`schroedinger_trials_total{test="./eth TestSync",outcome="fail"} 1`,
+		`schroedinger_trials_total{test="./eth TestSync",outcome="pass"} 2`,
+		`schroedinger_trials_total{test="./eth TestSync",outcome="skip"} 1`,
+		`schroedinger_trials_total{test="./p2p",outcome="fail"} 1`,
+		`schroedinger_trials_total{test="./p2p TestDial",outcome="pass"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `test="./p2p",outcome="pass"`) {
+		t.Errorf("package trial counted as passed:\n%s", out)
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	var path, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		path, body = r.Method+" "+r.URL.Path, string(b)
+	}))
+	defer srv.Close()
+
+	m := newMetrics()
+	m.started()
+	m.finished(&TestResult{Package: "./eth", Outcome: OutcomeFail, Trials: 3})
+	if err := pushMetrics(srv.URL, m); err != nil {
+		t.Fatal(err)
+	}
+	if path != "PUT /metrics/job/schroedinger" || !strings.Contains(body, `schroedinger_tests_total{outcome="fail"} 1`) {
+		t.Errorf("got: %s\n%s", path, body)
+	}
+	if err := pushMetrics(srv.URL+"/metrics/job/nightly", m); err != nil {
+		t.Fatal(err)
+	}
+	if path != "PUT /metrics/job/nightly" {
+		t.Errorf("got: %s", path)
+	}
+}
@@ -0,0 +1,76 @@
+package schroedinger
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// moduleRoot returns the root directory of the module holding dir,
+// or "" when go runs in GOPATH mode there
+func moduleRoot(dir string) (string, error) {
+	cmd := exec.Command(goExecutablePath, "env", "GOMOD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	gomod := strings.TrimSpace(string(out))
+	if gomod == "" || gomod == os.DevNull {
+		return "", nil
+	}
+	return filepath.Dir(gomod), nil
+}
+
+// resolveModule arranges for a package given as a path, eg. ./sub/...,
+// to be tested from the root of the module holding it, so one tests file
+// can span several modules. Packages given as import paths, and packages
+// outside any module, are tested from the test's dir as they are.
+// Roots are cached by directory in roots.
+func (t *test) resolveModule(roots map[string]string) {
+	if t.command != "" {
+		return
+	}
+	base := getNonRecursivePackageName(t.pkg)
+	if !filepath.IsAbs(base) && !strings.HasPrefix(base, ".") {
+		return
+	}
+	pkgDir := base
+	if !filepath.IsAbs(base) {
+		pkgDir = filepath.Join(t.dir, base)
+	}
+	pkgDir, err := filepath.Abs(pkgDir)
+	if err != nil {
+		return
+	}
+	root, ok := roots[pkgDir]
+	if !ok {
+		// left to go test to complain about
+		root, _ = moduleRoot(pkgDir)
+		roots[pkgDir] = root
+	}
+	if root == "" {
+		return
+	}
+	rel, err := filepath.Rel(root, pkgDir)
+	if err != nil {
+		return
+	}
+	pkg := "./" + filepath.ToSlash(rel)
+	if rel == "." {
+		pkg = "."
+	}
+	if base != t.pkg {
+		pkg = strings.TrimSuffix(pkg, "/.") + "/..."
+	}
+	t.goDir, t.goPkg = root, pkg
+}
+
+// goArgs returns the directory to run go test from and the package to give it
+func (t *test) goArgs() (dir, pkg string) {
+	if t.goPkg != "" {
+		return t.goDir, t.goPkg
+	}
+	return t.dir, t.pkg
+}
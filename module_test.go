@@ -0,0 +1,70 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	// a module holding another in sub
+	files := map[string]string{
+		"go.mod":          "module example.com/a\n",
+		"x/x.go":          "package x\n",
+		"sub/go.mod":      "module example.com/sub\n",
+		"sub/y/y.go":      "package y\n",
+		"gopath/z/z.go":   "package z\n",
+		"sub/y/y_test.go": "package y\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if root, _ := moduleRoot(dir); root == "" {
+		t.Skip("go runs in GOPATH mode")
+	}
+	sub := filepath.Join(dir, "sub")
+
+	cases := []struct {
+		pkg, dir     string
+		goDir, goPkg string
+	}{
+		{"./...", dir, dir, "./..."},
+		{"./x", dir, dir, "./x"},
+		{"./sub/...", dir, sub, "./..."},
+		{"./sub/y", dir, sub, "./y"},
+		{"./y/...", sub, sub, "./y/..."},
+		{"../x", sub, dir, "./x"},
+		// import paths are left to go
+		{"example.com/sub/y", dir, dir, "example.com/sub/y"},
+	}
+	roots := make(map[string]string)
+	for _, c := range cases {
+		tt := &test{pkg: c.pkg, dir: c.dir}
+		tt.resolveModule(roots)
+		if d, p := tt.goArgs(); d != c.goDir || p != c.goPkg {
+			t.Errorf("%s in %s: got: %s %s, want: %s %s", c.pkg, c.dir, d, p, c.goDir, c.goPkg)
+		}
+	}
+
+	// reruns of a recursive package stay in its module
+	tt := &test{pkg: "./sub/...", dir: dir}
+	tt.resolveModule(roots)
+	if d, p := tt.rerun(failure{name: "TestY"}).goArgs(); d != sub || p != "." {
+		t.Errorf("rerun: got: %s %s, want: %s .", d, p, sub)
+	}
+}
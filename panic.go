@@ -0,0 +1,68 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+// grepPanic extracts the first panic or fatal runtime error and its
+// goroutine dump from go test output, along with the test it happened in,
+// if known. The stack is empty if the output holds no panic.
+func grepPanic(gotestout []byte) (test, stack string) {
+	var lines []string
+	var running string
+	in := false
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if !in {
+			// eg. '=== RUN   TestSync/fast' (with -v)
+			if strings.HasPrefix(text, "=== RUN") {
+				if f := strings.Fields(text); len(f) == 3 {
+					running = f[2]
+				}
+			}
+			// eg. '--- FAIL: TestSync (0.00s)', just before the panic
+			if m := failLine.FindStringSubmatch(text); m != nil {
+				test = m[1]
+			}
+			// eg. 'panic: runtime error: index out of range [recovered]',
+			// 'fatal error: concurrent map writes'
+			if strings.HasPrefix(text, "panic: ") || strings.HasPrefix(text, "fatal error: ") {
+				in = true
+				lines = append(lines, text)
+			}
+			continue
+		}
+		// eg. 'FAIL	github.com/ethereumproject/go-ethereum/p2p	0.012s'
+		if strings.HasPrefix(text, "FAIL\t") || strings.HasPrefix(text, "exit status ") {
+			break
+		}
+		lines = append(lines, text)
+	}
+	if len(lines) == 0 {
+		return "", ""
+	}
+	if test == "" {
+		test = running
+	}
+	return test, strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// notePanic records a panic in the output of a failed trial on r, and
+// reports whether there was one. The panic of go test -timeout is no bug
+// in itself and is recorded as a timeout instead.
+func (r *TestResult) notePanic(o []byte) bool {
+	test, stack := grepPanic(o)
+	if stack == "" {
+		return false
+	}
+	if timeoutLine.MatchString(stack) {
+		r.TimedOut = true
+		return false
+	}
+	r.PanicIn, r.Panic = test, stack
+	return true
+}
@@ -0,0 +1,302 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FailureParser finds the failing tests in the output of a package's
+// trial, so they can be rerun one by one; see Config.Parser.
+type FailureParser interface {
+	// Parse returns the tests found in output. Those with OutcomeFail are
+	// rerun; a failed result without a Name is that of a package which
+	// failed as a whole. Results with other outcomes are ignored.
+	Parse(output []byte) ([]TestResult, error)
+}
+
+// Names of the built-in parsers.
+const (
+	// go test's own output; the default
+	ParserText = "text"
+	// go test -json output, eg. from a cmd= running gotestsum --jsonfile
+	ParserJSON = "json"
+)
+
+// maxLineSize bounds a line of go test output read, which a test logging
+// a large value can make long
+const maxLineSize = 64 << 20
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]FailureParser{
+		ParserText: textParser{},
+		ParserJSON: jsonParser{},
+	}
+)
+
+// RegisterParser makes p available to Config.Parser under name, replacing
+// any parser of that name.
+func RegisterParser(name string, p FailureParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[name] = p
+}
+
+// Parsers returns the names of the registered parsers.
+func Parsers() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	var names []string
+	for n := range parsers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupParser(name string) (FailureParser, error) {
+	if name == "" {
+		name = ParserText
+	}
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	p, ok := parsers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parser: %s", name)
+	}
+	return p, nil
+}
+
+// parseFailures returns the failures p finds in gotestout
+func parseFailures(p FailureParser, gotestout []byte) ([]failure, error) {
+	if p == nil {
+		return grepFailures(gotestout)
+	}
+	results, err := p.Parse(gotestout)
+	if err != nil {
+		return nil, err
+	}
+	var fails []failure
+	for _, r := range results {
+		if r.Outcome == OutcomeFail {
+			fails = append(fails, failure{pkg: r.Package, name: r.Name})
+		}
+	}
+	return fails, nil
+}
+
+// keepJSON keeps the go test -json output of a trial of t, if run with
+// -json, and returns it as text along with the trial's err, or the error
+// reading the output if the trial had none
+func (t *test) keepJSON(o []byte, err error) ([]byte, error) {
+	if !t.goJSON {
+		return o, err
+	}
+	t.jsonOut = o
+	text, jerr := jsonText(o)
+	if jerr != nil && err == nil {
+		err = fmt.Errorf("could not read go test -json output: %w", jerr)
+	}
+	return text, err
+}
+
+// parseFailures returns the failures in the output of t's latest trial:
+// from its events if run with go test -json, unless another parser than
+// the text one was asked for, and otherwise from gotestout
+func (t *test) parseFailures(gotestout []byte) ([]failure, error) {
+	if _, text := t.parser.(textParser); t.jsonOut != nil && (t.parser == nil || text) {
+		return parseFailures(jsonParser{}, t.jsonOut)
+	}
+	return parseFailures(t.parser, gotestout)
+}
+
+// jsonText turns go test -json output back into the text go test would
+// have written, from the output of its events; lines which aren't JSON,
+// eg. build errors, are kept as they are
+func jsonText(output []byte) ([]byte, error) {
+	var text bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var e testEvent
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] == '{' && json.Unmarshal(trimmed, &e) == nil {
+			text.WriteString(e.Output)
+			continue
+		}
+		text.Write(line)
+		text.WriteByte('\n')
+	}
+	return text.Bytes(), scanner.Err()
+}
+
+// goSupportsJSON reports whether the go at path has go test -json, since
+// go1.10
+func goSupportsJSON(path string) bool {
+	v, err := goVersion(path)
+	return err == nil && versionHasJSON(v)
+}
+
+// versionHasJSON reports whether go version output is of go1.10 or later,
+// eg. 'go version go1.21.3 linux/amd64', 'go version devel go1.22-abc...'
+func versionHasJSON(v string) bool {
+	m := goVersionNumber.FindStringSubmatch(v)
+	if m == nil {
+		return false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	return major > 1 || minor >= 10
+}
+
+var goVersionNumber = regexp.MustCompile(`go(\d+)\.(\d+)`)
+
+// textParser parses go test's own output with grepFailures
+type textParser struct{}
+
+func (textParser) Parse(output []byte) ([]TestResult, error) {
+	fails, err := grepFailures(output)
+	if err != nil {
+		return nil, err
+	}
+	var results []TestResult
+	for _, f := range fails {
+		results = append(results, TestResult{Package: f.pkg, Name: f.name, Outcome: OutcomeFail})
+	}
+	return results, nil
+}
+
+// testEvent is a line of go test -json output, see go doc test2json
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// jsonParser parses go test -json output. Lines which aren't JSON, eg. of
+// build errors, are skipped. The failing tests of a package which failed
+// without any, as when go test -timeout panicked, are looked for in its
+// output as text.
+type jsonParser struct{}
+
+func (jsonParser) Parse(output []byte) ([]TestResult, error) {
+	var results []TestResult
+	// the output of each package, and whether any of its tests failed
+	text := make(map[string]*bytes.Buffer)
+	testFailed := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] != '{' {
+			continue
+		}
+		var e testEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			continue
+		}
+		if text[e.Package] == nil {
+			text[e.Package] = &bytes.Buffer{}
+		}
+		text[e.Package].WriteString(e.Output)
+		if e.Action != "fail" {
+			continue
+		}
+		if e.Test != "" {
+			results = append(results, TestResult{Package: e.Package, Name: e.Test, Outcome: OutcomeFail})
+			testFailed[e.Package] = true
+			continue
+		}
+		if testFailed[e.Package] {
+			continue
+		}
+		fails, err := grepFailures(text[e.Package].Bytes())
+		if err != nil {
+			return nil, err
+		}
+		var found bool
+		for _, f := range fails {
+			if f.name != "" {
+				results = append(results, TestResult{Package: e.Package, Name: f.name, Outcome: OutcomeFail})
+				found = true
+			}
+		}
+		if !found {
+			results = append(results, TestResult{Package: e.Package, Outcome: OutcomeFail})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// eg. '    sync_test.go:42: got 3 peers, want 4'
+var errorLine = regexp.MustCompile(`^\s+\S+\.go:\d+: `)
+
+// numbers in messages, which tend to differ between trials failing the same way
+var signatureNumber = regexp.MustCompile(`0x[0-9a-f]+|\d+(\.\d+)?`)
+
+// failureSignature sums up how a trial failed, so that failures of the same
+// cause can be told apart from others and counted together: the panic and
+// the function it came from, or else the first error line, keeping its file
+// and line; or else err. Numbers in messages are masked as N.
+func failureSignature(o []byte, err error) string {
+	if race, f := grepRace(o); race {
+		if f != "" {
+			return "data race in " + f
+		}
+		return "data race"
+	}
+	if _, stack := grepPanic(o); stack != "" {
+		lines := strings.Split(stack, "\n")
+		sig := signatureNumber.ReplaceAllString(lines[0], "N")
+		if f := panicFrame(lines[1:]); f != "" {
+			sig += " in " + f
+		}
+		return sig
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(o))
+	scanner.Buffer(nil, maxLineSize)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if loc := errorLine.FindStringIndex(text); loc != nil {
+			return strings.TrimSpace(text[:loc[1]]) + " " + signatureNumber.ReplaceAllString(text[loc[1]:], "N")
+		}
+	}
+	if grepBuildFailed(o) {
+		return "build failed"
+	}
+	if err != nil {
+		return signatureNumber.ReplaceAllString(err.Error(), "N")
+	}
+	return "failed"
+}
+
+// panicFrame returns the first function of a goroutine dump which isn't
+// the runtime's or the testing package's, without its arguments, eg.
+// 'github.com/ethereumproject/go-ethereum/eth.(*peer).send'
+func panicFrame(stack []string) string {
+	for _, l := range stack {
+		// the file:line lines are indented, and vary with the code
+		if l == "" || strings.HasPrefix(l, "\t") || strings.HasPrefix(l, "goroutine ") || strings.HasPrefix(l, "created by ") {
+			continue
+		}
+		if strings.HasPrefix(l, "runtime.") || strings.HasPrefix(l, "testing.") || strings.HasPrefix(l, "panic(") {
+			continue
+		}
+		if i := strings.LastIndex(l, "("); i > 0 {
+			l = l[:i]
+		}
+		return l
+	}
+	return ""
+}
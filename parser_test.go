@@ -0,0 +1,197 @@
+package schroedinger
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONParser(t *testing.T) {
+	out := `# github.com/x/broken
+broken.go:3: undefined: nope
+{"Action":"run","Package":"github.com/x/eth","Test":"TestSync"}
+{"Action":"output","Package":"github.com/x/eth","Test":"TestSync","Output":"--- FAIL: TestSync (0.01s)\n"}
+{"Action":"fail","Package":"github.com/x/eth","Test":"TestSync","Elapsed":0.01}
+{"Action":"fail","Package":"github.com/x/eth","Elapsed":0.02}
+{"Action":"output","Package":"github.com/x/p2p","Output":"panic: test timed out after 1s\n"}
+{"Action":"output","Package":"github.com/x/p2p","Output":"running tests:\n"}
+{"Action":"output","Package":"github.com/x/p2p","Output":"\tTestDial (1s)\n"}
+{"Action":"output","Package":"github.com/x/p2p","Output":"FAIL\tgithub.com/x/p2p\t1.01s\n"}
+{"Action":"fail","Package":"github.com/x/p2p","Elapsed":1.01}
+{"Action":"fail","Package":"github.com/x/main","Elapsed":0.01}
+{"Action":"pass","Package":"github.com/x/ok","Elapsed":0.01}
+`
+	p, err := lookupParser(ParserJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseFailures(p, []byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []failure{
+		{"github.com/x/eth", "TestSync"},
+		{"github.com/x/p2p", "TestDial"},
+		{"github.com/x/main", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+type lineParser struct{}
+
+// eg. 'FAILED pkg name'
+func (lineParser) Parse(output []byte) ([]TestResult, error) {
+	var results []TestResult
+	for _, l := range strings.Split(string(output), "\n") {
+		if f := strings.Fields(l); len(f) == 3 && f[0] == "FAILED" {
+			results = append(results, TestResult{Package: f[1], Name: f[2], Outcome: OutcomeFail})
+		}
+	}
+	return results, nil
+}
+
+func TestRegisterParser(t *testing.T) {
+	if _, err := lookupParser("lines"); err == nil {
+		t.Fatal("want error for unknown parser")
+	}
+	RegisterParser("lines", lineParser{})
+	t.Cleanup(func() {
+		parsersMu.Lock()
+		defer parsersMu.Unlock()
+		delete(parsers, "lines")
+	})
+	p, err := lookupParser("lines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := parseFailures(p, []byte("ok\nFAILED ./eth TestSync\n--- FAIL: TestOther\n"))
+	if want := []failure{{"./eth", "TestSync"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	// the default is the text parser
+	p, err = lookupParser("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = parseFailures(p, []byte("--- FAIL: TestOther (0.00s)\nFAIL\t./eth\t0.1s\n"))
+	if want := []failure{{"./eth", "TestOther"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestFailureSignature(t *testing.T) {
+	errExit := errors.New("exit status 1")
+	cases := []struct {
+		out  string
+		want string
+	}{
+		{"=== RUN   TestSync\n    sync_test.go:42: got 3 peers, want 4\n--- FAIL: TestSync (0.01s)\n", "sync_test.go:42: got N peers, want N"},
+		{"=== RUN   TestSync\npanic: send on closed channel\n\ngoroutine 7 [running]:\n", "panic: send on closed channel"},
+		{"panic: runtime error: index out of range [5] with length 3\n", "panic: runtime error: index out of range [N] with length N"},
+		{"# ./eth\neth/sync.go:3:2: undefined: x\nFAIL\t./eth [build failed]\n", "build failed"},
+		{"FAIL\n", "exit status N"},
+		{"panic: boom [recovered]\n\ngoroutine 7 [running]:\ntesting.tRunner.func1(0xc000102000)\n\t/go/src/testing/testing.go:874 +0x3a3\npanic(0x5d1b20, 0x6a8a90)\n\t/go/src/runtime/panic.go:679 +0x1b2\ngithub.com/x/eth.(*peer).send(0xc0000a4000)\n\t/src/eth/peer.go:12 +0x39\n", "panic: boom [recovered] in github.com/x/eth.(*peer).send"},
+	}
+	for _, c := range cases {
+		if got := failureSignature([]byte(c.out), errExit); got != c.want {
+			t.Errorf("%q: got: %q, want: %q", c.out, got, c.want)
+		}
+	}
+}
+
+func TestGoTestJSON(t *testing.T) {
+	out := `# github.com/x/les
+les/les.go:3:2: undefined: nope
+{"Action":"run","Package":"github.com/x/eth","Test":"TestSync"}
+{"Action":"output","Package":"github.com/x/eth","Test":"TestSync","Output":"=== RUN   TestSync\n"}
+{"Action":"output","Package":"github.com/x/eth","Test":"TestSync/fast","Output":"=== RUN   TestSync/fast\n"}
+{"Action":"output","Package":"github.com/x/eth","Test":"TestSync/fast","Output":"    --- FAIL: TestSync/fast (0.00s)\n"}
+{"Action":"fail","Package":"github.com/x/eth","Test":"TestSync/fast"}
+{"Action":"output","Package":"github.com/x/eth","Test":"TestSync","Output":"--- FAIL: TestSync (0.00s)\n"}
+{"Action":"fail","Package":"github.com/x/eth","Test":"TestSync"}
+{"Action":"output","Package":"github.com/x/eth","Output":"FAIL\tgithub.com/x/eth\t0.01s\n"}
+{"Action":"fail","Package":"github.com/x/eth"}
+`
+	tt := &test{pkg: "./...", goJSON: true, parser: textParser{}}
+	text, err := tt.keepJSON([]byte(out), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# github.com/x/les
+les/les.go:3:2: undefined: nope
+=== RUN   TestSync
+=== RUN   TestSync/fast
+    --- FAIL: TestSync/fast (0.00s)
+--- FAIL: TestSync (0.00s)
+FAIL	github.com/x/eth	0.01s
+`
+	if string(text) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", text, want)
+	}
+	fails, err := tt.parseFailures(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eth := "github.com/x/eth"
+	if want := []failure{{eth, "TestSync/fast"}, {eth, "TestSync"}}; !reflect.DeepEqual(fails, want) {
+		t.Errorf("got: %v, want: %v", fails, want)
+	}
+
+	// without -json, the output is left alone
+	tt = &test{}
+	if got, _ := tt.keepJSON([]byte(out), nil); string(got) != out || tt.jsonOut != nil {
+		t.Error("output changed without -json")
+	}
+}
+
+func TestVersionHasJSON(t *testing.T) {
+	cases := map[string]bool{
+		"go version go1.21.3 linux/amd64":                 true,
+		"go version go1.10 darwin/amd64":                  true,
+		"go version go1.9.7 linux/amd64":                  false,
+		"go version devel go1.22-a1b2c3d Tue linux/amd64": true,
+		"go version go2.0 linux/amd64":                    true,
+		"not go":                                          false,
+	}
+	for v, want := range cases {
+		if got := versionHasJSON(v); got != want {
+			t.Errorf("%s: got: %v, want: %v", v, got, want)
+		}
+	}
+}
+
+func TestParseLongLines(t *testing.T) {
+	// a test logging a value longer than bufio's default limit
+	long := strings.Repeat("x", 2<<20)
+	out := `{"Action":"output","Package":"eth","Test":"TestSync","Output":"` + long + `\n"}
+{"Action":"fail","Package":"eth","Test":"TestSync"}
+`
+	text, err := jsonText([]byte(out))
+	if err != nil || !strings.HasPrefix(string(text), long) {
+		t.Fatalf("got err: %v", err)
+	}
+	results, err := jsonParser{}.Parse([]byte(out))
+	if err != nil || len(results) != 1 || results[0].Name != "TestSync" {
+		t.Fatalf("got: %v, %v", results, err)
+	}
+
+	// too long to read at all
+	out = strings.Repeat("x", maxLineSize+1) + "\n--- FAIL: TestSync (0.00s)\n"
+	if _, err := jsonText([]byte(out)); err == nil {
+		t.Error("jsonText: want error")
+	}
+	if _, err := (jsonParser{}).Parse([]byte(out)); err == nil {
+		t.Error("jsonParser: want error")
+	}
+	if _, err := (textParser{}).Parse([]byte(out)); err == nil {
+		t.Error("textParser: want error")
+	}
+	tt := &test{goJSON: true}
+	if _, err := tt.keepJSON([]byte(out), nil); err == nil {
+		t.Error("keepJSON: want error")
+	}
+}
@@ -0,0 +1,173 @@
+package schroedinger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// binaries are the test binaries of packages, built once with go test -c
+// and run for every trial after, rather than building the package anew
+// each time; see Config.Precompile
+type binaries struct {
+	dir string
+
+	mu    sync.Mutex
+	built map[string]*binary
+}
+
+// binary is a test binary, built by the first trial needing it
+type binary struct {
+	mu    sync.Mutex
+	built bool
+	// empty if the package has no tests
+	path string
+	// the package's import path, and directory to run the binary from, as
+	// go test would
+	importPath, dir string
+}
+
+func newBinaries() (*binaries, error) {
+	dir, err := ioutil.TempDir("", "schroedinger-bin")
+	if err != nil {
+		return nil, err
+	}
+	return &binaries{dir: dir, built: make(map[string]*binary)}, nil
+}
+
+// precompile has tests run their packages' test binaries, if
+// Config.Precompile is set; the binaries are to be removed once they've run
+func (c *Config) precompile(tests []*test) (*binaries, error) {
+	if !c.Precompile {
+		return nil, nil
+	}
+	b, err := newBinaries()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tests {
+		t.binaries = b
+	}
+	return b, nil
+}
+
+func (b *binaries) remove() {
+	if b != nil {
+		os.RemoveAll(b.dir)
+	}
+}
+
+// precompiled reports whether trials of t run a prebuilt test binary: only
+// go test of a single package, not in docker, isolated or benchmarked
+func (t *test) precompiled() bool {
+	_, pkg := t.goArgs()
+	return t.binaries != nil && t.command == "" && t.docker == nil && t.isolation == nil && !t.bench && len(t.args) == 0 && !strings.HasSuffix(pkg, "...")
+}
+
+// get returns the binary of t's package, building it if need be. A build
+// which failed isn't kept, so the next trial tries again.
+func (b *binaries) get(t *test) (*binary, []byte, error) {
+	dir, pkg := t.goArgs()
+	var build []string
+	if t.race {
+		build = append(build, "-race")
+	}
+	if t.buildTags != "" {
+		build = append(build, "-tags="+t.buildTags)
+	}
+	if t.coverDir != "" {
+		build = append(build, "-cover")
+	}
+	key := dir + "\x00" + pkg + "\x00" + strings.Join(build, " ") + "\x00" + strings.Join(t.env, "\x00") + "\x00" + strings.Join(t.vars, "\x00")
+
+	b.mu.Lock()
+	bin := b.built[key]
+	if bin == nil {
+		bin = &binary{}
+		b.built[key] = bin
+	}
+	b.mu.Unlock()
+
+	bin.mu.Lock()
+	defer bin.mu.Unlock()
+	if bin.built {
+		return bin, nil, nil
+	}
+	list := exec.Command(goExecutablePath, "list", "-f", "{{.ImportPath}}\n{{.Dir}}", pkg)
+	list.Dir = dir
+	list.Env = t.environ()
+	out, err := list.CombinedOutput()
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if err != nil || len(lines) != 2 {
+		return nil, out, fmt.Errorf("go list %s: %v", pkg, err)
+	}
+	bin.importPath, bin.dir = lines[0], lines[1]
+	path := filepath.Join(b.dir, fmt.Sprintf("%x.test", sha256.Sum256([]byte(key))))
+	o, err := combinedOutput(t.context(), goCommand(t, dir, append(append([]string{"test", "-c", "-o", path}, build...), pkg)...), t.idleTimeout, t.maxOutput)
+	if err != nil {
+		// as go test would have it, for grepBuildFailed
+		return nil, append(o, fmt.Sprintf("FAIL\t%s [build failed]\n", bin.importPath)...), err
+	}
+	if _, err := os.Stat(path); err == nil {
+		bin.path = path
+	}
+	bin.built = true
+	return bin, nil, nil
+}
+
+// testBinaryArgs returns the arguments of a trial of t's test binary, the
+// same as those runTrial passes go test
+func testBinaryArgs(t *test) []string {
+	var args []string
+	if t.name != "" {
+		args = append(args, "-test.v", "-test.run", runPattern(t.name))
+	} else if len(t.batch) > 0 {
+		args = append(args, "-test.v", "-test.run", batchPattern(t.batch))
+	}
+	if t.parallel > 0 {
+		args = append(args, fmt.Sprintf("-test.parallel=%d", t.parallel))
+	}
+	if timeout := trialTimeout(t); timeout > 0 {
+		args = append(args, "-test.timeout="+timeout.String())
+	}
+	if t.coverProfile != "" {
+		args = append(args, "-test.coverprofile="+t.coverProfile)
+	}
+	return args
+}
+
+// runPrecompiled runs a trial of t with the test binary of its package.
+// Its output ends in the line go test would have added, eg. 'ok
+// github.com/x/eth 0.395s', so it reads like go test's.
+func runPrecompiled(t *test) ([]byte, error) {
+	t.jsonOut = nil
+	bin, o, err := t.binaries.get(t)
+	if err != nil {
+		return o, err
+	}
+	if bin.path == "" {
+		return []byte(fmt.Sprintf("?   \t%s\t[no test files]\n", bin.importPath)), nil
+	}
+	args := testBinaryArgs(t)
+	logTrialf(t, "| %s %s", bin.path, strings.Join(args, " "))
+	cmd := exec.Command(bin.path, args...)
+	cmd.Dir = bin.dir
+	cmd.Env = t.environ()
+	start := time.Now()
+	o, err = combinedOutput(t.context(), cmd, t.idleTimeout, t.maxOutput)
+	d := time.Since(start).Seconds()
+	if err != nil {
+		return append(o, fmt.Sprintf("FAIL\t%s\t%.3fs\n", bin.importPath, d)...), err
+	}
+	if bytes.Contains(o, []byte("testing: warning: no tests to run")) {
+		return append(o, fmt.Sprintf("ok  \t%s\t%.3fs [no tests to run]\n", bin.importPath, d)...), nil
+	}
+	return append(o, fmt.Sprintf("ok  \t%s\t%.3fs\n", bin.importPath, d)...), nil
+}
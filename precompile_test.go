@@ -0,0 +1,72 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrecompile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go which logs its arguments, and builds a test binary failing its
+	// first run only
+	fake := filepath.Join(dir, "go")
+	script := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(dir, "args") + `
+if [ "$1" = list ]; then
+	echo github.com/x/eth
+	echo ` + dir + `
+	exit 0
+fi
+cat > "$4" <<'EOF'
+#!/bin/sh
+echo "$@" >> binargs
+echo "=== RUN   TestSync"
+if [ ! -e ran ]; then
+	touch ran
+	echo "--- FAIL: TestSync (0.01s)"
+	echo FAIL
+	exit 1
+fi
+echo "--- PASS: TestSync (0.01s)"
+echo PASS
+EOF
+chmod +x "$4"
+`
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+
+	bins, err := (&Config{Precompile: true}).precompile(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bins.remove()
+	c := make(chan *TestResult, 1)
+	tryIndividualTest(&test{pkg: "./eth", name: "TestSync", dir: dir, trialsAllowed: 3, goJSON: true, binaries: bins}, c)
+	r := <-c
+	if r.Outcome != OutcomeFlaky || r.Trials != 2 {
+		t.Errorf("got: %s after %d trials", r.Outcome, r.Trials)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(args), "test -c"); n != 1 {
+		t.Errorf("built %d times: %s", n, args)
+	}
+	binargs, err := ioutil.ReadFile(filepath.Join(dir, "binargs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-test.v -test.run TestSync\n"; string(binargs) != want+want {
+		t.Errorf("got binary args: %q", binargs)
+	}
+}
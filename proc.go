@@ -0,0 +1,146 @@
+package schroedinger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// outputBuffer collects a command's combined output, calling onWrite
+// on every write. If max is set, only the first and last max/2 bytes are
+// kept, and the rest is counted as elided.
+type outputBuffer struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	onWrite func()
+
+	max int
+	// the last bytes written once buf is full, as a ring starting at tailAt
+	tail   []byte
+	tailAt int
+	elided int64
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.onWrite != nil {
+		b.onWrite()
+	}
+	n := len(p)
+	if b.max <= 0 {
+		return b.buf.Write(p)
+	}
+	if room := b.max/2 - b.buf.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.buf.Write(p[:room])
+		p = p[room:]
+	}
+	for len(p) > 0 {
+		size := b.max - b.max/2
+		if len(b.tail) < size {
+			k := size - len(b.tail)
+			if k > len(p) {
+				k = len(p)
+			}
+			b.tail = append(b.tail, p[:k]...)
+			p = p[k:]
+			continue
+		}
+		// overwrite the oldest bytes
+		k := copy(b.tail[b.tailAt:], p)
+		b.elided += int64(k)
+		b.tailAt = (b.tailAt + k) % size
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (b *outputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.tail) == 0 {
+		return b.buf.Bytes()
+	}
+	tail := append(append([]byte{}, b.tail[b.tailAt:]...), b.tail[:b.tailAt]...)
+	out := append([]byte{}, b.buf.Bytes()...)
+	if b.elided == 0 {
+		return append(out, tail...)
+	}
+	// so the tail starts with a whole line
+	elided := b.elided
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		elided += int64(i + 1)
+		tail = tail[i+1:]
+	}
+	out = append(out, fmt.Sprintf("\n... schroedinger: %d bytes of output elided ...\n", elided)...)
+	return append(out, tail...)
+}
+
+// combinedOutput runs cmd like cmd.CombinedOutput, but kills it, and
+// everything it started, if ctx is done or it goes quiet for longer than
+// idle (if set). If max is set, only about max bytes of the output are
+// kept: the first and the last, which go test reports failures in.
+func combinedOutput(ctx context.Context, cmd *exec.Cmd, idle time.Duration, max int) ([]byte, error) {
+	out := &outputBuffer{max: max}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var killed, cancelled bool
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				mu.Lock()
+				cancelled = true
+				mu.Unlock()
+				killProcessGroup(cmd)
+			case <-stop:
+			}
+		}()
+	}
+	if idle > 0 {
+		timer := time.AfterFunc(idle, func() {
+			mu.Lock()
+			killed = true
+			mu.Unlock()
+			killProcessGroup(cmd)
+		})
+		defer timer.Stop()
+		out.mu.Lock()
+		out.onWrite = func() { timer.Reset(idle) }
+		out.mu.Unlock()
+	}
+
+	err := cmd.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if cancelled {
+		var te *errTrialTimeout
+		if cause := context.Cause(ctx); errors.As(cause, &te) {
+			fmt.Fprintf(out, "\nschroedinger: killed, as it %v\n", te)
+			return out.Bytes(), te
+		}
+		fmt.Fprintf(out, "\nschroedinger: killed, as the run was stopped\n")
+		return out.Bytes(), fmt.Errorf("stopped: %w", ctx.Err())
+	}
+	if killed {
+		msg := fmt.Sprintf("killed after %v without output", idle)
+		fmt.Fprintf(out, "\nschroedinger: %s\n", msg)
+		return out.Bytes(), fmt.Errorf("%s: %v", msg, err)
+	}
+	return out.Bytes(), err
+}
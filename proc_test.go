@@ -0,0 +1,57 @@
+package schroedinger
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCombinedOutputIdle(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	start := time.Now()
+	out, err := combinedOutput(context.Background(), exec.Command("/bin/sh", "-c", "echo hi; sleep 0.1; echo there; sleep 10"), 500*time.Millisecond, 0)
+	if err == nil || !strings.Contains(err.Error(), "without output") {
+		t.Errorf("got: %v, want idle kill", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v, want idle kill at about 600ms", d)
+	}
+	if !strings.HasPrefix(string(out), "hi\nthere\n") {
+		t.Errorf("got: %q", out)
+	}
+
+	out, err = combinedOutput(context.Background(), exec.Command("/bin/sh", "-c", "echo a; sleep 0.2; echo b; sleep 0.2; echo c"), 400*time.Millisecond, 0)
+	if err != nil || string(out) != "a\nb\nc\n" {
+		t.Errorf("got: %q %v, want output and no error", out, err)
+	}
+}
+
+func TestOutputBufferMax(t *testing.T) {
+	b := &outputBuffer{max: 40}
+	b.Write([]byte("head line\nmore head"))
+	if got := string(b.Bytes()); got != "head line\nmore head" {
+		t.Errorf("under max, got: %q", got)
+	}
+	for i := 0; i < 1000; i++ {
+		b.Write([]byte("noise\n"))
+	}
+	b.Write([]byte("--- FAIL: TestX\n"))
+	want := "head line\nmore headn\n... schroedinger: 5999 bytes of output elided ...\n--- FAIL: TestX\n"
+	if got := string(b.Bytes()); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	// unlimited
+	b = &outputBuffer{}
+	for i := 0; i < 1000; i++ {
+		b.Write([]byte("noise\n"))
+	}
+	if n := len(b.Bytes()); n != 6000 {
+		t.Errorf("got %d bytes, want all 6000", n)
+	}
+}
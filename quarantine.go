@@ -0,0 +1,126 @@
+package schroedinger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quarantine is the set of tests listed in a quarantine file, by
+// 'package name' or by name alone, with the trials= given them if any
+type quarantine map[string]int
+
+// readQuarantine reads a file listing a test per line, as 'package name'
+// or just 'name', optionally followed by trials=N, with '#' comments
+func readQuarantine(path string) (quarantine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	q := make(quarantine)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		fields := strings.Fields(line)
+		trials := 0
+		if n := len(fields); n > 1 && strings.HasPrefix(fields[n-1], "trials=") {
+			if trials, err = strconv.Atoi(strings.TrimPrefix(fields[n-1], "trials=")); err != nil || trials < 1 {
+				return nil, fmt.Errorf("%s: bad %s", line, fields[n-1])
+			}
+			fields = fields[:n-1]
+		}
+		switch len(fields) {
+		case 0:
+		case 1:
+			q[fields[0]] = trials
+		default:
+			q[filepath.FromSlash(fields[0])+" "+strings.Join(fields[1:], " ")] = trials
+		}
+	}
+	return q, scanner.Err()
+}
+
+func (q quarantine) has(t *test) bool {
+	_, ok := q.lookup(t)
+	return ok
+}
+
+// trials returns the trials= the quarantine file gives t, 0 if none
+func (q quarantine) trials(t *test) int {
+	n, _ := q.lookup(t)
+	return n
+}
+
+func (q quarantine) lookup(t *test) (int, bool) {
+	if n, ok := q[t.pkg+" "+t.name]; ok {
+		return n, true
+	}
+	if t.name != "" {
+		n, ok := q[t.name]
+		return n, ok
+	}
+	n, ok := q[t.pkg]
+	return n, ok
+}
+
+// WriteQuarantine writes the tests which needed more than one trial to
+// pass to path, as a quarantine file for Config.QuarantineFile, each with
+// one trial more than it took as its trials=, eg.
+//
+//	./eth TestSync trials=4 # passed on trial 3
+//
+// Tests which passed on their first trial this time are left out, so
+// feeding the file back run after run keeps it to the flaky ones.
+func (r *Report) WriteQuarantine(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	r.writeQuarantine(f)
+	return f.Close()
+}
+
+func (r *Report) writeQuarantine(w io.Writer) {
+	fmt.Fprintf(w, "# tests needing more than one trial to pass, written by schroedinger on %s\n", r.Start.Format(time.RFC3339))
+	var add func(t *TestResult)
+	add = func(t *TestResult) {
+		if len(t.Reruns) > 0 {
+			for _, rt := range t.Reruns {
+				add(rt)
+			}
+			return
+		}
+		if t.Outcome != OutcomeFlaky || t.MustFail {
+			return
+		}
+		line := strings.TrimSpace(filepath.ToSlash(t.Package) + " " + t.Name)
+		fmt.Fprintf(w, "%s trials=%d # passed on trial %d\n", line, t.Trials+1, t.Trials)
+	}
+	for _, t := range r.Tests {
+		add(t)
+	}
+}
+
+// quarantineSummary returns a one line count of the outcomes of the
+// quarantined tests, or "" if there are none
+func (r *Report) quarantineSummary() string {
+	counts := make(map[Outcome]int)
+	n := 0
+	for _, t := range r.Tests {
+		if t.Quarantined {
+			counts[t.Outcome]++
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("QUARANTINED (not counted) pass: %d, flaky: %d, fail: %d, skip: %d",
+		counts[OutcomePass], counts[OutcomeFlaky], counts[OutcomeFail], counts[OutcomeSkip])
+}
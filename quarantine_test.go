@@ -0,0 +1,105 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "quarantine.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync # #123\nTestDial\n\n# ./p2p TestPeer\n./les\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q, err := readQuarantine(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		pkg, name string
+		want      bool
+	}{
+		{"./eth", "TestSync", true},
+		{"./eth", "TestFetch", false},
+		{"./p2p", "TestDial", true},
+		{"./p2p", "TestPeer", false},
+		{"./les", "", true},
+		{"./les", "TestServe", false},
+	}
+	for _, c := range cases {
+		if got := q.has(&test{pkg: c.pkg, name: c.name}); got != c.want {
+			t.Errorf("%s %s: got: %v, want: %v", c.pkg, c.name, got, c.want)
+		}
+	}
+
+	report := &Report{Tests: []*TestResult{
+		{Outcome: OutcomePass},
+		{Outcome: OutcomeFail, Quarantined: true},
+		{Outcome: OutcomeFlaky, Quarantined: true},
+	}}
+	if counts := report.Counts(); counts[OutcomeFail] != 0 || counts[OutcomePass] != 1 {
+		t.Errorf("counts: got: %v, want quarantined tests left out", counts)
+	}
+	want := "QUARANTINED (not counted) pass: 0, flaky: 1, fail: 1, skip: 0"
+	if got := report.quarantineSummary(); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestWriteQuarantine(t *testing.T) {
+	report := &Report{Tests: []*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomeFlaky, Trials: 3},
+		{Package: "./eth", Name: "TestFetch", Outcome: OutcomePass, Trials: 1},
+		{Package: "./p2p", Outcome: OutcomeFail, Trials: 3, Reruns: []*TestResult{
+			{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFlaky, Trials: 2},
+			{Package: "./p2p", Name: "TestPeer", Outcome: OutcomeFail, Trials: 3},
+		}},
+	}}
+	f := filepath.Join(t.TempDir(), "quarantine.txt")
+	if err := report.WriteQuarantine(f); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(b), "\n")
+	if want := []string{"./eth TestSync trials=4 # passed on trial 3", "./p2p TestDial trials=3 # passed on trial 2", ""}; len(lines) != 4 || strings.Join(lines[1:], "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s", b)
+	}
+
+	q, err := readQuarantine(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt := (&test{pkg: "./eth", name: "TestSync"}); !q.has(tt) || q.trials(tt) != 4 {
+		t.Errorf("read back: %v", q)
+	}
+	if tt := (&test{pkg: "./eth", name: "TestFetch"}); q.has(tt) || q.trials(tt) != 0 {
+		t.Errorf("read back: %v", q)
+	}
+}
+
+func TestQuarantineTrials(t *testing.T) {
+	dir := t.TempDir()
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync cmd=true\n./eth TestFetch cmd=true trials=6\n./p2p TestDial cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	q := filepath.Join(dir, "quarantine.txt")
+	if err := ioutil.WriteFile(q, []byte("TestSync trials=5\nTestFetch trials=4\nTestDial trials=5\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, QuarantineFile: q, TrialsAllowed: 3, TrialsFor: map[string]int{"TestDial": 2}}
+	tests, err := c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"TestSync": 5, "TestFetch": 6, "TestDial": 2}
+	for _, tt := range tests {
+		if tt.trialsAllowed != want[tt.name] {
+			t.Errorf("%s: got %d trials, want %d", tt, tt.trialsAllowed, want[tt.name])
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// eg. 'WARNING: DATA RACE', starting a report of the race detector
+const dataRaceLine = "WARNING: DATA RACE"
+
+// grepRace reports whether go test -race output holds a data race, and
+// the function of the first access of the first race, if found, eg.
+// 'github.com/ethereumproject/go-ethereum/eth.(*peer).send'
+func grepRace(gotestout []byte) (bool, string) {
+	if !bytes.Contains(gotestout, []byte(dataRaceLine)) {
+		return false, ""
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	scanner.Buffer(nil, maxLineSize)
+	in, access := false, false
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == dataRaceLine:
+			in = true
+		// eg. 'Write at 0x00c0000a0010 by goroutine 8:'
+		case in && (strings.HasPrefix(text, "Write at ") || strings.HasPrefix(text, "Read at ")):
+			access = true
+		case access:
+			if f := panicFrame([]string{text}); f != "" {
+				return true, f
+			}
+		}
+	}
+	return true, ""
+}
+
+// noteRace records a data race in the output of a failed trial on r, and
+// reports whether there was one
+func (r *TestResult) noteRace(o []byte) bool {
+	race, _ := grepRace(o)
+	if race {
+		r.Race = true
+	}
+	return race
+}
+
+// raceSummary lists the tests which hit a data race, if any
+func (r *Report) raceSummary() string {
+	var names []string
+	var add func(*TestResult)
+	add = func(t *TestResult) {
+		if len(t.Reruns) > 0 {
+			for _, rr := range t.Reruns {
+				add(rr)
+			}
+			return
+		}
+		if t.Race {
+			names = append(names, t.String())
+		}
+	}
+	for _, t := range r.Tests {
+		add(t)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("DATA RACES in %d tests: %s", len(names), strings.Join(names, ", "))
+}
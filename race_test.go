@@ -0,0 +1,75 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const raceOutput = `=== RUN   TestSync
+==================
+WARNING: DATA RACE
+Write at 0x00c0000a0010 by goroutine 8:
+  github.com/x/eth.(*peer).send()
+      /src/eth/peer.go:12 +0x39
+
+Previous read at 0x00c0000a0010 by goroutine 7:
+  github.com/x/eth.(*peer).recv()
+      /src/eth/peer.go:20 +0x3e
+==================
+    testing.go:1465: race detected during execution of test
+--- FAIL: TestSync (0.01s)
+FAIL
+`
+
+func TestGrepRace(t *testing.T) {
+	if race, f := grepRace([]byte(raceOutput)); !race || f != "github.com/x/eth.(*peer).send" {
+		t.Errorf("got: %v, %q", race, f)
+	}
+	if race, _ := grepRace([]byte("--- FAIL: TestSync (0.01s)\n")); race {
+		t.Error("got a race without one")
+	}
+	if got := failureSignature([]byte(raceOutput), nil); got != "data race in github.com/x/eth.(*peer).send" {
+		t.Errorf("got signature: %q", got)
+	}
+}
+
+func TestRaceNotRetried(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go which logs its arguments, and races
+	fake := filepath.Join(dir, "go")
+	script := "#!/bin/sh\necho \"$@\" >> " + filepath.Join(dir, "args") + "\ncat <<'EOF'\n" + raceOutput + "EOF\nexit 1\n"
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+
+	c := make(chan *TestResult, 1)
+	tryIndividualTest(&test{pkg: "./eth", name: "TestSync", dir: dir, trialsAllowed: 3, race: true}, c)
+	r := <-c
+	if r.Outcome != OutcomeFail || r.Trials != 1 || !r.Race {
+		t.Errorf("got: %s after %d trials, race: %v", r.Outcome, r.Trials, r.Race)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), " -race") {
+		t.Errorf("got args: %s", args)
+	}
+	report := &Report{Tests: []*TestResult{r, {Package: "./p2p", Name: "TestDial"}}}
+	if got := report.raceSummary(); got != "DATA RACES in 1 tests: ./eth TestSync" {
+		t.Errorf("got: %q", got)
+	}
+
+	tryIndividualTest(&test{pkg: "./eth", name: "TestSync", dir: dir, trialsAllowed: 3, retryRaces: true}, c)
+	if r := <-c; r.Trials != 3 || !r.Race {
+		t.Errorf("retried: got %d trials, race: %v", r.Trials, r.Race)
+	}
+}
@@ -0,0 +1,476 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportSchema is bumped whenever the JSON layout of Report changes incompatibly.
+const reportSchema = 2
+
+// Outcome is the final state of a test.
+type Outcome string
+
+const (
+	// passed on the first trial
+	OutcomePass Outcome = "pass"
+	// passed, but only after failing at least once
+	OutcomeFlaky Outcome = "flaky"
+	// did not pass within the allowed trials
+	OutcomeFail Outcome = "fail"
+	// ran, but was skipped, had no tests, or came from the go test cache
+	OutcomeSkip Outcome = "skip"
+	// not run, because it passed in a previous run (see Config.StateFile)
+	OutcomeResumed Outcome = "resumed"
+	// not run, because its packages didn't change (see Config.ChangedSince)
+	OutcomeUnchanged Outcome = "unchanged"
+	// not run, because it passed on its first trial before and its packages
+	// didn't change since (see Config.SkipStable)
+	OutcomeStable Outcome = "stable"
+)
+
+// TestResult records how a single test (or package) fared.
+// Durations are in nanoseconds.
+type TestResult struct {
+	Package        string          `json:"package"`
+	Name           string          `json:"name,omitempty"`
+	Outcome        Outcome         `json:"outcome"`
+	Trials         int             `json:"trials"`
+	Duration       time.Duration   `json:"duration"`
+	TrialDurations []time.Duration `json:"trialDurations"`
+	// the outcome of each trial, in order: pass, fail or skip; the trials
+	// of a mustfail test fail as it expects
+	TrialOutcomes []Outcome `json:"trialOutcomes,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	BuildFailed   bool      `json:"buildFailed,omitempty"`
+
+	// trials passed, for tests run with minpasses
+	Passes int `json:"passes,omitempty"`
+
+	// the test must fail: its outcome passes if every trial failed,
+	// and fails if any trial passed
+	MustFail bool `json:"mustFail,omitempty"`
+
+	// the test ran as usual, but its outcome doesn't count towards that of
+	// the run, nor in Counts
+	Quarantined bool `json:"quarantined,omitempty"`
+
+	// best ns/op measured over the trials of a benchmark
+	NsPerOp float64 `json:"nsPerOp,omitempty"`
+
+	// the last panic or fatal runtime error seen in a trial, with its
+	// goroutine dump, and the test it happened in if known
+	Panic   string `json:"panic,omitempty"`
+	PanicIn string `json:"panicIn,omitempty"`
+
+	// a trial hit a data race, see Config.Race
+	Race bool `json:"race,omitempty"`
+
+	// a trial ran into go test -timeout, or was killed for running past
+	// it, see Config.GoTestTimeout
+	TimedOut bool `json:"timedOut,omitempty"`
+
+	// how each failed trial failed
+	Failures []TrialFailure `json:"failures,omitempty"`
+
+	// files holding the output of each failed trial, in the order of
+	// Failures, with Config.OutputDir
+	OutputFiles []string `json:"outputFiles,omitempty"`
+
+	// when the test reached its outcome; the tests of a report are in the
+	// order they're listed in, not the order they finished in
+	Finished time.Time `json:"finished"`
+
+	// failing tests discovered in a package run, and how their reruns went
+	Reruns []*TestResult `json:"reruns,omitempty"`
+
+	err error
+	// output of the last trial
+	output []byte
+	// output of each of Failures
+	failureOutputs [][]byte
+	// profile written by the last trial, see Config.CoverProfile
+	coverProfile string
+	// how the last trial of a failed test was run
+	repro *Repro
+	// what was logged about the test, with Config.OrderedOutput
+	ordered *testLog
+}
+
+// Report is the result of a whole run.
+type Report struct {
+	Schema        int           `json:"schema"`
+	TestsFiles    []string      `json:"testsFiles"`
+	Whitelist     []string      `json:"whitelist"`
+	Blacklist     []string      `json:"blacklist"`
+	TrialsAllowed int           `json:"trialsAllowed"`
+	Seed          int64         `json:"seed,omitempty"`
+	Shard         string        `json:"shard,omitempty"`
+	Coverage      float64       `json:"coverage,omitempty"`
+	Start         time.Time     `json:"start"`
+	Duration      time.Duration `json:"duration"`
+	// the sum of the durations of every trial run
+	TrialsDuration time.Duration `json:"trialsDuration"`
+	Setup          []*HookResult `json:"setup,omitempty"`
+	Teardown       []*HookResult `json:"teardown,omitempty"`
+	Tests          []*TestResult `json:"tests"`
+	Error          string        `json:"error,omitempty"`
+
+	// why the run stopped before every test had finished, if it did, and
+	// the tests which hadn't: never started, or killed
+	Stopped string   `json:"stopped,omitempty"`
+	NotRun  []string `json:"notRun,omitempty"`
+
+	// the failed trials of every test, grouped by how they failed
+	Failures []*FailureGroup `json:"failures,omitempty"`
+}
+
+// TrialFailure is how a trial failed, see failureSignature.
+type TrialFailure struct {
+	Trial     int    `json:"trial"`
+	Signature string `json:"signature"`
+}
+
+// FailureGroup is a way trials failed, shared by one or more tests.
+type FailureGroup struct {
+	Signature string `json:"signature"`
+	// trials which failed this way
+	Count int `json:"count"`
+	// the tests they were trials of, eg. './eth TestSync (trials 1, 3)'
+	Tests []string `json:"tests"`
+}
+
+func newReport(testsFiles []string, whites, blacks []string, trials int) *Report {
+	return &Report{
+		Schema:        reportSchema,
+		TestsFiles:    testsFiles,
+		Whitelist:     whites,
+		Blacklist:     blacks,
+		TrialsAllowed: trials,
+		Start:         time.Now(),
+		Tests:         []*TestResult{},
+	}
+}
+
+func (r *Report) setError(e error) {
+	if e != nil {
+		r.Error = e.Error()
+	}
+}
+
+// stop notes that the run stopped early for the given reason, before
+// those of tests without a result had finished
+func (r *Report) stop(reason string, tests []*test) {
+	r.Stopped = reason
+	done := make(map[string]bool)
+	for _, tr := range r.Tests {
+		done[tr.Package+" "+tr.Name] = true
+	}
+	for _, t := range tests {
+		if !done[t.pkg+" "+t.name] {
+			r.NotRun = append(r.NotRun, strings.TrimSpace(t.String()))
+		}
+	}
+}
+
+// WriteFile writes the report as indented JSON to path.
+func (r *Report) WriteFile(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// Counts returns the number of tests with each outcome, leaving out
+// quarantined tests.
+func (r *Report) Counts() map[Outcome]int {
+	counts := make(map[Outcome]int)
+	for _, t := range r.Tests {
+		if !t.Quarantined {
+			counts[t.Outcome]++
+		}
+	}
+	return counts
+}
+
+// Names returns the names of the tests with the given outcome.
+func (r *Report) Names(o Outcome) []string {
+	var names []string
+	for _, t := range r.Tests {
+		if t.Outcome == o {
+			names = append(names, t.String())
+		}
+	}
+	return names
+}
+
+// unsettled reports whether t failed or was flaky in the report
+func (r *Report) unsettled(t *test) bool {
+	for _, tr := range r.Tests {
+		if tr.Package == t.pkg && tr.Name == t.name {
+			return tr.Outcome == OutcomeFail || tr.Outcome == OutcomeFlaky
+		}
+	}
+	return false
+}
+
+// FlakyRate returns the share of the tests which ran that were flaky:
+// flaky / (pass + flaky + fail). Tests which were skipped or not run don't
+// count. It is 0 if no tests ran.
+func (r *Report) FlakyRate() float64 {
+	counts := r.Counts()
+	ran := counts[OutcomePass] + counts[OutcomeFlaky] + counts[OutcomeFail]
+	if ran == 0 {
+		return 0
+	}
+	return float64(counts[OutcomeFlaky]) / float64(ran)
+}
+
+// sortTests puts the tests in the order of the given tests, and any others
+// after them by name, so reports of runs compare line by line however the
+// tests happened to finish
+func (r *Report) sortTests(order []*test) {
+	index := make(map[string]int)
+	for i, t := range order {
+		index[t.pkg+" "+t.name] = i
+	}
+	sort.SliceStable(r.Tests, func(i, j int) bool {
+		a, b := r.Tests[i], r.Tests[j]
+		ia, aok := index[a.Package+" "+a.Name]
+		ib, bok := index[b.Package+" "+b.Name]
+		switch {
+		case aok && bok:
+			return ia < ib
+		case aok != bok:
+			return aok
+		}
+		return a.String() < b.String()
+	})
+}
+
+// GroupFailures groups the failed trials of the tests, and of the reruns of
+// their failing tests, by signature, most frequent first.
+func (r *Report) GroupFailures() []*FailureGroup {
+	groups := make(map[string]*FailureGroup)
+	var order []*FailureGroup
+	var walk func(tests []*TestResult)
+	walk = func(tests []*TestResult) {
+		for _, t := range tests {
+			trials := make(map[string][]string)
+			var sigs []string
+			for _, f := range t.Failures {
+				if _, ok := trials[f.Signature]; !ok {
+					sigs = append(sigs, f.Signature)
+				}
+				trials[f.Signature] = append(trials[f.Signature], strconv.Itoa(f.Trial))
+			}
+			for _, sig := range sigs {
+				g := groups[sig]
+				if g == nil {
+					g = &FailureGroup{Signature: sig}
+					groups[sig] = g
+					order = append(order, g)
+				}
+				g.Count += len(trials[sig])
+				label := "trial"
+				if len(trials[sig]) > 1 {
+					label = "trials"
+				}
+				g.Tests = append(g.Tests, fmt.Sprintf("%s %s (%s %s)", t.Package, t.Name, label, strings.Join(trials[sig], ", ")))
+			}
+			walk(t.Reruns)
+		}
+	}
+	walk(r.Tests)
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].Count > order[j].Count
+	})
+	return order
+}
+
+// Slowest returns the n tests which took longest over all their trials.
+func (r *Report) Slowest(n int) []*TestResult {
+	tests := make([]*TestResult, len(r.Tests))
+	copy(tests, r.Tests)
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Duration > tests[j].Duration
+	})
+	if n < len(tests) {
+		tests = tests[:n]
+	}
+	return tests
+}
+
+func (r *Report) trialsDuration() time.Duration {
+	var d time.Duration
+	var add func(*TestResult)
+	add = func(t *TestResult) {
+		for _, td := range t.TrialDurations {
+			d += td
+		}
+		for _, rr := range t.Reruns {
+			add(rr)
+		}
+	}
+	for _, t := range r.Tests {
+		add(t)
+	}
+	return d
+}
+
+// Summary returns a one line count of the outcomes.
+func (r *Report) Summary() string {
+	counts := r.Counts()
+	return fmt.Sprintf("SUMMARY pass: %d, flaky: %d, fail: %d, skip: %d, resumed (not run): %d, unchanged (not run): %d, stable (not run): %d",
+		counts[OutcomePass], counts[OutcomeFlaky], counts[OutcomeFail], counts[OutcomeSkip], counts[OutcomeResumed], counts[OutcomeUnchanged], counts[OutcomeStable])
+}
+
+// JSONSummary is the one line summary of a run written with
+// Config.JSONSummary, with the counts of Report.Summary. Quarantined tests
+// aren't counted, and Success is whether Run exits with ExitOK.
+type JSONSummary struct {
+	Passed     int   `json:"passed"`
+	Flaky      int   `json:"flaky"`
+	Failed     int   `json:"failed"`
+	Skipped    int   `json:"skipped"`
+	Resumed    int   `json:"resumed"`
+	Unchanged  int   `json:"unchanged"`
+	Stable     int   `json:"stable"`
+	DurationMs int64 `json:"duration_ms"`
+	Success    bool  `json:"success"`
+}
+
+// writeJSONSummary writes the summary of a run which exits with code to w,
+// as a line of JSON
+func writeJSONSummary(w io.Writer, r *Report, code int) error {
+	s := JSONSummary{Success: code == ExitOK}
+	if r != nil {
+		counts := r.Counts()
+		s.Passed = counts[OutcomePass]
+		s.Flaky = counts[OutcomeFlaky]
+		s.Failed = counts[OutcomeFail]
+		s.Skipped = counts[OutcomeSkip]
+		s.Resumed = counts[OutcomeResumed]
+		s.Unchanged = counts[OutcomeUnchanged]
+		s.Stable = counts[OutcomeStable]
+		s.DurationMs = int64(r.Duration / time.Millisecond)
+	}
+	return json.NewEncoder(w).Encode(s)
+}
+
+func (r *TestResult) String() string {
+	s := strings.TrimSpace(r.Package + " " + r.Name)
+	if r.MustFail {
+		s += " [must fail]"
+	}
+	if r.Quarantined {
+		s += " [quarantined]"
+	}
+	return s
+}
+
+func newTestResult(t *test) *TestResult {
+	return &TestResult{Package: t.pkg, Name: t.name, MustFail: t.mustFail, Quarantined: t.quarantined, Tags: t.tags, ordered: t.ordered}
+}
+
+func newResumedResult(t *test) *TestResult {
+	r := newTestResult(t)
+	r.Outcome = OutcomeResumed
+	r.Finished = time.Now()
+	return r
+}
+
+func newUnchangedResult(t *test) *TestResult {
+	r := newTestResult(t)
+	r.Outcome = OutcomeUnchanged
+	r.Finished = time.Now()
+	return r
+}
+
+func newStableResult(t *test) *TestResult {
+	r := newTestResult(t)
+	r.Outcome = OutcomeStable
+	r.Finished = time.Now()
+	return r
+}
+
+func (r *TestResult) addTrial(d time.Duration, o []byte, outcome Outcome) {
+	r.TrialDurations = append(r.TrialDurations, d)
+	r.TrialOutcomes = append(r.TrialOutcomes, outcome)
+	r.output = o
+	r.Duration += d
+}
+
+// failTrial marks the latest trial failed, though go test passed, eg. a
+// benchmark too slow
+func (r *TestResult) failTrial() {
+	if n := len(r.TrialOutcomes); n > 0 {
+		r.TrialOutcomes[n-1] = OutcomeFail
+	}
+}
+
+// trialOutcome returns the outcome of a trial of t which ended with err
+// and output o
+func trialOutcome(t *test, o []byte, err error) Outcome {
+	switch {
+	case err != nil:
+		return OutcomeFail
+	case t.skipped(o):
+		return OutcomeSkip
+	}
+	return OutcomePass
+}
+
+// noteFailure records how trial number t.trials failed, and reports whether
+// an earlier trial of the test failed the same way
+func (r *TestResult) noteFailure(t *test, o []byte, e error) (TrialFailure, bool) {
+	var te *errTrialTimeout
+	if errors.As(e, &te) {
+		r.TimedOut = true
+	}
+	f := TrialFailure{Trial: t.trials, Signature: failureSignature(o, e)}
+	r.failureOutputs = append(r.failureOutputs, o)
+	for _, prev := range r.Failures {
+		if prev.Signature == f.Signature {
+			r.Failures = append(r.Failures, f)
+			return prev, true
+		}
+	}
+	r.Failures = append(r.Failures, f)
+	return f, false
+}
+
+func (r *TestResult) finish(t *test) {
+	r.Trials = t.trials
+	r.coverProfile = t.coverProfile
+}
+
+func (r *TestResult) pass(t *test) {
+	r.finish(t)
+	r.Outcome = OutcomePass
+	if t.trials > 1 || len(r.Reruns) > 0 {
+		r.Outcome = OutcomeFlaky
+	}
+}
+
+func (r *TestResult) skip(t *test) {
+	r.finish(t)
+	r.Outcome = OutcomeSkip
+}
+
+func (r *TestResult) fail(t *test, e error) {
+	r.finish(t)
+	r.Outcome = OutcomeFail
+	r.repro = newRepro(t, e)
+	r.err = failError(r, e)
+	r.Error = e.Error()
+}
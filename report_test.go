@@ -0,0 +1,133 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReportWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := newReport([]string{"tests.txt"}, []string{"sync"}, nil, 3)
+	tr := newTestResult(&test{pkg: "./eth", name: "TestSync"})
+	tr.addTrial(time.Second, nil, OutcomeFail)
+	tr.addTrial(2*time.Second, nil, OutcomePass)
+	tr.pass(&test{trials: 2})
+	r.Tests = append(r.Tests, tr)
+
+	p := filepath.Join(dir, "report.json")
+	if err := r.WriteFile(p); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["schema"] != float64(reportSchema) {
+		t.Errorf("got schema: %v, want: %v", got["schema"], reportSchema)
+	}
+	tests := got["tests"].([]interface{})
+	if o := tests[0].(map[string]interface{})["outcome"]; o != string(OutcomeFlaky) {
+		t.Errorf("got outcome: %v, want: %v", o, OutcomeFlaky)
+	}
+}
+
+func TestReportSlowest(t *testing.T) {
+	r := &Report{Tests: []*TestResult{
+		{Name: "A", Duration: time.Second, TrialDurations: []time.Duration{time.Second}},
+		{Name: "B", Duration: 3 * time.Second, TrialDurations: []time.Duration{time.Second, 2 * time.Second}},
+		{Name: "C", Duration: 2 * time.Second, TrialDurations: []time.Duration{time.Second},
+			Reruns: []*TestResult{{TrialDurations: []time.Duration{time.Second}}}},
+	}}
+	got := r.Slowest(2)
+	if len(got) != 2 || got[0].Name != "B" || got[1].Name != "C" {
+		t.Errorf("got: %v, want: [B C]", got)
+	}
+	if len(r.Slowest(10)) != 3 {
+		t.Error("want all tests when n exceeds them")
+	}
+	if d := r.trialsDuration(); d != 6*time.Second {
+		t.Errorf("got: %v, want: 6s", d)
+	}
+}
+
+func TestReportUnsettled(t *testing.T) {
+	r := &Report{Tests: []*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomeFail},
+		{Package: "./eth", Name: "TestFetch", Outcome: OutcomePass},
+		{Package: "./p2p/...", Outcome: OutcomeFlaky},
+		{Package: "./les", Outcome: OutcomeSkip},
+	}}
+	tests := []*test{
+		{pkg: "./eth", name: "TestSync"},
+		{pkg: "./eth", name: "TestFetch"},
+		{pkg: "./p2p/..."},
+		{pkg: "./les"},
+		// not in the report
+		{pkg: "./core"},
+	}
+	var got []string
+	for _, tt := range filterTests(tests, r.unsettled) {
+		got = append(got, tt.String())
+	}
+	want := []string{"./eth TestSync", "./p2p/... "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestReportSortTests(t *testing.T) {
+	order := []*test{{pkg: "./p2p", name: "TestDial"}, {pkg: "./eth"}, {pkg: "./eth", name: "TestSync"}}
+	r := &Report{Tests: []*TestResult{
+		{Package: "./eth", Name: "TestSync"},
+		{Package: "./z", Name: "TestUnlisted"},
+		{Package: "./eth"},
+		{Package: "./a", Name: "TestUnlisted"},
+		{Package: "./p2p", Name: "TestDial"},
+	}}
+	r.sortTests(order)
+	var got []string
+	for _, tr := range r.Tests {
+		got = append(got, tr.String())
+	}
+	want := []string{"./p2p TestDial", "./eth", "./eth TestSync", "./a TestUnlisted", "./z TestUnlisted"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
+func TestReportGroupFailures(t *testing.T) {
+	boom := "panic: boom"
+	peers := "sync_test.go:42: got N peers"
+	r := &Report{Tests: []*TestResult{
+		{Package: "./eth", Name: "TestSync", Failures: []TrialFailure{{1, peers}, {2, boom}, {3, peers}}},
+		{Package: "./p2p", Reruns: []*TestResult{
+			{Package: "./p2p", Name: "TestDial", Failures: []TrialFailure{{1, boom}, {2, boom}}},
+		}},
+		{Package: "./les", Name: "TestServe", Failures: []TrialFailure{{1, peers}}},
+	}}
+	// ties keep the order the signatures were first seen in
+	want := []*FailureGroup{
+		{Signature: peers, Count: 3, Tests: []string{"./eth TestSync (trials 1, 3)", "./les TestServe (trial 1)"}},
+		{Signature: boom, Count: 3, Tests: []string{"./eth TestSync (trial 2)", "./p2p TestDial (trials 1, 2)"}},
+	}
+	got := r.GroupFailures()
+	if !reflect.DeepEqual(got, want) {
+		for _, g := range got {
+			t.Errorf("got: %+v", g)
+		}
+	}
+}
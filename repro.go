@@ -0,0 +1,146 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Repro records how a test was run when it last failed, so the failure can
+// be replayed in the same context.
+type Repro struct {
+	Package string `json:"package"`
+	Name    string `json:"name,omitempty"`
+
+	// shell command line, and the directory it was run from
+	Command string `json:"command"`
+	Dir     string `json:"dir"`
+
+	// the go related environment, eg. GOFLAGS, GOARCH and CGO_ENABLED, and
+	// the test's env= options
+	Env []string `json:"env,omitempty"`
+
+	// shuffle seed of the run, if shuffled, and the trial which failed
+	Seed  int64 `json:"seed,omitempty"`
+	Trial int   `json:"trial"`
+
+	Error string `json:"error"`
+}
+
+func newRepro(t *test, e error) *Repro {
+	dir, _ := filepath.Abs(t.lastDir)
+	var env []string
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, "GO") || strings.HasPrefix(kv, "CGO_") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, t.vars...)
+	return &Repro{
+		Package: t.pkg,
+		Name:    t.name,
+		Command: t.lastCmd,
+		Dir:     dir,
+		Env:     env,
+		Trial:   t.trials,
+		Error:   e.Error(),
+	}
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// writeRepros writes a repro file into dir for each hard failure in r,
+// that is r itself or, for a package, the reruns which failed
+func writeRepros(l Logger, dir string, r *TestResult, seed int64) error {
+	if r.Outcome != OutcomeFail {
+		return nil
+	}
+	if len(r.Reruns) > 0 {
+		for _, rr := range r.Reruns {
+			if err := writeRepros(l, dir, rr, seed); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if r.repro == nil || r.repro.Command == "" {
+		return nil
+	}
+	r.repro.Seed = seed
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r.repro, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := "repro-" + unsafeFileChars.ReplaceAllString(r.String(), "_") + ".json"
+	path := filepath.Join(dir, name)
+	l.Printf("* repro: %s", path)
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// writeTrialOutputs writes the output of each failed trial of r, and of its
+// reruns, into dir as <test>.trial-<n>.log, and records the paths in their
+// OutputFiles
+func writeTrialOutputs(dir string, r *TestResult) error {
+	for _, rr := range r.Reruns {
+		if err := writeTrialOutputs(dir, rr); err != nil {
+			return err
+		}
+	}
+	if len(r.failureOutputs) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, o := range r.failureOutputs {
+		name := fmt.Sprintf("%s.trial-%d.log", unsafeFileChars.ReplaceAllString(r.String(), "_"), r.Failures[i].Trial)
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, o, 0644); err != nil {
+			return err
+		}
+		r.OutputFiles = append(r.OutputFiles, path)
+	}
+	return nil
+}
+
+// ReadRepro reads a repro file written for a failed test.
+func ReadRepro(path string) (*Repro, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Repro{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if r.Command == "" {
+		return nil, fmt.Errorf("%s: no command", path)
+	}
+	return r, nil
+}
+
+// Replay runs the test of r once more, with the same command, directory and
+// environment, writing its output to w and logging as a run of c would. It
+// returns an error if it failed.
+func Replay(c *Config, r *Repro, w io.Writer) error {
+	c.logf("REPLAY %s %s (failed trial %d: %s)", r.Package, r.Name, r.Trial, r.Error)
+	if r.Seed != 0 {
+		c.logln("* the run was shuffled with seed:", r.Seed)
+	}
+	c.logf("| %s %s %s", commandPrefix[0], commandPrefix[1], r.Command)
+	cmd := exec.Command(commandPrefix[0], commandPrefix[1], r.Command)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), r.Env...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+	return cmd.Run()
+}
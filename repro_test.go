@@ -0,0 +1,70 @@
+package schroedinger
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReproReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tt := &test{pkg: "./eth", name: "TestSync/fast", trials: 3,
+		lastCmd: "echo replayed", lastDir: dir}
+	r := newTestResult(tt)
+	r.fail(tt, errors.New("FAIL ./eth TestSync/fast"))
+	if err := writeRepros(log.Default(), dir, r, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	repro, err := ReadRepro(filepath.Join(dir, "repro-._eth_TestSync_fast.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repro.Command != "echo replayed" || repro.Dir != dir || repro.Seed != 42 || repro.Trial != 3 {
+		t.Errorf("got: %+v", repro)
+	}
+	var out, logs bytes.Buffer
+	c := &Config{log: newRunLogger(log.New(&logs, "", 0))}
+	if err := Replay(c, repro, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "replayed\n" && got != "replayed\r\n" {
+		t.Errorf("got output: %q", got)
+	}
+	if !strings.HasPrefix(logs.String(), "REPLAY ./eth TestSync/fast (failed trial 3") {
+		t.Errorf("got log: %q", logs.String())
+	}
+
+	repro.Command = "exit 1"
+	if err := Replay(c, repro, &out); err == nil {
+		t.Error("want replay of a failing command to fail")
+	}
+}
+
+func TestWriteTrialOutputs(t *testing.T) {
+	dir := t.TempDir()
+	tt := &test{pkg: "./p2p", name: "TestDial", trials: 2}
+	rr := newTestResult(tt)
+	rr.noteFailure(tt, []byte("dial failed\n"), errors.New("exit status 1"))
+	r := &TestResult{Package: "./p2p", Reruns: []*TestResult{rr}}
+	if err := writeTrialOutputs(dir, r); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "._p2p_TestDial.trial-2.log")
+	if len(rr.OutputFiles) != 1 || rr.OutputFiles[0] != want || len(r.OutputFiles) != 0 {
+		t.Fatalf("got: %v, %v", rr.OutputFiles, r.OutputFiles)
+	}
+	if b, err := ioutil.ReadFile(want); err != nil || string(b) != "dial failed\n" {
+		t.Errorf("got: %q, %v", b, err)
+	}
+}
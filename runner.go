@@ -0,0 +1,151 @@
+package schroedinger
+
+import (
+	"context"
+	"io"
+	"log"
+	"runtime"
+	"sync"
+)
+
+// runMu serializes runs: a run sets up state of the package, eg. where
+// output goes and the go executable, for its duration
+var runMu sync.Mutex
+
+// Runner runs tests from within another program, rather than from the
+// command line. Make one with NewRunner.
+//
+//	r := schroedinger.NewRunner(
+//		schroedinger.WithTestsFiles("tests.txt"),
+//		schroedinger.WithTrials(5),
+//		schroedinger.WithMaxParallel(4),
+//	)
+//	report, err := r.Run(ctx)
+type Runner struct {
+	config Config
+	// where the log and the output of trials go, if not the defaults
+	logger      Logger
+	trialOutput io.Writer
+}
+
+// Option configures a Runner.
+type Option func(*Runner)
+
+// NewRunner returns a Runner with the same defaults as the command line:
+// three trials, as many tests at once as CPUs, go test -count=1 and -json,
+// failing when no tests match and stopping at the first failed test. Options are applied in order.
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{config: Config{
+		TrialsAllowed: 3,
+		DisableCache:  true,
+		GoTestJSON:    true,
+		FailOnNoMatch: true,
+		MaxFailures:   1,
+		MaxParallel:   runtime.NumCPU(),
+	}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithConfig replaces the whole configuration with a copy of c; options
+// after it adjust the copy.
+func WithConfig(c Config) Option {
+	return func(r *Runner) { r.config = c }
+}
+
+// WithTestsFiles adds files listing tests to run.
+func WithTestsFiles(paths ...string) Option {
+	return func(r *Runner) { r.config.TestsFiles = append(r.config.TestsFiles, paths...) }
+}
+
+// WithDiscover runs the packages with tests matching pattern, eg. './...',
+// besides those of the tests files; see Config.Discover.
+func WithDiscover(pattern string) Option {
+	return func(r *Runner) { r.config.Discover = pattern }
+}
+
+// WithTrials sets the number of times to try a failing test, for tests
+// without trials of their own.
+func WithTrials(n int) Option {
+	return func(r *Runner) { r.config.TrialsAllowed = n }
+}
+
+// WithWhitelist runs only the tests whose lines match one of the
+// comma-separated patterns, as -w.
+func WithWhitelist(patterns string) Option {
+	return func(r *Runner) { r.config.WhitelistMatch = patterns }
+}
+
+// WithBlacklist leaves out the tests whose lines match one of the
+// comma-separated patterns, as -b.
+func WithBlacklist(patterns string) Option {
+	return func(r *Runner) { r.config.BlacklistMatch = patterns }
+}
+
+// WithTags runs only the tests carrying any of the include tags, if any,
+// and none of the exclude tags.
+func WithTags(include, exclude []string) Option {
+	return func(r *Runner) {
+		r.config.TagsInclude = include
+		r.config.TagsExclude = exclude
+	}
+}
+
+// WithMaxParallel bounds the number of tests running at once; 0 for no
+// limit.
+func WithMaxParallel(n int) Option {
+	return func(r *Runner) { r.config.MaxParallel = n }
+}
+
+// WithLogOutput sends the log of the run to w rather than to the standard
+// logger's output, with the standard logger's prefix and flags.
+func WithLogOutput(w io.Writer) Option {
+	return func(r *Runner) { r.logger = log.New(w, log.Prefix(), log.Flags()) }
+}
+
+// WithLogger sends the log of the run to l rather than to the standard
+// logger, eg. SlogLogger(slog.Default()).
+func WithLogger(l Logger) Option {
+	return func(r *Runner) { r.logger = l }
+}
+
+// WithTrialOutput sends the output of trials, and the results in compact
+// mode, to w rather than to stdout.
+func WithTrialOutput(w io.Writer) Option {
+	return func(r *Runner) { r.trialOutput = w }
+}
+
+// Config returns a copy of the configuration the Runner runs with.
+func (r *Runner) Config() Config {
+	return r.config
+}
+
+// Run runs the tests until they're done or ctx is, in which case trials
+// running are killed and the tests not started are listed as not run. The
+// report is written out and the webhook notified as configured. The report
+// is returned whenever the run got as far as making one, even with an
+// error, eg. when tests failed; see ExitCode.
+//
+// Runs share state of the package, so Run waits for any other run, of this
+// or another Runner, to be done before starting.
+func (r *Runner) Run(ctx context.Context) (*Report, error) {
+	runMu.Lock()
+	defer runMu.Unlock()
+	c := r.config
+	if r.logger != nil {
+		c.log = newRunLogger(r.logger)
+	}
+	if r.trialOutput != nil {
+		defer func(w io.Writer) { stdout = w }(stdout)
+		stdout = r.trialOutput
+	}
+	return runAndReport(ctx, &c)
+}
+
+// ExitCode returns the exit code the command line would exit with for the
+// outcome of Run, see ExitOK and friends.
+func (r *Runner) ExitCode(report *Report, err error) int {
+	return exitCode(&r.config, report, err)
+}
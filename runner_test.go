@@ -0,0 +1,145 @@
+package schroedinger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("a cmd=true tags=fast\nb cmd=false tags=slow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var logged bytes.Buffer
+	r := NewRunner(WithTestsFiles(f), WithTrials(1), WithTags([]string{"fast"}, nil), WithLogOutput(&logged))
+	if c := r.Config(); !c.DisableCache || c.MaxFailures != 1 || c.TrialsAllowed != 1 || c.MaxParallel != runtime.NumCPU() {
+		t.Errorf("got config: %+v", c)
+	}
+	report, err := r.Run(context.Background())
+	if err != nil || r.ExitCode(report, err) != ExitOK {
+		t.Fatalf("got: %v", err)
+	}
+	if len(report.Tests) != 1 || report.Tests[0].Package != "a" {
+		t.Errorf("got: %v", report.Tests)
+	}
+	if !strings.Contains(logged.String(), "PASS") {
+		t.Errorf("got log: %q", logged.String())
+	}
+}
+
+func TestRunnerCancel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("a cmd=\"sleep 10\"\nb cmd=\"sleep 10\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(WithTestsFiles(f), WithMaxParallel(1), WithLogOutput(ioutil.Discard))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(300*time.Millisecond, cancel)
+	report, err := r.Run(ctx)
+	if !errors.Is(err, context.Canceled) || r.ExitCode(report, err) != ExitCancelled {
+		t.Fatalf("got: %v", err)
+	}
+	if report == nil || report.Stopped == "" || len(report.NotRun) == 0 {
+		t.Errorf("got: %+v", report)
+	}
+}
+
+func TestRunnerLogger(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("a cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var std, logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&std)
+	r := NewRunner(WithTestsFiles(f), WithLogger(SlogLogger(slog.New(slog.NewTextHandler(&logged, nil)))))
+	if _, err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged.String(), `level=INFO msg="SUMMARY pass: 1`) {
+		t.Errorf("got log: %q", logged.String())
+	}
+	if std.Len() != 0 {
+		t.Errorf("logged to the standard logger: %q", std.String())
+	}
+}
+
+func TestRunnerConcurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	var logs [2]bytes.Buffer
+	errs := make(chan error, len(logs))
+	for i := range logs {
+		f := filepath.Join(dir, fmt.Sprintf("tests%d.txt", i))
+		if err := ioutil.WriteFile(f, []byte(fmt.Sprintf("run%d cmd=true\n", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		r := NewRunner(WithTestsFiles(f), WithLogOutput(&logs[i]), WithTrialOutput(ioutil.Discard))
+		go func() {
+			_, err := r.Run(context.Background())
+			errs <- err
+		}()
+	}
+	for range logs {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range logs {
+		got := logs[i].String()
+		if !strings.Contains(got, fmt.Sprintf("run%d", i)) || strings.Contains(got, fmt.Sprintf("run%d", 1-i)) {
+			t.Errorf("run %d got log: %q", i, got)
+		}
+	}
+}
+
+func TestRunWaitsForRunner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("run cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 1, MaxParallel: 1,
+		log: newRunLogger(log.New(ioutil.Discard, "", 0))}
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = ioutil.Discard
+
+	// hold the lock as a run of a Runner would
+	runMu.Lock()
+	done := make(chan int, 1)
+	go func() { done <- Run(c) }()
+	select {
+	case <-done:
+		runMu.Unlock()
+		t.Fatal("Run didn't wait for the other run")
+	case <-time.After(200 * time.Millisecond):
+	}
+	runMu.Unlock()
+	if code := <-done; code != ExitOK {
+		t.Errorf("got exit code: %d", code)
+	}
+}
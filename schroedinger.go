@@ -3,15 +3,25 @@ package schroedinger
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
 )
 
 const commentPattern = "#"
@@ -19,29 +29,244 @@ const commentPattern = "#"
 var errCommentLine = errors.New("comment line")
 var errEmptyLine = errors.New("empty line")
 
-var trialsAllowed int
+// starts a line of options applying to the tests listed below it in the same
+// file, until the next such line, eg. '@defaults trials=5 dir=../go-ethereum'
+const defaultsDirective = "@defaults"
 
 // different for windows
 var goExecutablePath string
+
+// go binary found at startup, used unless Config.GoBinary is set
+var defaultGoPath string
 var commandPrefix []string
 
 type test struct {
 	pkg    string
 	name   string
+	dir    string
 	trials int
+
+	// where to run go test from and the package to give it, when
+	// resolved to the root of the package's module; see resolveModule
+	goDir string
+	goPkg string
+
+	// labels to select tests by, eg. integration, slow
+	tags []string
+
+	// where the test was listed
+	file string
+	line int
+
+	// kill a trial producing no output for this long, if set
+	idleTimeout time.Duration
+	// keep only about this many bytes of a trial's output, if set
+	maxOutput int
+
+	// shell command to run instead of go test, with pkg as its label;
+	// passes and fails by exit code alone
+	command string
+
+	// shell commands run from dir before and after every trial, eg. to reset
+	// a database; a failing before fails the trial, after always runs
+	before string
+	after  string
+
+	// allowed times to try to get the test to pass
+	trialsAllowed int
+	// trialsAllowed on CI, if set; see Config.CI
+	ciTrials int
+
+	// run as a benchmark, failing when slower than maxNsPerOp (if set)
+	bench      bool
+	maxNsPerOp float64
+
+	// run all trials, and pass if at least minPasses of them do
+	minPasses int
+
+	// a known bug which must keep failing; passing is a regression
+	mustFail bool
+
+	// runs, but its outcome doesn't count towards that of the run
+	quarantined bool
+
+	// don't overlap with any other test
+	serial bool
+	// passed through as go test -p and -parallel, if set
+	p        int
+	parallel int
+
+	// only retry failures whose output matches one of these, if any
+	retryIf []*regexp.Regexp
+	// don't retry failures which panicked
+	noRetryOnPanic bool
+	// run go test with -race, and whether failures with a data race are
+	// retried; raceSet if race= was given
+	race, raceSet bool
+	retryRaces    bool
+	// the wait before every trial after the first
+	backoff backoff
+	// run go test with -count=1, so results are never cached
+	disableCache bool
+	// passed through as go test -timeout, if set, and enforced by killing
+	// trials which run past it
+	goTestTimeout time.Duration
+	// finds the failing tests of a package, grepFailures if nil
+	parser FailureParser
+	// run go test with -json; the events of the latest trial are kept in
+	// jsonOut, and its output is given as text as usual
+	goJSON  bool
+	jsonOut []byte
+	// rerun up to this many failing tests of a package in one go test run,
+	// if more than 1
+	rerunBatch int
+	// top level tests to run together, as a batch of reruns, instead of name
+	batch []string
+
+	// run each trial in fresh cache directories, if set
+	isolation *isolation
+	// run go test in a container, if set
+	docker *Docker
+	// run the package's test binary, built once, rather than go test, if set
+	binaries *binaries
+	// environment variables of the current trial, on top of this process's
+	env []string
+	// build tags to pass go test -tags, comma separated, eg. integration,e2e
+	buildTags string
+	// further go test arguments, appended verbatim, eg. -short
+	args []string
+	// environment variables set by env= options, eg. PGPORT=5433, on top of
+	// env
+	vars []string
+
+	// the run, which trials stop with; never done if nil
+	ctx context.Context
+	// the slots of the run's go test processes, and whether t holds one
+	slots    *slots
+	slotHeld bool
+	// spaces out the trials of the run, if set
+	limit *limiter
+
+	// written to as trials finish, if set
+	events *eventLog
+	// tracks the run, for the heartbeat and status file; the key is that of
+	// the test as started, kept by its reruns
+	progress    *progress
+	progressKey string
+	// what the run logs to
+	log *runLogger
+	// buffers what is logged about the test, if set
+	ordered *testLog
+
+	// the command line and directory of the latest trial
+	lastCmd string
+	lastDir string
+
+	// write the output of every trial under this directory, if set
+	artifacts string
+
+	// write coverage profiles into coverDir; coverProfile is the latest
+	coverDir     string
+	coverProfile string
+}
+
+// serial tests take this exclusively, all others share it
+var serialLock sync.RWMutex
+
+// numbers coverage profiles
+var coverProfiles uint64
+
+// rerun returns a copy of t to rerun a failing test found in its package.
+// The failures of a recursive package, eg. ./p2p/..., are rerun in the
+// package go test reported them in, eg. github.com/ethereumproject/go-ethereum/p2p/nat.
+func (t *test) rerun(f failure) *test {
+	r := *t
+	r.pkg = getNonRecursivePackageName(t.pkg)
+	if t.goPkg != "" {
+		r.goPkg = getNonRecursivePackageName(t.goPkg)
+	}
+	if f.pkg != "" && r.pkg != t.pkg {
+		dir, _ := t.goArgs()
+		r.pkg, r.goDir, r.goPkg = f.pkg, dir, f.pkg
+	}
+	if f == (failure{}) {
+		// nothing to narrow the rerun down to
+		r.pkg, r.goPkg = t.pkg, t.goPkg
+	}
+	r.name = f.name
+	r.trials = 1
+	r.slotHeld = false
+	return &r
 }
 
 func (t *test) String() string {
-	return fmt.Sprintf("%s %s", t.pkg, t.name)
+	s := fmt.Sprintf("%s %s", t.pkg, t.name)
+	if t.mustFail {
+		s += " [must fail]"
+	}
+	if t.quarantined {
+		s += " [quarantined]"
+	}
+	return s
 }
 
 func init() {
-	goExecutablePath = getGoPath()
+	defaultGoPath = getGoPath()
+	goExecutablePath = defaultGoPath
 	commandPrefix = getCommandPrefix()
 }
 
+// the environment variable naming the go binary to test with, eg. to use
+// that of a toolchain manager, by path or by name on PATH, eg. go1.21.5
+const goBinaryEnv = "SCHROEDINGER_GO"
+
+// getGoPath finds the go binary named by SCHROEDINGER_GO, if set, or else
+// that of the GOROOT this was built with, falling back to the one on PATH
 func getGoPath() string {
-	return filepath.Join(runtime.GOROOT(), "bin", "go")
+	if p := os.Getenv(goBinaryEnv); p != "" {
+		if !strings.ContainsAny(p, `/\`) {
+			if lp, err := exec.LookPath(p); err == nil {
+				return lp
+			}
+		}
+		return p
+	}
+	name := "go"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	p := filepath.Join(runtime.GOROOT(), "bin", name)
+	if checkGoBinary(p) == nil {
+		return p
+	}
+	if lp, err := exec.LookPath("go"); err == nil {
+		return lp
+	}
+	return p
+}
+
+// checkGoBinary reports why path is no usable go binary, if it isn't
+func checkGoBinary(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s: is a directory", path)
+	}
+	if runtime.GOOS != "windows" && fi.Mode()&0111 == 0 {
+		return fmt.Errorf("%s: not executable", path)
+	}
+	return nil
+}
+
+// goVersion returns the output of go version, eg. 'go version go1.21.5 linux/amd64'
+func goVersion(path string) (string, error) {
+	out, err := exec.Command(path, "version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s version: %v: %s", path, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
 }
 
 func getCommandPrefix() []string {
@@ -51,15 +276,219 @@ func getCommandPrefix() []string {
 	return []string{"/bin/sh", "-c"}
 }
 
-func parseLinePackageTest(s string) *test {
+// eg. 'github.com/ethereumproject/go-ethereum/eth/downloader TestFastCriticalRestarts dir=../go-ethereum'
+// The defaults are options set before those of the line, which override them.
+func parseLinePackageTest(s string, defaults ...string) (*test, error) {
 	t := &test{}
-	lsep := strings.Split(s, " ")
+	lsep, err := splitFields(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(lsep) == 0 {
+		return nil, errEmptyLine
+	}
+	for _, f := range defaults {
+		if err := t.setOption(f); err != nil {
+			return nil, err
+		}
+	}
 	t.pkg = lsep[0]
-	if len(lsep) > 1 {
-		t.name = lsep[1]
+	for _, f := range lsep[1:] {
+		if !isOption(f) {
+			if t.name == "" {
+				t.name = f
+				continue
+			}
+			if k, _, ok := strings.Cut(f, "="); ok {
+				return nil, fmt.Errorf("unknown option: %s", k)
+			}
+			return nil, fmt.Errorf("unexpected field: %s", f)
+		}
+		if err := t.setOption(f); err != nil {
+			return nil, err
+		}
 	}
 	t.pkg = strings.Replace(t.pkg, "/", string(filepath.Separator), -1)
-	return t
+	return t, nil
+}
+
+// splitFields splits s around spaces, except within double quotes,
+// so option values can be quoted: cmd="./integration.sh -short"
+func splitFields(s string) ([]string, error) {
+	var fields []string
+	var field []rune
+	var inQuote, escaped bool
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case inQuote && r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && unicode.IsSpace(r):
+			if len(field) > 0 {
+				fields = append(fields, string(field))
+				field = field[:0]
+			}
+			continue
+		}
+		field = append(field, r)
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quote")
+	}
+	if len(field) > 0 {
+		fields = append(fields, string(field))
+	}
+	return fields, nil
+}
+
+// stripComment removes a trailing comment, unless the '#' is quoted
+func stripComment(s string) string {
+	inQuote := false
+	for i, r := range s {
+		switch {
+		case r == '"' && (i == 0 || s[i-1] != '\\'):
+			inQuote = !inQuote
+		case !inQuote && strings.HasPrefix(s[i:], commentPattern):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// optionKeys are the keys of the options setOption knows
+var optionKeys = map[string]bool{
+	"dir": true, "cmd": true, "bench": true, "trials": true, "citrials": true,
+	"minpasses": true, "tags": true, "buildtags": true, "args": true,
+	"before": true, "after": true, "mustfail": true, "quarantine": true,
+	"race": true, "serial": true, "p": true, "parallel": true,
+	"timeout": true, "env": true, "maxns": true,
+}
+
+// isOption reports whether a field of a tests file line is an option,
+// key=value with a known key; others, eg. 'TestLimits/limit=5', are names
+func isOption(f string) bool {
+	k, _, ok := strings.Cut(f, "=")
+	return ok && optionKeys[k]
+}
+
+// options are given as key=value following the package
+func (t *test) setOption(f string) error {
+	kv := strings.SplitN(f, "=", 2)
+	if strings.HasPrefix(kv[1], `"`) {
+		v, err := strconv.Unquote(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad %s: %v", kv[0], err)
+		}
+		kv[1] = v
+	}
+	switch kv[0] {
+	case "dir":
+		t.dir = filepath.Clean(kv[1])
+	case "cmd":
+		t.command = kv[1]
+	case "bench":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad bench: %v", err)
+		}
+		t.bench = b
+	case "trials":
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad trials: %s", kv[1])
+		}
+		t.trialsAllowed = n
+	case "citrials":
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad citrials: %s", kv[1])
+		}
+		t.ciTrials = n
+	case "minpasses":
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad minpasses: %s", kv[1])
+		}
+		t.minPasses = n
+	case "tags":
+		t.tags = nil
+		for _, tag := range strings.Split(kv[1], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				t.tags = append(t.tags, tag)
+			}
+		}
+	case "buildtags":
+		var tags []string
+		for _, tag := range strings.Split(kv[1], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		t.buildTags = strings.Join(tags, ",")
+	case "args":
+		t.args = append(t.args, strings.Fields(kv[1])...)
+	case "before":
+		t.before = kv[1]
+	case "after":
+		t.after = kv[1]
+	case "mustfail":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad mustfail: %v", err)
+		}
+		t.mustFail = b
+	case "quarantine":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad quarantine: %v", err)
+		}
+		t.quarantined = b
+	case "race":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad race: %v", err)
+		}
+		t.race, t.raceSet = b, true
+	case "serial":
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return fmt.Errorf("bad serial: %v", err)
+		}
+		t.serial = b
+	case "p", "parallel":
+		n, err := strconv.Atoi(kv[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad %s: %s", kv[0], kv[1])
+		}
+		if kv[0] == "p" {
+			t.p = n
+		} else {
+			t.parallel = n
+		}
+	case "timeout":
+		d, err := time.ParseDuration(kv[1])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("bad timeout: %s", kv[1])
+		}
+		t.goTestTimeout = d
+	case "env":
+		if i := strings.Index(kv[1], "="); i < 1 {
+			return fmt.Errorf("bad env: %s", kv[1])
+		}
+		t.vars = append(t.vars, kv[1])
+	case "maxns":
+		n, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil {
+			return fmt.Errorf("bad maxns: %v", err)
+		}
+		t.maxNsPerOp = n
+	default:
+		return fmt.Errorf("unknown option: %s", kv[0])
+	}
+	return nil
 }
 
 func parseMatchList(list string) []string {
@@ -77,43 +506,156 @@ func getNonRecursivePackageName(s string) string {
 	return out
 }
 
-func handleLine(s string) (*test, error) {
-	var t *test
-	ss := strings.Trim(s, " ")
+func handleLine(s string, defaults ...string) (*test, error) {
+	ss := strings.TrimSpace(s)
 	if len(ss) == 0 {
 		return nil, errEmptyLine
 	}
 	if strings.HasPrefix(ss, commentPattern) {
 		return nil, errCommentLine
 	}
-	if strings.Contains(ss, commentPattern) {
-		sss := strings.Split(ss, commentPattern)
-		ss = strings.Trim(sss[0], " ")
+	ss = strings.TrimSpace(stripComment(ss))
+	return parseLinePackageTest(ss, defaults...)
+}
+
+// parseDefaults returns the options of a defaultsDirective line, and whether
+// s is one
+func parseDefaults(s string) ([]string, bool, error) {
+	ss := strings.TrimSpace(stripComment(strings.TrimSpace(s)))
+	if ss != defaultsDirective && !strings.HasPrefix(ss, defaultsDirective+" ") {
+		return nil, false, nil
 	}
-	t = parseLinePackageTest(ss)
-	return t, nil
+	fields, err := splitFields(ss)
+	if err != nil {
+		return nil, true, err
+	}
+	opts := fields[1:]
+	for _, f := range opts {
+		if !strings.Contains(f, "=") {
+			return nil, true, fmt.Errorf("unexpected field: %s", f)
+		}
+		if err := (&test{}).setOption(f); err != nil {
+			return nil, true, err
+		}
+	}
+	return opts, true, nil
 }
 
-func lineMatchList(line string, whites, blacks []string) bool {
-	if blacks != nil && len(blacks) > 0 {
-		for _, m := range blacks {
-			if strings.Contains(line, m) {
-				return false
-			}
+// tagged reports whether t carries one of the include tags, if any are
+// given, and none of the exclude tags
+func (t *test) tagged(include, exclude []string) bool {
+	ok, _ := t.matchTags(include, exclude)
+	return ok
+}
+
+// matchTags is tagged, along with the reason for its verdict
+func (t *test) matchTags(include, exclude []string) (bool, string) {
+	has := make(map[string]bool)
+	for _, tag := range t.tags {
+		has[tag] = true
+	}
+	for _, tag := range exclude {
+		if has[tag] {
+			return false, fmt.Sprintf("tagged excluded %q", tag)
 		}
 	}
-	if whites != nil && len(whites) > 0 {
-		for _, m := range whites {
-			if !strings.Contains(line, m) {
-				return false
-			} else {
-				return true
+	if len(include) == 0 {
+		return true, ""
+	}
+	for _, tag := range include {
+		if has[tag] {
+			return true, fmt.Sprintf("tagged included %q", tag)
+		}
+	}
+	return false, fmt.Sprintf("tagged none of %q", include)
+}
+
+// noMatchError describes a run left with no tests by the filters
+func noMatchError(all []*test, c *Config) error {
+	var names []string
+	for _, t := range all {
+		names = append(names, strings.TrimSpace(t.String()))
+	}
+	filters := fmt.Sprintf("whitelist %q and blacklist %q",
+		parseMatchList(c.WhitelistMatch), parseMatchList(c.BlacklistMatch))
+	if len(c.TagsInclude) > 0 || len(c.TagsExclude) > 0 {
+		filters += fmt.Sprintf(", tags included %q and excluded %q", c.TagsInclude, c.TagsExclude)
+	}
+	return fmt.Errorf("%w %s; the tests are: %s", ErrNoTestsMatched, filters, strings.Join(names, ", "))
+}
+
+// How the white and blacklist patterns match the lines of the tests files.
+const (
+	// a pattern matches the lines containing it, eg. sync matches both
+	// './eth TestSync' and './asyncpool TestPool'
+	MatchSubstring = "substring"
+	// a pattern is a regular expression, eg. '^./eth TestSync$' or '\bsync'
+	MatchRegexp = "regexp"
+)
+
+// matcher is a white or blacklist pattern, along with its regular
+// expression with MatchRegexp
+type matcher struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// compileMatchList returns the patterns of list, compiled as mode says
+// they match
+func compileMatchList(list, mode string) ([]matcher, error) {
+	var ms []matcher
+	for _, p := range parseMatchList(list) {
+		m := matcher{pattern: p}
+		if mode == MatchRegexp {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, err
 			}
+			m.re = re
 		}
+		ms = append(ms, m)
 	}
-	return true
+	return ms, nil
+}
+
+// matches reports whether m matches line: as a regular expression, if
+// compiled as one, and otherwise as a substring
+func (m matcher) matches(line string) bool {
+	if m.re != nil {
+		return m.re.MatchString(line)
+	}
+	return strings.Contains(line, m.pattern)
+}
+
+// lineMatchList reports whether line matches none of the blacks and, if
+// there are whites, any of them
+func lineMatchList(line string, whites, blacks []matcher) bool {
+	ok, _ := matchList(line, whites, blacks)
+	return ok
 }
 
+// matchList is lineMatchList, along with the reason for its verdict
+func matchList(line string, whites, blacks []matcher) (bool, string) {
+	for _, m := range blacks {
+		if m.matches(line) {
+			return false, fmt.Sprintf("matches blacklist %q", m.pattern)
+		}
+	}
+	if len(whites) == 0 {
+		return true, ""
+	}
+	var patterns []string
+	for _, m := range whites {
+		if m.matches(line) {
+			return true, fmt.Sprintf("matches whitelist %q", m.pattern)
+		}
+		patterns = append(patterns, m.pattern)
+	}
+	return false, fmt.Sprintf("matches no whitelist pattern of %q", patterns)
+}
+
+// collectTestsFromFile returns the tests listed in f, along with all of
+// the errors in it
 func collectTestsFromFile(f string) (tests []*test, err error) {
 	file, err := os.Open(f)
 	if err != nil {
@@ -122,14 +664,38 @@ func collectTestsFromFile(f string) (tests []*test, err error) {
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
 
+	// relative test dirs are relative to the tests file
+	base := filepath.Dir(f)
+	line := 0
+	var errs []error
+	var defaults []string
 	for scanner.Scan() {
-		t, e := handleLine(scanner.Text())
-		if e == nil {
-			tests = append(tests, t)
+		line++
+		if opts, ok, e := parseDefaults(scanner.Text()); ok {
+			if e != nil {
+				errs = append(errs, fmt.Errorf("%s:%d: %v", f, line, e))
+			}
+			defaults = opts
+			continue
+		}
+		t, e := handleLine(scanner.Text(), defaults...)
+		if e == errCommentLine || e == errEmptyLine {
+			continue
+		}
+		if e != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %v", f, line, e))
+			continue
+		}
+		if t.dir != "" && !filepath.IsAbs(t.dir) {
+			t.dir = filepath.Join(base, t.dir)
 		}
+		t.file = f
+		t.line = line
+		tests = append(tests, t)
 	}
 
-	return tests, scanner.Err()
+	errs = append(errs, scanner.Err())
+	return tests, errors.Join(errs...)
 }
 
 func filterTests(tests []*test, allowed func(*test) bool) []*test {
@@ -142,177 +708,1262 @@ func filterTests(tests []*test, allowed func(*test) bool) []*test {
 	return out
 }
 
-func grepFailures(gotestout []byte) []string {
+// shuffleTests shuffles tests in place and returns the seed used,
+// which is random if the given seed is 0
+func shuffleTests(tests []*test, seed int64) int64 {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed))
+	for i := len(tests) - 1; i > 0; i-- {
+		j := r.Intn(i + 1)
+		tests[i], tests[j] = tests[j], tests[i]
+	}
+	return seed
+}
+
+// matches the name in test failure lines, with or without the duration,
+// eg. '--- FAIL: TestFastCriticalRestarts64 (12.34s)', or indented for subtests
+var failLine = regexp.MustCompile(`^\s*--- FAIL: (\S+)`)
+
+// failure is a failing test found in go test output, along with the import
+// path of its package if go test reported it. A failure without a name is
+// that of a package as a whole, which failed without any failing tests,
+// eg. as its TestMain exited non-zero.
+type failure struct {
+	pkg  string
+	name string
+}
+
+// eg. 'FAIL	github.com/ethereumproject/go-ethereum/p2p/nat	2.664s',
+// which follows the failures of the package
+var failPackageLine = regexp.MustCompile(`^FAIL\s+(\S+)`)
+
+// eg. 'panic: test timed out after 10m0s', from go test -timeout, followed
+// since Go 1.20 by a 'running tests:' list of the tests which were running,
+// one per line: '	TestSync (10m0s)'
+var (
+	timeoutLine        = regexp.MustCompile(`^panic: test timed out after \S+`)
+	timeoutRunningLine = regexp.MustCompile(`^\s+(\S+) \([^)]*\)$`)
+)
+
+func grepFailures(gotestout []byte) ([]failure, error) {
 	reader := bytes.NewReader(gotestout)
 	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, maxLineSize)
 
-	var fails []string
+	var fails []failure
+	// failures not yet followed by their package's FAIL line
+	pending := 0
+	// reading the tests running when go test timed out
+	timedOut, inRunning := false, false
 
 	for scanner.Scan() {
-		// eg. '--- FAIL: TestFastCriticalRestarts64 (12.34s)'
 		text := scanner.Text()
-		if !strings.Contains(text, "FAIL") {
+		if m := failPackageLine.FindStringSubmatch(text); m != nil {
+			for i := len(fails) - pending; i < len(fails); i++ {
+				fails[i].pkg = m[1]
+			}
+			if pending == 0 {
+				fails = append(fails, failure{pkg: m[1]})
+			}
+			pending = 0
+			timedOut, inRunning = false, false
+			continue
+		}
+		if timeoutLine.MatchString(text) {
+			timedOut = true
+			continue
+		}
+		if timedOut && text == "running tests:" {
+			inRunning = true
+			continue
+		}
+		if inRunning {
+			if m := timeoutRunningLine.FindStringSubmatch(text); m != nil {
+				fails = append(fails, failure{name: m[1]})
+				pending++
+				continue
+			}
+			inRunning = false
+		}
+		m := failLine.FindStringSubmatch(text)
+		if len(m) < 2 {
+			continue
+		}
+		fails = append(fails, failure{name: m[1]})
+		pending++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read go test output: %w", err)
+	}
+	return fails, nil
+}
+
+// runPattern returns the -run pattern for a test name. Subtest names,
+// eg. 'TestSync/fast_mode', are anchored level by level so that only the
+// named subtest runs: '^TestSync$/^fast_mode$'. Levels which are already
+// regular expressions are left alone, as are top level names.
+func runPattern(name string) string {
+	if !strings.Contains(name, "/") {
+		return name
+	}
+	levels := strings.Split(name, "/")
+	for i, l := range levels {
+		if l != "" && regexp.QuoteMeta(l) == l {
+			levels[i] = "^" + l + "$"
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// leafFailures leaves out the failures of tests whose subtests failed too,
+// as a test fails along with its subtests: rerunning just the subtests,
+// eg. TestSync/fast_mode, rather than the whole TestSync, is enough.
+func leafFailures(fails []failure) []failure {
+	var leaves []failure
+	for _, f := range fails {
+		parent := false
+		for _, g := range fails {
+			if f.name != "" && g.pkg == f.pkg && strings.HasPrefix(g.name, f.name+"/") {
+				parent = true
+				break
+			}
+		}
+		if !parent {
+			leaves = append(leaves, f)
+		}
+	}
+	return leaves
+}
+
+// parentName returns the name of the test containing the named subtest,
+// or "" for a top level test.
+func parentName(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// resolveTrials sets the trials allowed of every test in one order of
+// precedence: the test's own trials=, then those of its nearest listed
+// parent test (for a subtest, eg. TestA/case inherits from TestA), then
+// the global default. On CI, a test's citrials= stand in for its trials=.
+// Overrides, see Config.TrialsFor, come before all of them.
+func resolveTrials(tests []*test, global int, ci bool, overrides map[string]int) {
+	byName := make(map[string]*test)
+	own := make(map[*test]int)
+	for _, t := range tests {
+		byName[t.pkg+" "+t.name] = t
+		own[t] = t.trialsAllowed
+		if ci && t.ciTrials != 0 {
+			own[t] = t.ciTrials
+		}
+	}
+	for _, t := range tests {
+		if n, ok := trialsOverride(t, overrides); ok {
+			t.trialsAllowed = n
 			continue
 		}
-		if !strings.Contains(text, ":") {
+		t.trialsAllowed = trialsFor(t, byName, own, global)
+	}
+}
+
+// trialsOverride returns the trials of the override matching t, if any:
+// one naming t exactly, or else the longest one contained in its line
+func trialsOverride(t *test, overrides map[string]int) (int, bool) {
+	line := t.pkg + " " + t.name
+	if n, ok := overrides[line]; ok {
+		return n, true
+	}
+	if n, ok := overrides[t.name]; ok && t.name != "" {
+		return n, true
+	}
+	best, n := "", 0
+	for p, pn := range overrides {
+		if strings.Contains(line, p) && (len(p) > len(best) || (len(p) == len(best) && p < best)) {
+			best, n = p, pn
+		}
+	}
+	return n, best != ""
+}
+
+// trialsFor looks up the trials of t as listed, not as already resolved,
+// so the result doesn't depend on the order of the tests
+func trialsFor(t *test, byName map[string]*test, own map[*test]int, global int) int {
+	if n := own[t]; n != 0 {
+		return n
+	}
+	for p := parentName(t.name); p != ""; p = parentName(p) {
+		if pt, ok := byName[t.pkg+" "+p]; ok && own[pt] != 0 {
+			return own[pt]
+		}
+	}
+	return global
+}
+
+// retryable reports whether a failed trial's output is worth retrying
+func (t *test) retryable(gotestout []byte) bool {
+	if len(t.retryIf) == 0 {
+		return true
+	}
+	for _, re := range t.retryIf {
+		if re.Match(gotestout) {
+			return true
+		}
+	}
+	return false
+}
+
+// grepBuildFailed reports whether go test failed to build or set up a package
+func grepBuildFailed(gotestout []byte) bool {
+	// eg. 'FAIL	github.com/ethereumproject/go-ethereum/p2p [build failed]'
+	return bytes.Contains(gotestout, []byte("[build failed]")) ||
+		bytes.Contains(gotestout, []byte("[setup failed]"))
+}
+
+// grepSkipped reports whether a passing go test run didn't actually run
+// anything: the tests were skipped, there were none, or the result was cached.
+// Named tests are run with -v, so their own PASS lines are looked for.
+func grepSkipped(gotestout []byte, named bool) bool {
+	// the output of a cached run is replayed, PASS lines and all
+	if named && grepCached(gotestout) {
+		return true
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	for scanner.Scan() {
+		text := scanner.Text()
+		if named {
+			// eg. '--- PASS: TestFastCriticalRestarts64 (12.34s)'
+			if strings.Contains(text, "--- PASS:") {
+				return false
+			}
 			continue
 		}
-		step1 := strings.Split(text, ":")
-		step2 := strings.Split(step1[1], "(")
-		testname := strings.Trim(step2[0], " ")
-		fails = append(fails, testname)
+		// eg. 'ok  	github.com/ethereumproject/go-ethereum/p2p	0.395s'
+		if strings.HasPrefix(text, "ok ") &&
+			!strings.Contains(text, "(cached)") &&
+			!strings.Contains(text, "[no tests to run]") {
+			return false
+		}
 	}
+	return true
+}
 
-	if e := scanner.Err(); e != nil {
-		log.Fatal(e)
+// grepCached reports whether go test returned a cached result for any package,
+// eg. 'ok  	github.com/ethereumproject/go-ethereum/p2p	(cached)'
+func grepCached(gotestout []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(gotestout))
+	for scanner.Scan() {
+		text := scanner.Text()
+		if strings.HasPrefix(text, "ok ") && strings.Contains(text, "(cached)") {
+			return true
+		}
+	}
+	return false
+}
+
+// goCommand returns the command running go with args in dir, directly
+// rather than through the shell, so no argument needs quoting
+func goCommand(t *test, dir string, args ...string) *exec.Cmd {
+	logTrialf(t, "| %s", shellJoin(append([]string{goExecutablePath}, args...)))
+	cmd := exec.Command(goExecutablePath, args...)
+	cmd.Dir = dir
+	cmd.Env = t.environ()
+	return cmd
+}
+
+// skipped reports whether a passing trial didn't actually run anything
+func (t *test) skipped(gotestout []byte) bool {
+	if t.command != "" {
+		return false
 	}
+	return grepSkipped(gotestout, t.name != "")
+}
 
-	return fails
+func (t *test) context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
+	}
+	return t.ctx
 }
 
+// runTest runs a trial of t, between its before= and after= hooks, after
+// waiting out its backoff if it's a retry
 func runTest(t *test) ([]byte, error) {
-	args := fmt.Sprintf("test %s", t.pkg)
-	if t.name != "" {
-		args += fmt.Sprintf(" -run %s", t.name)
+	if d := t.backoff.wait(t.trials); d > 0 {
+		logTrialf(t, "| waiting %v before trial %d", d.Round(time.Millisecond), t.trials+1)
+		sleep(t.context(), d)
+	}
+	// every trial counts against the rate limit, retries and reruns too
+	if err := t.limit.wait(t.context()); err != nil {
+		// the run was stopped; use up the trials without running them
+		t.trials++
+		return nil, fmt.Errorf("stopped: %w", err)
+	}
+	t.progress.trialStarted(t)
+	start := time.Now()
+	var o []byte
+	var err error
+	if t.isolation != nil {
+		cleanup, ierr := t.isolation.enter(t)
+		if ierr != nil {
+			err = &hookError{"isolation", ierr}
+			t.trials++
+		} else {
+			defer cleanup()
+		}
+	}
+	if err == nil && t.before != "" {
+		o, err = runTestHook(t, "before", t.before)
+		if err != nil {
+			// the trial failed without running
+			t.trials++
+		}
+	}
+	if err == nil {
+		done := enforceTimeout(t)
+		o, err = runTrial(t)
+		done()
+	}
+	if t.after != "" {
+		if ao, aerr := runTestHook(t, "after", t.after); aerr != nil {
+			t.logf("WARNING %s: %v\n%s", t, aerr, ao)
+		}
+	}
+	t.events.trialFinished(t, time.Since(start), err)
+	if t.artifacts != "" {
+		if aerr := writeArtifact(t, start, time.Since(start), o, err); aerr != nil {
+			t.logf("WARNING %s: could not write trial output: %v", t, aerr)
+		}
+	}
+	return o, err
+}
+
+// hookError is the failure of a before= or after= hook
+type hookError struct {
+	hook string
+	err  error
+}
+
+func (e *hookError) Error() string {
+	return fmt.Sprintf("%s hook: %v", e.hook, e.err)
+}
+
+func isHookError(err error) bool {
+	var he *hookError
+	return errors.As(err, &he)
+}
+
+// runTestHook runs a hook of t from the test's directory
+func runTestHook(t *test, hook, command string) ([]byte, error) {
+	logTrialf(t, "| %s: %s %s %s", hook, commandPrefix[0], commandPrefix[1], command)
+	cmd := exec.Command(commandPrefix[0], commandPrefix[1], command)
+	cmd.Dir = t.dir
+	cmd.Env = t.environ()
+	o, err := combinedOutput(t.context(), cmd, t.idleTimeout, t.maxOutput)
+	if err != nil {
+		return o, &hookError{hook, err}
+	}
+	return o, nil
+}
+
+func runTrial(t *test) ([]byte, error) {
+	if t.command != "" {
+		logTrialf(t, "| %s %s %s", commandPrefix[0], commandPrefix[1], t.command)
+		cmd := exec.Command(commandPrefix[0], commandPrefix[1], t.command)
+		cmd.Dir = t.dir
+		cmd.Env = t.environ()
+		t.lastCmd, t.lastDir = t.command, t.dir
+		t.trials++
+		return combinedOutput(t.context(), cmd, t.idleTimeout, t.maxOutput)
+	}
+	dir, pkg := t.goArgs()
+	args := []string{"test", pkg}
+	if t.bench {
+		args = append(args, "-run=^$", "-bench="+benchPattern(t.name))
+	} else if t.name != "" {
+		// verbose, to tell skips from passes
+		args = append(args, "-v", "-run", runPattern(t.name))
+	} else if len(t.batch) > 0 {
+		args = append(args, "-v", "-run", batchPattern(t.batch))
+	}
+	if t.serial {
+		args = append(args, "-p", "1")
+	} else if t.p > 0 {
+		args = append(args, "-p", strconv.Itoa(t.p))
+	}
+	if t.parallel > 0 {
+		args = append(args, "-parallel", strconv.Itoa(t.parallel))
+	}
+	if t.race {
+		args = append(args, "-race")
+	}
+	if t.buildTags != "" {
+		args = append(args, "-tags="+t.buildTags)
+	}
+	if t.disableCache {
+		args = append(args, "-count=1")
+	}
+	if t.goJSON && !t.precompiled() {
+		args = append(args, "-json")
+	}
+	if timeout := trialTimeout(t); timeout > 0 {
+		args = append(args, "-timeout", timeout.String())
+	}
+	args = append(args, t.args...)
+	// the coverage profile goes into a temporary directory, not worth replaying
+	t.lastCmd, t.lastDir = shellJoin(append([]string{goExecutablePath}, args...)), dir
+	docker := t.docker.withEnv(t.vars)
+	if docker != nil {
+		t.lastCmd = docker.commandLine(dir, args)
 	}
-	log.Println("|", commandPrefix[0], commandPrefix[1], goExecutablePath+" "+args)
-	cmd := exec.Command(commandPrefix[0], commandPrefix[1], goExecutablePath+" "+args)
+	if t.coverDir != "" {
+		t.coverProfile = filepath.Join(t.coverDir, fmt.Sprintf("%d.out", atomic.AddUint64(&coverProfiles, 1)))
+		args = append(args, "-coverprofile="+t.coverProfile)
+	}
+	if t.precompiled() {
+		t.trials++
+		return runPrecompiled(t)
+	}
+	if docker != nil {
+		cmd, name := docker.command(t, dir, args)
+		t.trials++
+		o, err := combinedOutput(t.context(), cmd, t.idleTimeout, t.maxOutput)
+		if err != nil {
+			dockerKill(name)
+		}
+		return t.keepJSON(o, err)
+	}
+	cmd := goCommand(t, dir, args...)
 	t.trials++
-	out, err := cmd.CombinedOutput()
-	return out, err
+	o, err := t.keepJSON(combinedOutput(t.context(), cmd, t.idleTimeout, t.maxOutput))
+	if t.disableCache && grepCached(o) {
+		t.logf("WARNING %s: go test returned a cached result despite -count=1, counting it as skipped", t)
+	}
+	return o, err
 }
 
-func tryIndividualTest(t *test, c chan error) {
-	for t.trials < trialsAllowed {
+func tryIndividualTest(t *test, c chan *TestResult) {
+	r := newTestResult(t)
+	for t.trials < t.trialsAllowed {
 		start := time.Now()
-		if o, e := runTest(t); e == nil {
-			log.Println(t)
-			log.Printf("- PASS (%v) %d/%d", time.Since(start), t.trials, trialsAllowed)
-			c <- nil
+		o, e := runTest(t)
+		d := time.Since(start)
+		r.addTrial(d, o, trialOutcome(t, o, e))
+		if e == nil && t.skipped(o) {
+			logTest(t)
+			logTrialf(t, "- SKIP (%v)", d)
+			r.skip(t)
+			c <- r
+			return
+		}
+		if e == nil {
+			logTest(t)
+			logTrialf(t, "- PASS (%v) %d/%d", d, t.trials, t.trialsAllowed)
+			r.pass(t)
+			c <- r
+			return
+		}
+		logTest(t)
+		logTrialf(t, "- FAIL (%v) %d/%d: %v", d, t.trials, t.trialsAllowed, e)
+		logFailure(t, r, o, e)
+		r.BuildFailed = grepBuildFailed(o)
+		if r.notePanic(o) && t.noRetryOnPanic {
+			t.logf("%s: panicked in %s, not retrying", t, r.PanicIn)
+			break
+		}
+		if r.noteRace(o) && !t.retryRaces {
+			t.logf("%s: data race, not retrying", t)
+			break
+		}
+		if !isHookError(e) && !t.retryable(o) {
+			t.logf("%s: output matches no retry pattern, not retrying", t)
+			break
+		}
+		if t.trials < t.trialsAllowed && !roomForTrial(t.context(), d+t.backoff.base(t.trials)) {
+			t.logf("%s: no time left in the run for another trial, not retrying", t)
+			r.fail(t, fmt.Errorf("FAIL %s %s: %w", t.pkg, t.name, ErrDeadlineExceeded))
+			c <- r
 			return
-		} else {
-			log.Println(t)
-			log.Printf("- FAIL (%v) %d/%d: %v", time.Since(start), t.trials, trialsAllowed, e)
-			fmt.Println()
-			fmt.Println(string(o))
 		}
 	}
-	c <- fmt.Errorf("FAIL %s %s", t.pkg, t.name)
+	r.fail(t, fmt.Errorf("FAIL %s %s", t.pkg, t.name))
+	c <- r
 }
 
-// only gets to send one nil/error on the given channel
-func tryPackageTest(t *test, c chan error) {
-	start := time.Now()
-	if o, e := runTest(t); e == nil {
-		log.Println(t)
-		log.Printf("- PASS (%v)", time.Since(start))
-		fmt.Println()
-		fmt.Println(string(o))
-		c <- nil
+// tryMustFailTest inverts the retries: the test has to fail every trial,
+// and a single pass is a regression.
+func tryMustFailTest(t *test, c chan *TestResult) {
+	r := newTestResult(t)
+	for t.trials < t.trialsAllowed {
+		start := time.Now()
+		o, e := runTest(t)
+		d := time.Since(start)
+		r.addTrial(d, o, trialOutcome(t, o, e))
+		logTest(t)
+		if e == nil && t.skipped(o) {
+			logTrialf(t, "- SKIP (%v)", d)
+			r.skip(t)
+			c <- r
+			return
+		}
+		if e == nil {
+			logTrialf(t, "- PASS (%v) %d/%d: regression, must fail", d, t.trials, t.trialsAllowed)
+			logOutput(t, o)
+			r.fail(t, fmt.Errorf("REGRESSION %s %s passed, but must fail", t.pkg, t.name))
+			c <- r
+			return
+		}
+		if !t.failedAsTest(o, e) {
+			// eg. it didn't build: that's no sign of the bug it reproduces
+			logTrialf(t, "- FAIL (%v) %d/%d: %v", d, t.trials, t.trialsAllowed, e)
+			logFailure(t, r, o, e)
+			r.BuildFailed = grepBuildFailed(o)
+			r.fail(t, fmt.Errorf("FAIL %s %s: %w", t.pkg, t.name, e))
+			c <- r
+			return
+		}
+		logTrialf(t, "- FAIL (%v) %d/%d: as expected", d, t.trials, t.trialsAllowed)
+	}
+	r.Outcome = OutcomePass
+	r.finish(t)
+	c <- r
+}
+
+// failedAsTest reports whether the failed trial of t with output o ended
+// with err for its tests failing, rather than for not building, a hook
+// failing, go not running at all or the run being stopped. A cmd= test
+// fails by its exit code alone.
+func (t *test) failedAsTest(o []byte, err error) bool {
+	var ee *exec.ExitError
+	if !errors.As(err, &ee) || isHookError(err) || t.context().Err() != nil || grepBuildFailed(o) {
+		return false
+	}
+	if t.command != "" {
+		return true
+	}
+	fails, _ := t.parseFailures(o)
+	for _, f := range fails {
+		if f.name != "" && (t.name == "" || f.name == t.name || strings.HasPrefix(f.name, t.name+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// tryThresholdTest runs every allowed trial, without stopping at the first
+// pass, and passes the test if at least minPasses trials passed. Trials
+// which skipped don't count as passes; a test skipping every one of them
+// is skipped.
+func tryThresholdTest(t *test, c chan *TestResult) {
+	r := newTestResult(t)
+	skips := 0
+	for t.trials < t.trialsAllowed {
+		start := time.Now()
+		o, e := runTest(t)
+		d := time.Since(start)
+		r.addTrial(d, o, trialOutcome(t, o, e))
+		logTest(t)
+		if e == nil && t.skipped(o) {
+			skips++
+			logTrialf(t, "- SKIP (%v) %d/%d", d, t.trials, t.trialsAllowed)
+			continue
+		}
+		if e == nil {
+			r.Passes++
+			logTrialf(t, "- PASS (%v) %d/%d", d, t.trials, t.trialsAllowed)
+			continue
+		}
+		logTrialf(t, "- FAIL (%v) %d/%d: %v", d, t.trials, t.trialsAllowed, e)
+		logFailure(t, r, o, e)
+	}
+	if skips == t.trials {
+		r.skip(t)
+		c <- r
 		return
+	}
+	logTrialf(t, "%s: passed %d/%d trials, need %d", t, r.Passes, t.trials, t.minPasses)
+	if r.Passes < t.minPasses {
+		r.fail(t, fmt.Errorf("FAIL %s %s: passed %d/%d trials, need %d", t.pkg, t.name, r.Passes, t.trials, t.minPasses))
 	} else {
-		log.Println(t)
-		log.Printf("- FAIL (%v)", time.Since(start))
-		fmt.Println()
-		fmt.Println(string(o))
-
-		fails := grepFailures(o)
-		if len(fails) == 0 {
-			log.Fatalf("%s reported failure, but no failing tests were discovered, err=%v",
-				getNonRecursivePackageName(t.pkg), e)
-		}
-
-		var failingTests []*test
-		for _, f := range fails {
-			failingTests = append(failingTests,
-				&test{
-					pkg:    getNonRecursivePackageName(t.pkg),
-					name:   f,
-					trials: 1,
-				})
-		}
-		log.Printf("Found failing test(s) in %s: %v. Rerunning...",
-			getNonRecursivePackageName(t.pkg),
-			fails,
-		)
-
-		pc := make(chan error, len(failingTests))
-		for _, f := range failingTests {
-			go tryIndividualTest(f, pc)
-		}
-		for i := 0; i < len(failingTests); i++ {
-			if e := <-pc; e != nil {
-				c <- e
-				return
-			}
+		r.finish(t)
+		r.Outcome = OutcomePass
+		if r.Passes < t.trials {
+			r.Outcome = OutcomeFlaky
 		}
-		c <- nil
 	}
+	c <- r
 }
 
-func tryTest(t *test, c chan error) {
-	if t.name != "" {
+// only gets to send one result on the given channel
+func tryPackageTest(t *test, c chan *TestResult) {
+	r := newTestResult(t)
+	start := time.Now()
+	o, e := runTest(t)
+	r.addTrial(time.Since(start), o, trialOutcome(t, o, e))
+	// the package didn't run for its before= hook failing, so try it again
+	for isHookError(e) && t.trials < t.trialsAllowed {
+		logTest(t)
+		logTrialf(t, "- FAIL (%v) %d/%d: %v", time.Since(start), t.trials, t.trialsAllowed, e)
+		logFailure(t, r, o, e)
+		start = time.Now()
+		o, e = runTest(t)
+		r.addTrial(time.Since(start), o, trialOutcome(t, o, e))
+	}
+	if isHookError(e) {
+		logTest(t)
+		logTrialf(t, "- FAIL (%v) %d/%d: %v", time.Since(start), t.trials, t.trialsAllowed, e)
+		logFailure(t, r, o, e)
+		r.fail(t, fmt.Errorf("FAIL %s: %v", t.pkg, e))
+		c <- r
+		return
+	}
+	if e == nil {
+		logTest(t)
+		if t.skipped(o) {
+			logTrialf(t, "- SKIP (%v)", time.Since(start))
+			r.skip(t)
+		} else {
+			logTrialf(t, "- PASS (%v)", time.Since(start))
+			r.pass(t)
+		}
+		logOutput(t, o)
+		c <- r
+		return
+	}
+	logTest(t)
+	logTrialf(t, "- FAIL (%v)", time.Since(start))
+	logFailure(t, r, o, e)
+
+	if r.notePanic(o) && t.noRetryOnPanic {
+		t.logf("%s: panicked in %s, not retrying", t, r.PanicIn)
+		r.fail(t, fmt.Errorf("FAIL %s: panic in %s", t.pkg, r.PanicIn))
+		c <- r
+		return
+	}
+
+	if r.noteRace(o) && !t.retryRaces {
+		t.logf("%s: data race, not retrying", t)
+		r.fail(t, fmt.Errorf("FAIL %s: data race", t.pkg))
+		c <- r
+		return
+	}
+
+	if !t.retryable(o) {
+		t.logf("%s: output matches no retry pattern, not retrying", t)
+		r.fail(t, fmt.Errorf("FAIL %s", t.pkg))
+		c <- r
+		return
+	}
+
+	if grepBuildFailed(o) {
+		r.BuildFailed = true
+		r.fail(t, fmt.Errorf("FAIL %s: build failed", t.pkg))
+		c <- r
+		return
+	}
+
+	fails, perr := t.parseFailures(o)
+	if perr != nil {
+		r.fail(t, fmt.Errorf("FAIL %s: could not parse the failures: %w", t.pkg, perr))
+		c <- r
+		return
+	}
+	fails = leafFailures(fails)
+	if len(fails) == 0 {
+		// eg. killed, or cut short before go test reported anything
+		t.logf("%s reported failure, but no failing tests or packages were discovered, err=%v; retrying it as a whole", t.pkg, e)
+		fails = []failure{{}}
+	}
+
+	var failingTests []*test
+	var names []string
+	for _, f := range fails {
+		rt := t.rerun(f)
+		failingTests = append(failingTests, rt)
+		names = append(names, strings.TrimSpace(rt.pkg+" "+rt.name))
+	}
+	t.logf("Found failing test(s) in %s: %v. Rerunning...",
+		t.pkg,
+		names,
+	)
+
+	pc := make(chan *TestResult, len(failingTests))
+	rerun := failingTests
+	if t.rerunBatch > 1 {
+		rerun = rerunBatched(t, failingTests, pc)
+	}
+	// each rerun is a go test process of its own, taking a slot of its
+	// own; the package's is given up to them rather than held meanwhile
+	t.releaseSlot()
+	for _, f := range rerun {
+		// reruns of a serial package mustn't overlap each other either
+		if t.serial {
+			tryRerun(f, pc)
+		} else {
+			go tryRerun(f, pc)
+		}
+	}
+	var err error
+	for i := 0; i < len(failingTests); i++ {
+		rr := <-pc
+		r.Reruns = append(r.Reruns, rr)
+		if rr.err != nil && err == nil {
+			err = rr.err
+		}
+	}
+	r.Duration = time.Since(start)
+	if err != nil {
+		r.fail(t, err)
+	} else {
+		r.pass(t)
+	}
+	c <- r
+}
+
+// tryRerun reruns a failing test of a package once it gets a slot
+func tryRerun(t *test, c chan *TestResult) {
+	if err := t.acquireSlot(); err != nil {
+		r := newTestResult(t)
+		r.fail(t, fmt.Errorf("FAIL %s %s: stopped: %w", t.pkg, t.name, err))
+		c <- r
+		return
+	}
+	defer t.releaseSlot()
+	tryIndividualTest(t, c)
+}
+
+func tryTest(t *test, c chan *TestResult) {
+	if t.serial {
+		serialLock.Lock()
+		defer serialLock.Unlock()
+	} else {
+		serialLock.RLock()
+		defer serialLock.RUnlock()
+	}
+	if t.mustFail {
+		tryMustFailTest(t, c)
+	} else if t.minPasses > 0 {
+		tryThresholdTest(t, c)
+	} else if t.bench {
+		tryBenchTest(t, c)
+	} else if t.name != "" || t.command != "" {
 		tryIndividualTest(t, c)
 	} else {
 		tryPackageTest(t, c)
 	}
 }
 
-func Run(testsFile, whitelistMatch, blacklistMatch string, trialsN int) {
-	e := run(testsFile, whitelistMatch, blacklistMatch, trialsN)
+// Run runs the tests configured by c and returns the exit code for the
+// outcome, see ExitOK and friends. Like Runner.Run, it waits for any other
+// run to be done before starting.
+func Run(c *Config) int {
+	r := NewRunner(WithConfig(*c))
+	if c.JSONSummary {
+		// keep stdout for the summary
+		r.trialOutput = os.Stderr
+	}
+	// an interrupt stops the run, killing the trials running, and still
+	// tears down and reports; a second one exits right away
+	ctx, stop := interruptContext()
+	defer stop()
+	report, e := r.Run(ctx)
 	if e != nil {
-		log.Fatal(e)
+		c.logln(e)
+	}
+	code := exitCode(c, report, e)
+	if c.JSONSummary {
+		if err := writeJSONSummary(os.Stdout, report, code); err != nil {
+			c.logln("could not write JSON summary:", err)
+		}
+	}
+	return code
+}
+
+// runAndReport runs the tests configured by c until ctx is done, and writes
+// out the report and notifies the webhook, if configured
+func runAndReport(ctx context.Context, c *Config) (*Report, error) {
+	report, e := runContext(ctx, c)
+	// write the report even for failed runs
+	if c.ReportFile != "" && report != nil {
+		report.setError(e)
+		if err := report.WriteFile(c.ReportFile); err != nil {
+			c.logln("could not write report:", err)
+		}
+	}
+	if c.JUnitFile != "" && report != nil {
+		if err := report.WriteJUnit(c.JUnitFile); err != nil {
+			c.logln("could not write JUnit report:", err)
+		}
+	}
+	if c.HTMLFile != "" && report != nil {
+		if err := report.WriteHTML(c.HTMLFile); err != nil {
+			c.logln("could not write HTML report:", err)
+		}
+	}
+	if c.WriteQuarantineFile != "" && report != nil {
+		if err := report.WriteQuarantine(c.WriteQuarantineFile); err != nil {
+			c.logln("could not write quarantine file:", err)
+		}
+	}
+	if path := os.Getenv("GITHUB_STEP_SUMMARY"); c.Format == FormatGitHub && path != "" && report != nil {
+		if err := report.writeGitHubSummary(path); err != nil {
+			c.logln("could not write job summary:", err)
+		}
+	}
+	// failing to notify doesn't change the outcome
+	if c.Webhook != nil && report != nil {
+		if err := c.Webhook.notify(report); err != nil {
+			c.logln("could not notify webhook:", err)
+		}
 	}
+	return report, e
 }
 
-func run(testsFile, whitelistMatch, blacklistMatch string, trialsN int) error {
-	if trialsN == 0 {
-		return fmt.Errorf("trials allowed must be >0, got: %d", trialsAllowed)
+// interruptContext returns a context done once the process is interrupted
+// or terminated. The trials run in process groups of their own, which the
+// terminal's interrupt doesn't reach, so they must be killed when it's done.
+// After the first, signals are handled as usual again, so a second interrupt
+// exits right away.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
+
+func run(c *Config) (*Report, error) {
+	return runContext(context.Background(), c)
+}
+
+// runContext runs the tests configured by c, stopping them once ctx is done
+func runContext(parent context.Context, c *Config) (*Report, error) {
+	if c.log == nil {
+		c.log = newRunLogger(log.Default())
 	}
-	trialsAllowed = trialsN
+	whites := parseMatchList(c.WhitelistMatch)
+	blacks := parseMatchList(c.BlacklistMatch)
 
-	whites := parseMatchList(whitelistMatch)
-	blacks := parseMatchList(blacklistMatch)
+	testsFiles := c.testsFiles()
+	report := newReport(testsFiles, whites, blacks, c.trialsAllowed())
 
-	testsFile = filepath.Clean(testsFile)
-	testsFile, _ = filepath.Abs(testsFile)
+	if err := c.Validate(); err != nil {
+		return report, err
+	}
+	if err := setColor(c.Color); err != nil {
+		return report, err
+	}
+	// the live view, if it can be shown, instead of logging every trial
+	out, ok := stdout.(*os.File)
+	tuiOn := c.TUI && ok && isTerminal(out)
+	if c.TUI && !tuiOn {
+		c.logln("WARNING: not on a terminal, logging tests rather than showing them live")
+	}
+	if tuiOn {
+		compact = true
+	}
 
-	allowed := func(t *test) bool {
-		return lineMatchList(t.pkg+" "+t.name, whites, blacks)
+	// before anything is built or looked at, as the setup may generate code
+	// or start services the build depends on
+	if len(c.Setup) > 0 || len(c.Teardown) > 0 {
+		teardown, err := setUp(parent, c, report)
+		defer teardown()
+		if err != nil {
+			return report, err
+		}
 	}
 
-	alltests, err := collectTestsFromFile(testsFile)
+	alltests, err := c.loadTests()
 	if err != nil {
-		return err
+		return report, err
+	}
+	tests := filterTests(alltests, c.selected)
+	if len(tests) == 0 && c.FailOnNoMatch {
+		return report, noMatchError(alltests, c)
+	}
+	if c.RerunFrom != "" {
+		prev, err := ReadReport(c.RerunFrom)
+		if err != nil {
+			return report, err
+		}
+		tests = filterTests(tests, prev.unsettled)
+		c.logf("* rerunning %d tests which failed or were flaky in %s", len(tests), c.RerunFrom)
+	}
+	bins, err := c.precompile(tests)
+	if err != nil {
+		return report, err
+	}
+	defer bins.remove()
+
+	c.logln("* go executable path:", goExecutablePath)
+	if v, err := goVersion(goExecutablePath); err != nil {
+		c.logln("could not get go version:", err)
+	} else {
+		c.logln("* go version:", v)
+	}
+	c.logln("* command prefix:", strings.Join(commandPrefix, " "))
+	c.logln("* tests files:", strings.Join(testsFiles, ", "))
+	if c.WorkDir != "" {
+		c.logln("* working directory:", c.WorkDir)
+	}
+	c.logln("* trials allowed: ", c.trialsAllowed())
+	if c.CI {
+		c.logln("* on CI, with citrials=")
+	}
+	c.logln("* blacklist: ", blacks)
+	c.logln("* whitelist: ", whites)
+
+	var st *state
+	if c.StateFile != "" {
+		st, err = readState(c.StateFile)
+		if err != nil {
+			return report, err
+		}
+		var torun []*test
+		for _, t := range tests {
+			if st.fresh(t, c.StateTTL, report.Start) {
+				r := newResumedResult(t)
+				report.Tests = append(report.Tests, r)
+				printResult(r)
+				c.onResult(r)
+				continue
+			}
+			torun = append(torun, t)
+		}
+		c.logln("* state file:", c.StateFile)
+		c.logf("* skipping %d tests passed within %v", len(tests)-len(torun), c.StateTTL)
+		tests = torun
+	}
+
+	var stable *stableSet
+	if c.SkipStable != "" {
+		stable, err = readStable(c.SkipStable)
+		if err != nil {
+			return report, err
+		}
+		var torun []*test
+		for _, t := range tests {
+			if stable.stable(t) {
+				r := newStableResult(t)
+				report.Tests = append(report.Tests, r)
+				printResult(r)
+				c.onResult(r)
+				continue
+			}
+			torun = append(torun, t)
+		}
+		c.logln("* stable file:", c.SkipStable)
+		c.logf("* skipping %d tests which passed first try, their packages unchanged since", len(tests)-len(torun))
+		tests = torun
+	}
+
+	if c.ChangedSince != "" {
+		dir := c.WorkDir
+		if dir == "" {
+			dir = "."
+		}
+		ch, err := changedSince(dir, c.ChangedSince)
+		if err != nil {
+			c.logf("WARNING could not tell what changed since %s, running all tests: %v", c.ChangedSince, err)
+		} else if ch.all {
+			c.logf("* go.mod or go.sum changed since %s, running all tests", c.ChangedSince)
+		} else {
+			var torun []*test
+			for _, t := range tests {
+				if !ch.touched(t) {
+					r := newUnchangedResult(t)
+					report.Tests = append(report.Tests, r)
+					printResult(r)
+					c.onResult(r)
+					continue
+				}
+				torun = append(torun, t)
+			}
+			c.logf("* skipping %d tests of packages unchanged since %s", len(tests)-len(torun), c.ChangedSince)
+			tests = torun
+		}
+	}
+
+	if c.ShardTotal > 1 {
+		tests = shardTests(tests, c.ShardIndex, c.ShardTotal)
+		report.Shard = fmt.Sprintf("%d/%d", c.ShardIndex, c.ShardTotal)
+		c.logf("* shard %s: %d tests", report.Shard, len(tests))
+	}
+
+	if c.Shuffle {
+		seed := shuffleTests(tests, c.Seed)
+		report.Seed = seed
+		c.logln("* shuffle seed:", seed)
+	}
+
+	if c.CoverProfile != "" {
+		coverDir, err := ioutil.TempDir("", "schroedinger-cover")
+		if err != nil {
+			return report, err
+		}
+		defer os.RemoveAll(coverDir)
+		for _, t := range tests {
+			t.coverDir = coverDir
+		}
+		defer func() {
+			var profiles []string
+			for _, r := range report.Tests {
+				if r.coverProfile != "" {
+					profiles = append(profiles, r.coverProfile)
+				}
+			}
+			if c.CoverAllTrials {
+				// every trial wrote its own
+				profiles, _ = filepath.Glob(filepath.Join(coverDir, "*.out"))
+			}
+			pct, err := mergeCoverProfiles(profiles, c.CoverProfile, c.CoverAllTrials)
+			if err != nil {
+				c.logln("could not merge coverage profiles:", err)
+				return
+			}
+			report.Coverage = pct
+			c.logf("* coverage: %.1f%% of statements, written to %s", pct, c.CoverProfile)
+		}()
 	}
 
-	tests := filterTests(alltests, allowed)
+	c.logf("* running %d/%d tests", len(tests), len(alltests))
 
-	log.Println("* go executable path:", goExecutablePath)
-	log.Println("* command prefix:", strings.Join(commandPrefix, " "))
-	log.Println("* tests file:", testsFile)
-	log.Println("* trials allowed: ", trialsAllowed)
-	log.Println("* blacklist: ", blacks)
-	log.Println("* whitelist: ", whites)
-	log.Printf("* running %d/%d tests", len(tests), len(alltests))
+	var m *metrics
+	if c.MetricsAddr != "" || c.MetricsPushURL != "" {
+		m = newMetrics()
+	}
+	if c.MetricsAddr != "" {
+		stop, err := serveMetrics(c.MetricsAddr, m)
+		if err != nil {
+			return report, err
+		}
+		defer stop()
+		c.logf("* metrics: http://%s/metrics", c.MetricsAddr)
+	}
+	if c.MetricsPushURL != "" {
+		// failing to push doesn't change the outcome
+		defer func() {
+			if err := pushMetrics(c.MetricsPushURL, m); err != nil {
+				c.logln("could not push metrics:", err)
+			}
+		}()
+	}
 
-	var results = make(chan error, len(tests))
+	var events *eventLog
+	if c.EventsFile != "" {
+		events, err = createEventLog(c.EventsFile)
+		if err != nil {
+			return report, err
+		}
+		defer events.close()
+		for _, t := range tests {
+			t.events = events
+		}
+	}
+
+	var results = make(chan *TestResult, len(tests))
 
-	allstart := time.Now()
 	defer func() {
-		log.Printf("FINISHED (%v)", time.Since(allstart))
+		report.sortTests(alltests)
+		report.Duration = time.Since(report.Start)
+		report.TrialsDuration = report.trialsDuration()
+		c.logf("FINISHED (%v, %v in trials)", report.Duration, report.TrialsDuration)
+		c.logln(report.Summary())
+		if q := report.quarantineSummary(); q != "" {
+			c.logln(q)
+		}
+		if rs := report.raceSummary(); rs != "" {
+			c.logln(rs)
+		}
+		if n := report.flakyNotice(c.flakyPolicy()); n != "" {
+			c.logln(n)
+		}
+		report.Failures = report.GroupFailures()
+		if len(report.Failures) > 0 {
+			c.logf("FAILURES (%d distinct):", len(report.Failures))
+			for _, g := range report.Failures {
+				c.logf("  %dx %s", g.Count, g.Signature)
+				for _, t := range g.Tests {
+					c.logf("    %s", t)
+				}
+			}
+		}
+		if c.FailUnder > 0 {
+			c.logf("* flaky rate: %.1f%%, limit %.1f%%", 100*report.FlakyRate(), 100*c.FailUnder)
+		}
+		events.runFinished(report)
+		for _, r := range report.Tests {
+			logPanics(c.log, r)
+		}
+		if c.Top > 0 {
+			c.logf("SLOWEST %d:", c.Top)
+			for _, r := range report.Slowest(c.Top) {
+				c.logf("  %v %s (%d trials)", r.Duration, r, r.Trials)
+			}
+		}
+		if st != nil {
+			st.update(report.Tests, time.Now())
+			if err := st.write(c.StateFile); err != nil {
+				c.logln("could not write state file:", err)
+			}
+		}
+		if stable != nil {
+			stable.update(alltests, report.Tests, time.Now())
+			if err := stable.write(c.SkipStable); err != nil {
+				c.logln("could not write stable file:", err)
+			}
+		}
+		if c.HistoryFile != "" {
+			if err := updateHistory(c, report); err != nil {
+				c.logln("could not update history file:", err)
+			}
+		}
 	}()
 
+	if c.OrderedOutput && !compact {
+		for _, t := range tests {
+			t.ordered = &testLog{}
+		}
+	}
+
+	prog := newProgress(len(tests), c.log)
+	if c.Heartbeat > 0 {
+		defer prog.heartbeat(c.Heartbeat)()
+	}
 	for _, t := range tests {
-		go tryTest(t, results)
+		t.progress, t.progressKey = prog, t.pkg+" "+t.name
+	}
+	if c.StatusFile != "" {
+		defer prog.writeStatuses(c.StatusFile, report.Start)()
+		c.logln("* status file:", c.StatusFile)
+	}
+	if tuiOn {
+		defer startTUI(stdout, prog, tests, report.Start)()
+	}
+	if c.ArtifactsDir != "" {
+		for _, t := range tests {
+			t.artifacts = c.ArtifactsDir
+		}
+		c.logln("* trial outputs:", c.ArtifactsDir)
 	}
 
+	// bounds the number of go test processes running at once, if set
+	var pool *slots
+	// or by a limit which follows how the tests fare, instead
+	adaptive := newAdaptivePool(c.AdaptiveParallel, c.MaxParallel, c.log)
+	if adaptive != nil {
+		pool = newAdaptiveSlots(adaptive)
+		c.logf("* adaptive parallel: starting at %d, up to %d, target flake rate %.1f%%", adaptive.limit, adaptive.max, 100*c.AdaptiveParallel)
+	} else if c.MaxParallel > 0 {
+		pool = newSlots(c.MaxParallel)
+		c.logln("* max parallel:", c.MaxParallel)
+	}
+
+	// spaces out trials, if set
+	limit := newLimiter(c.MaxStartsPerSecond)
+	if limit != nil {
+		c.logln("* max starts per second:", c.MaxStartsPerSecond)
+	}
+	// stops tests which haven't started yet once the run is over, or out
+	// of time
+	ctx, cancel := context.WithCancel(parent)
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, c.Timeout)
+		c.logln("* timeout:", c.Timeout)
+	}
+	defer cancel()
+
+	// once the run stops, waits for the trials killed to be gone
+	var running sync.WaitGroup
+	defer running.Wait()
+	for _, t := range tests {
+		t.ctx = ctx
+		t.slots, t.limit = pool, limit
+		running.Add(1)
+		go func(t *test) {
+			defer running.Done()
+			if t.acquireSlot() != nil {
+				return
+			}
+			defer t.releaseSlot()
+			m.started()
+			prog.started(t, time.Now())
+			events.testStarted(t)
+			tryTest(t, results)
+		}(t)
+	}
+
+	maxFailures := c.MaxFailures
+	if maxFailures < 1 {
+		maxFailures = 1
+	}
+	var failed []*TestResult
 	for i := 0; i < len(tests); i++ {
-		if e := <-results; e != nil {
-			return e
+		var r *TestResult
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			// the deadline, or the caller's; tests waiting to start never will
+			reason := "cancelled"
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				reason = "timed out"
+				if c.Timeout > 0 {
+					reason += fmt.Sprintf(" after %v", c.Timeout)
+				}
+			}
+			report.stop(reason, tests)
+			c.logf("STOPPED, %s; not run or cut short: %v", reason, report.NotRun)
+			return report, fmt.Errorf("run: %w", ctx.Err())
+		}
+		r.Finished = time.Now()
+		report.Tests = append(report.Tests, r)
+		m.finished(r)
+		prog.finished(r)
+		adaptive.observe(r)
+		flushOrdered(c.log, r)
+		if !tuiOn {
+			printResult(r)
+		}
+		if c.Format == FormatGitHub {
+			annotate(stdout, r)
+		}
+		if r.Outcome == OutcomeFlaky && !r.Quarantined && c.flakyPolicy() != FlakyIgnore {
+			c.logf("WARNING FLAKY %s: passed only after failing (%d trials)", r, r.Trials)
+		}
+		c.onResult(r)
+		events.testFinished(r)
+		if c.OutputDir != "" {
+			if err := writeRepros(c.log, c.OutputDir, r, report.Seed); err != nil {
+				c.logln("could not write repro:", err)
+			}
+			if err := writeTrialOutputs(c.OutputDir, r); err != nil {
+				c.logln("could not write trial output:", err)
+			}
+		}
+		if r.err != nil && !r.Quarantined {
+			failed = append(failed, r)
+			if !c.KeepGoing && len(failed) >= maxFailures {
+				// in-flight tests are killed, and the rest not started
+				cancel()
+				report.stop(fmt.Sprintf("%d tests failed", len(failed)), tests)
+				c.logf("STOPPED after %d failed tests; not run or cut short: %v", len(failed), report.NotRun)
+				if len(failed) == 1 {
+					return report, r.err
+				}
+				return report, failedError(failed)
+			}
 		}
 	}
 
 	close(results)
-	return nil
+	if c.KeepGoing && len(failed) > 0 {
+		return report, keepGoingError(failed)
+	}
+	return report, nil
 }
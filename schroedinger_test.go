@@ -1,9 +1,18 @@
 package schroedinger
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,12 +53,352 @@ ok  	github.com/ethereumproject/go-ethereum/p2p/discover	6.374s
 ok  	github.com/ethereumproject/go-ethereum/p2p/distip	0.014s
 `
 
-	if failures := grepFailures([]byte(outputWithFails)); len(failures) != 1 {
+	if failures, _ := grepFailures([]byte(outputWithFails)); len(failures) != 1 {
 		t.Errorf("got %v, want: %v", len(failures), 1)
 	}
-	if failures := grepFailures([]byte(outputOK)); len(failures) != 0 {
+	if failures, _ := grepFailures([]byte(outputOK)); len(failures) != 0 {
 		t.Errorf("got %v, want: %v", len(failures), 0)
 	}
+
+	var outputOdd = `
+--- FAIL: TestNoDuration
+--- FAIL: TestTable (0.01s)
+    --- FAIL: TestTable/key:value (0.00s)
+        table_test.go:12: got: 1, want: 2
+	--- FAIL: TestTable/a/b_c
+FAIL: not a test line
+FAIL	github.com/ethereumproject/go-ethereum/p2p/nat	2.664s
+--- FAIL:
+`
+	nat := "github.com/ethereumproject/go-ethereum/p2p/nat"
+	want := []failure{{nat, "TestNoDuration"}, {nat, "TestTable"}, {nat, "TestTable/key:value"}, {nat, "TestTable/a/b_c"}}
+	if failures, _ := grepFailures([]byte(outputOdd)); !reflect.DeepEqual(failures, want) {
+		t.Errorf("got %v, want: %v", failures, want)
+	}
+}
+
+func TestGrepFailuresPackage(t *testing.T) {
+	// go test ./p2p/..., where the TestMain of nat exits 1
+	out := `ok  	github.com/ethereumproject/go-ethereum/p2p	0.395s
+--- FAIL: TestUDP_findnode (0.10s)
+FAIL
+FAIL	github.com/ethereumproject/go-ethereum/p2p/discover	6.374s
+exit status 1
+FAIL	github.com/ethereumproject/go-ethereum/p2p/nat	0.001s
+`
+	want := []failure{
+		{"github.com/ethereumproject/go-ethereum/p2p/discover", "TestUDP_findnode"},
+		{"github.com/ethereumproject/go-ethereum/p2p/nat", ""},
+	}
+	got, err := grepFailures([]byte(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got: %v, want: %v", got, want)
+	}
+
+	// the package is rerun as a whole
+	pt := &test{pkg: filepath.FromSlash("./p2p/..."), dir: "src", trials: 1}
+	rt := pt.rerun(got[1])
+	if dir, pkg := rt.goArgs(); rt.name != "" || pkg != "github.com/ethereumproject/go-ethereum/p2p/nat" || dir != "src" {
+		t.Errorf("got: %q %s %s", rt.name, pkg, dir)
+	}
+	// with nothing discovered, the package as given is
+	rt = pt.rerun(failure{})
+	if rt.pkg != pt.pkg || rt.name != "" {
+		t.Errorf("got: %s %q", rt.pkg, rt.name)
+	}
+}
+
+func TestGrepFailuresTimeout(t *testing.T) {
+	out := `ok  	github.com/ethereumproject/go-ethereum/p2p	0.395s
+panic: test timed out after 1m0s
+running tests:
+	TestSync (1m0s)
+	TestSync/fast (59s)
+
+goroutine 17 [running]:
+testing.(*M).startAlarm.func1()
+	/usr/local/go/src/testing/testing.go:2259 +0x3b9
+FAIL	github.com/ethereumproject/go-ethereum/eth	60.012s
+`
+	eth := "github.com/ethereumproject/go-ethereum/eth"
+	want := []failure{{eth, "TestSync"}, {eth, "TestSync/fast"}}
+	if got, _ := grepFailures([]byte(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	// a timeout is retryable, no panic
+	r := &TestResult{}
+	if r.notePanic([]byte(out)) || !r.TimedOut || r.Panic != "" {
+		t.Errorf("got: %+v, want a timeout", r)
+	}
+}
+
+func TestRerunFailingPackage(t *testing.T) {
+	// go test ./p2p/...
+	out := `ok  	github.com/ethereumproject/go-ethereum/p2p	0.395s
+--- FAIL: TestUDP_findnode (0.10s)
+FAIL
+FAIL	github.com/ethereumproject/go-ethereum/p2p/discover	6.374s
+--- FAIL: TestUPNP_DDWRT (2.10s)
+FAIL
+FAIL	github.com/ethereumproject/go-ethereum/p2p/nat	2.664s
+--- FAIL: TestTruncated
+`
+	pt := &test{pkg: filepath.FromSlash("./p2p/..."), dir: "src"}
+	var got [][3]string
+	fails, _ := grepFailures([]byte(out))
+	for _, f := range fails {
+		rt := pt.rerun(f)
+		dir, pkg := rt.goArgs()
+		got = append(got, [3]string{rt.name, pkg, dir})
+	}
+	want := [][3]string{
+		{"TestUDP_findnode", "github.com/ethereumproject/go-ethereum/p2p/discover", "src"},
+		{"TestUPNP_DDWRT", "github.com/ethereumproject/go-ethereum/p2p/nat", "src"},
+		// no package reported, so run from the top of the recursive package
+		{"TestTruncated", filepath.FromSlash("./p2p"), "src"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	// a single package's failures stay as the package was given
+	pt = &test{pkg: filepath.FromSlash("./p2p/nat"), dir: "src"}
+	rt := pt.rerun(failure{"github.com/ethereumproject/go-ethereum/p2p/nat", "TestUPNP_DDWRT"})
+	if dir, pkg := rt.goArgs(); pkg != filepath.FromSlash("./p2p/nat") || dir != "src" || rt.pkg != pkg {
+		t.Errorf("got: %s %s %s", rt.pkg, pkg, dir)
+	}
+}
+
+func TestGrepSkipped(t *testing.T) {
+	cases := []struct {
+		out   string
+		named bool
+		want  bool
+	}{
+		{"=== RUN   TestCat\n--- SKIP: TestCat (0.00s)\n    schroedinger_test.go:17: No peeking!\nPASS\nok  \tpkg\t0.01s\n", true, true},
+		{"=== RUN   TestCat\n--- PASS: TestCat (0.00s)\nPASS\nok  \tpkg\t0.01s\n", true, false},
+		{"testing: warning: no tests to run\nPASS\nok  \tpkg\t0.01s [no tests to run]\n", true, true},
+		{"ok  \tpkg\t0.01s\n?   \tpkg/cmd\t[no test files]\n", false, false},
+		{"?   \tpkg/cmd\t[no test files]\n", false, true},
+		{"ok  \tpkg\t(cached)\n", false, true},
+		{"ok  \tpkg\t(cached)\nok  \tpkg/sub\t0.01s\n", false, false},
+		// replayed from the cache
+		{"=== RUN   TestCat\n--- PASS: TestCat (0.00s)\nPASS\nok  \tpkg\t(cached)\n", true, true},
+	}
+	for i, c := range cases {
+		if got := grepSkipped([]byte(c.out), c.named); got != c.want {
+			t.Errorf("%d: got: %v, want: %v", i, got, c.want)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tt := &test{}
+	if !tt.retryable([]byte("assertion failed")) {
+		t.Error("want everything retryable without patterns")
+	}
+	tt.retryIf = []*regexp.Regexp{regexp.MustCompile("connection refused"), regexp.MustCompile("address already in use")}
+	if !tt.retryable([]byte("dial tcp 127.0.0.1:8545: connection refused")) {
+		t.Error("want matching output retryable")
+	}
+	if tt.retryable([]byte("got 1, want 2")) {
+		t.Error("want non-matching output not retryable")
+	}
+}
+
+func TestRunPattern(t *testing.T) {
+	cases := map[string]string{
+		"TestSync":              "TestSync",
+		"TestSync/fast_mode":    "^TestSync$/^fast_mode$",
+		"TestSync/fast/light":   "^TestSync$/^fast$/^light$",
+		"TestSync/fast.*":       "^TestSync$/fast.*",
+		"TestSync/":             "^TestSync$/",
+		"TestSync.*/fast_mode$": "TestSync.*/fast_mode$",
+	}
+	for name, want := range cases {
+		if got := runPattern(name); got != want {
+			t.Errorf("%s: got: %s, want: %s", name, got, want)
+		}
+	}
+}
+
+func TestLeafFailures(t *testing.T) {
+	fails := []failure{
+		{"./eth", "TestSync/fast_mode/light"},
+		{"./eth", "TestSync/fast_mode"},
+		{"./eth", "TestSync"},
+		{"./eth", "TestSyncSlow"},
+		{"./p2p", "TestSync"},
+		{"./les", ""},
+	}
+	want := []failure{{"./eth", "TestSync/fast_mode/light"}, {"./eth", "TestSyncSlow"}, {"./p2p", "TestSync"}, {"./les", ""}}
+	if got := leafFailures(fails); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+}
+
+func TestRerunSubtest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go which logs its arguments, and fails TestSync/fast_mode in the
+	// package run
+	fake := filepath.Join(dir, "go")
+	script := `#!/bin/sh
+echo "$@" >> ` + filepath.Join(dir, "args") + `
+case "$*" in
+*-run*) echo '--- PASS: TestSync (0.00s)'; echo PASS;;
+*)
+	echo '    --- FAIL: TestSync/fast_mode (0.00s)'
+	echo '--- FAIL: TestSync (0.00s)'
+	echo 'FAIL'
+	exit 1;;
+esac
+`
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+
+	c := make(chan *TestResult, 1)
+	tryPackageTest(&test{pkg: "./eth", dir: dir, trialsAllowed: 3}, c)
+	r := <-c
+	if r.Outcome != OutcomeFlaky || len(r.Reruns) != 1 || r.Reruns[0].Name != "TestSync/fast_mode" {
+		t.Fatalf("got: %s, reruns: %v", r.Outcome, r.Reruns)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(args)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "-run ^TestSync$/^fast_mode$") {
+		t.Errorf("got runs: %q", lines)
+	}
+}
+
+func TestResolveTrials(t *testing.T) {
+	parent := &test{pkg: "p", name: "TestSync", trialsAllowed: 5}
+	child := &test{pkg: "p", name: "TestSync/fast"}
+	leaf := &test{pkg: "p", name: "TestSync/fast/light"}
+	own := &test{pkg: "p", name: "TestSync/full", trialsAllowed: 2}
+	ownLeaf := &test{pkg: "p", name: "TestSync/full/light"}
+	other := &test{pkg: "q", name: "TestSync/fast"}
+	unlisted := &test{pkg: "p", name: "TestFetch/fast"}
+	pkg := &test{pkg: "p"}
+	resolveTrials([]*test{leaf, ownLeaf, child, parent, own, other, unlisted, pkg}, 3, false, nil)
+
+	cases := []struct {
+		t    *test
+		want int
+	}{
+		{parent, 5},   // test-level
+		{own, 2},      // case-level overrides the test
+		{child, 5},    // case inherits from the test, not the global
+		{leaf, 5},     // from the nearest listed parent with trials
+		{ownLeaf, 2},  // from the nearest listed parent, not the test
+		{other, 3},    // parents in other packages don't count
+		{unlisted, 3}, // parent not listed: global
+		{pkg, 3},      // global
+	}
+	for _, c := range cases {
+		if c.t.trialsAllowed != c.want {
+			t.Errorf("%v: got: %d, want: %d", c.t, c.t.trialsAllowed, c.want)
+		}
+	}
+}
+
+func TestResolveTrialsCI(t *testing.T) {
+	parent := &test{pkg: "p", name: "TestSync", trialsAllowed: 5, ciTrials: 10}
+	child := &test{pkg: "p", name: "TestSync/fast"}
+	own := &test{pkg: "p", name: "TestSync/full", trialsAllowed: 2}
+	local := &test{pkg: "p", name: "TestFetch", trialsAllowed: 4}
+	ci := &test{pkg: "p", name: "TestDrop", ciTrials: 6}
+	tests := []*test{parent, child, own, local, ci}
+	cases := []struct {
+		ci   bool
+		want []int
+	}{
+		{false, []int{5, 5, 2, 4, 3}},
+		{true, []int{10, 10, 2, 4, 6}},
+	}
+	for _, c := range cases {
+		for _, tt := range tests {
+			tt.trialsAllowed = map[*test]int{parent: 5, own: 2, local: 4}[tt]
+		}
+		resolveTrials(tests, 3, c.ci, nil)
+		for i, tt := range tests {
+			if tt.trialsAllowed != c.want[i] {
+				t.Errorf("ci=%v %v: got: %d, want: %d", c.ci, tt, tt.trialsAllowed, c.want[i])
+			}
+		}
+	}
+
+	c := &Config{TrialsAllowed: 3, CITrialsAllowed: 8}
+	if n := c.trialsAllowed(); n != 3 {
+		t.Errorf("off CI: got: %d, want: 3", n)
+	}
+	c.CI = true
+	if n := c.trialsAllowed(); n != 8 {
+		t.Errorf("on CI: got: %d, want: 8", n)
+	}
+}
+
+func TestResolveTrialsOverrides(t *testing.T) {
+	own := &test{pkg: "./eth", name: "TestSync", trialsAllowed: 5, ciTrials: 7}
+	child := &test{pkg: "./eth", name: "TestSync/fast"}
+	global := &test{pkg: "./eth", name: "TestFetch"}
+	exact := &test{pkg: "./p2p", name: "TestDial"}
+	longer := &test{pkg: "./p2p", name: "TestDialer"}
+	untouched := &test{pkg: "./p2p", name: "TestPeer", trialsAllowed: 2}
+	overrides := map[string]int{
+		"TestSync":  9,  // substring of the child too
+		"Fetch":     4,  // substring
+		"TestDial":  11, // exact for TestDial, substring for TestDialer
+		"p2p TestD": 12, // longer substring than TestDial for TestDialer
+	}
+	resolveTrials([]*test{own, child, global, exact, longer, untouched}, 3, true, overrides)
+	cases := []struct {
+		t    *test
+		want int
+	}{
+		{own, 9}, // over trials= and citrials=
+		{child, 9},
+		{global, 4}, // over the global
+		{exact, 11},
+		{longer, 12},
+		{untouched, 2},
+	}
+	for _, c := range cases {
+		if c.t.trialsAllowed != c.want {
+			t.Errorf("%v: got: %d, want: %d", c.t, c.t.trialsAllowed, c.want)
+		}
+	}
+}
+
+func TestParseTestList(t *testing.T) {
+	out := `TestSync
+TestFetch
+ok  	github.com/ethereumproject/go-ethereum/eth	0.002s
+?   	github.com/ethereumproject/go-ethereum/cmd	[no test files]
+TestDial
+ExampleDial
+ok  	github.com/ethereumproject/go-ethereum/p2p	0.002s
+`
+	want := []listedTest{
+		{"github.com/ethereumproject/go-ethereum/eth", "TestSync"},
+		{"github.com/ethereumproject/go-ethereum/eth", "TestFetch"},
+		{"github.com/ethereumproject/go-ethereum/p2p", "TestDial"},
+		{"github.com/ethereumproject/go-ethereum/p2p", "ExampleDial"},
+	}
+	if got := parseTestList([]byte(out)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
 }
 
 func TestParseMatchList(t *testing.T) {
@@ -67,15 +416,449 @@ func TestParseMatchList(t *testing.T) {
 	}
 }
 
+func TestLineMatchList(t *testing.T) {
+	cases := []struct {
+		line, whites, blacks, mode string
+		want                       bool
+	}{
+		{"./asyncpool TestPool", "sync", "", MatchSubstring, true},
+		{"./asyncpool TestPool", `\bsync`, "", MatchRegexp, false},
+		{"./eth/sync TestSync", `\bsync`, "", MatchRegexp, true},
+		// any whitelist pattern will do, not only the first
+		{"./p2p TestDial", "eth,p2p", "", "", true},
+		{"./p2p TestDial", "^./eth ,^./p2p ", "", MatchRegexp, true},
+		{"./p2p TestDialer", "TestDial$", "", MatchRegexp, false},
+		{"./p2p TestDial", "p2p", "Dial", "", false},
+		{"./p2p TestDial", "", "^./p2p TestDial$", MatchRegexp, false},
+	}
+	for _, c := range cases {
+		whites, err := compileMatchList(c.whites, c.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blacks, err := compileMatchList(c.blacks, c.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lineMatchList(c.line, whites, blacks); got != c.want {
+			t.Errorf("%q -w %q -b %q (%s): got: %v, want: %v", c.line, c.whites, c.blacks, c.mode, got, c.want)
+		}
+	}
+
+	c := &Config{TestsFiles: []string{"./example.txt"}, TrialsAllowed: 1, WhitelistMatch: "Test(", MatchMode: MatchRegexp}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "WhitelistMatch: ") {
+		t.Errorf("got: %v, want: bad pattern error", err)
+	}
+	c.MatchMode = "glob"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "MatchMode: ") {
+		t.Errorf("got: %v, want: unknown mode error", err)
+	}
+}
+
+func TestHandleLineOptions(t *testing.T) {
+	got, err := handleLine("./eth/downloader TestSync dir=../go-ethereum # comment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &test{pkg: filepath.FromSlash("./eth/downloader"), name: "TestSync", dir: filepath.FromSlash("../go-ethereum")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+	if _, err := handleLine("./eth/downloader TestSync nope=1"); err == nil || !strings.Contains(err.Error(), "unknown option: nope") {
+		t.Errorf("got: %v, want error for unknown option", err)
+	}
+
+	// a subtest name with a '=' isn't an option
+	got, err = handleLine("./eth TestLimits/limit=5 trials=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &test{pkg: filepath.FromSlash("./eth"), name: "TestLimits/limit=5", trialsAllowed: 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+
+	got, err = handleLine(`integration cmd="./it.sh -run 'a b' \"#1\"" trials=2 # comment`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &test{pkg: "integration", command: `./it.sh -run 'a b' "#1"`, trialsAllowed: 2}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+	if _, err := handleLine(`integration cmd="./it.sh`); err == nil {
+		t.Error("expected error for unterminated quote")
+	}
+}
+
+func TestHandleLineBlank(t *testing.T) {
+	cases := []struct {
+		line string
+		want error
+	}{
+		{"", errEmptyLine},
+		{"  ", errEmptyLine},
+		{" \t ", errEmptyLine},
+		{"# flaky", errCommentLine},
+		{"\t# flaky", errCommentLine},
+		{"  \t # flaky", errCommentLine},
+	}
+	for _, c := range cases {
+		if got, err := handleLine(c.line); err != c.want {
+			t.Errorf("%q: got: %v, %v, want: %v", c.line, got, err, c.want)
+		}
+	}
+}
+
+func TestEnvOption(t *testing.T) {
+	tt, err := handleLine(`./eth TestSync env=PGPORT=5433 env="GREETING=a b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"PGPORT=5433", "GREETING=a b"}; !reflect.DeepEqual(tt.vars, want) {
+		t.Errorf("got: %q, want: %q", tt.vars, want)
+	}
+	if env := tt.environ(); len(env) < 2 || env[len(env)-1] != "GREETING=a b" {
+		t.Errorf("got environment: %q", env)
+	}
+	if _, err := handleLine("./eth TestSync env=PGPORT"); err == nil {
+		t.Error("expected error for env without a value")
+	}
+	d := &Docker{Image: "golang", Env: []string{"GOFLAGS=-mod=mod"}}
+	if got := d.withEnv(tt.vars).Env; len(got) != 3 || len(d.Env) != 1 {
+		t.Errorf("got: %q, docker: %q", got, d.Env)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	tt, err = handleLine(`pg cmd="test $PGPORT = 5433" before="test $PGPORT = 5433" env=PGPORT=5433`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o, err := runTest(tt); err != nil {
+		t.Errorf("got: %v: %s", err, o)
+	}
+}
+
+func TestBuildTagsOption(t *testing.T) {
+	tt, err := handleLine("./eth TestSync buildtags=integration,,e2e tags=slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tt.buildTags != "integration,e2e" || !reflect.DeepEqual(tt.tags, []string{"slow"}) {
+		t.Errorf("got: buildtags %q, tags %q", tt.buildTags, tt.tags)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "go")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\necho ok\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+	tt.dir = dir
+	if o, err := runTrial(tt); err != nil {
+		t.Fatalf("got: %v: %s", err, o)
+	}
+	if !strings.Contains(tt.lastCmd, " -tags=integration,e2e") {
+		t.Errorf("got command: %s", tt.lastCmd)
+	}
+}
+
+func TestArgsOption(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "go")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\necho ok\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync args=\"-sync.peers=2  -v\"\n./p2p TestDial\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, GoBinary: fake, GoTestArgs: []string{"-short"}}
+	tests, err := c.loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{" -short -sync.peers=2 -v", " -short"}
+	for i, tt := range tests {
+		tt.dir = dir
+		if o, err := runTrial(tt); err != nil {
+			t.Fatalf("got: %v: %s", err, o)
+		}
+		if !strings.HasSuffix(tt.lastCmd, want[i]) {
+			t.Errorf("%s: got command: %s", tt, tt.lastCmd)
+		}
+	}
+	if c.GoTestArgs[0] != "-short" || len(c.GoTestArgs) != 1 {
+		t.Errorf("changed: %q", c.GoTestArgs)
+	}
+}
+
+func TestGoCommandDirect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// a go which prints its package argument, as one
+	fake := filepath.Join(dir, "go")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\necho \"pkg=$2\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	goExecutablePath = fake
+	tt := &test{pkg: "./my pkg", name: "TestSync/fast", dir: dir}
+	o, err := runTrial(tt)
+	if err != nil || string(o) != "pkg=./my pkg\n" {
+		t.Fatalf("got: %v: %q", err, o)
+	}
+	if want := fake + " test './my pkg' -v -run '^TestSync$/^fast$'"; tt.lastCmd != want {
+		t.Errorf("got command: %s, want: %s", tt.lastCmd, want)
+	}
+}
+
+func TestDirOption(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	root := t.TempDir()
+	// a go which prints where it runs from
+	fake := filepath.Join(root, "go")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\npwd\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { goExecutablePath = p }(goExecutablePath)
+	sibling := filepath.Join(root, "sibling")
+	if err := os.MkdirAll(filepath.Join(root, "repo"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(sibling, 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(root, "repo", "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("github.com/x/sibling TestSync dir=../sibling\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests, err := (&Config{TestsFiles: []string{f}, GoBinary: fake}).loadTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	o, err := runTrial(tests[0])
+	if err != nil {
+		t.Fatalf("got: %v: %s", err, o)
+	}
+	if got := strings.TrimSpace(string(o)); got != sibling {
+		t.Errorf("ran from: %s, want: %s", got, sibling)
+	}
+}
+
+func TestCollectTestsDefaults(t *testing.T) {
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	lines := []string{
+		"./eth TestSync",
+		"@defaults trials=5 dir=../go-ethereum tags=sync # shared",
+		"./eth TestFetch",
+		"./eth TestDrop trials=2 dir=/abs tags=slow",
+		"@defaults",
+		"./p2p TestDial",
+	}
+	if err := ioutil.WriteFile(f, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests, err := collectTestsFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(filepath.Dir(f), "../go-ethereum")
+	want := []struct {
+		name   string
+		trials int
+		dir    string
+		tags   []string
+	}{
+		{"TestSync", 0, "", nil},
+		{"TestFetch", 5, dir, []string{"sync"}},
+		{"TestDrop", 2, "/abs", []string{"slow"}}, // own options win
+		{"TestDial", 0, "", nil},
+	}
+	if len(tests) != len(want) {
+		t.Fatalf("got %d tests, want: %d", len(tests), len(want))
+	}
+	for i, w := range want {
+		tt := tests[i]
+		if tt.name != w.name || tt.trialsAllowed != w.trials || tt.dir != w.dir || !reflect.DeepEqual(tt.tags, w.tags) {
+			t.Errorf("%d: got: %s trials=%d dir=%s tags=%v, want: %+v", i, tt.name, tt.trialsAllowed, tt.dir, tt.tags, w)
+		}
+	}
+
+	if err := ioutil.WriteFile(f, []byte("@defaults trials=0\n./eth TestSync\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collectTestsFromFile(f); err == nil || !strings.Contains(err.Error(), ":1: bad trials") {
+		t.Errorf("got: %v, want: error for line 1", err)
+	}
+}
+
+func TestTagged(t *testing.T) {
+	tt, err := handleLine("./eth TestSync tags=db,slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db", "slow"}; !reflect.DeepEqual(tt.tags, want) {
+		t.Fatalf("got: %v, want: %v", tt.tags, want)
+	}
+	untagged := &test{pkg: "./eth", name: "TestFetch"}
+	cases := []struct {
+		t                *test
+		include, exclude []string
+		want             bool
+	}{
+		{tt, nil, nil, true},
+		{tt, []string{"db"}, nil, true},
+		{tt, []string{"integration", "db"}, nil, true}, // any include
+		{tt, []string{"integration"}, nil, false},
+		{tt, nil, []string{"slow"}, false},
+		{tt, []string{"db"}, []string{"slow"}, false}, // exclude wins
+		{untagged, nil, []string{"slow"}, true},
+		{untagged, []string{"db"}, nil, false},
+	}
+	for i, c := range cases {
+		if got := c.t.tagged(c.include, c.exclude); got != c.want {
+			t.Errorf("%d: got: %v, want: %v", i, got, c.want)
+		}
+	}
+
+	// with the white and blacklists
+	c := &Config{WhitelistMatch: "Sync", TagsInclude: []string{"db"}}
+	if err := c.compileMatchLists(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.selected(tt) || c.selected(untagged) {
+		t.Error("want only the whitelisted, tagged test selected")
+	}
+	c.WhitelistMatch = "Fetch"
+	if err := c.compileMatchLists(); err != nil {
+		t.Fatal(err)
+	}
+	if c.selected(tt) {
+		t.Error("want tagged test left out by the whitelist")
+	}
+}
+
+func TestShuffleTestsSeed(t *testing.T) {
+	mk := func() []*test {
+		var tests []*test
+		for _, n := range []string{"A", "B", "C", "D", "E", "F", "G", "H"} {
+			tests = append(tests, &test{pkg: "p", name: n})
+		}
+		return tests
+	}
+	a, b := mk(), mk()
+	if seed := shuffleTests(a, 42); seed != 42 {
+		t.Errorf("got seed: %v, want: 42", seed)
+	}
+	shuffleTests(b, 42)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("same seed, different order: %v, %v", a, b)
+	}
+	if seed := shuffleTests(mk(), 0); seed == 0 {
+		t.Error("want a random seed for 0")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := filepath.Join(dir, "tests.txt")
+	ioutil.WriteFile(f, []byte(`./eth TestSync
+./eth TestFetch trials=2 minpasses=3
+./eth TestSync
+./p2p TestDial dir=nowhere
+./p2p TestDial nope=1
+`), 0644)
+
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 0, RetryIfMatches: []string{"("}}
+	err = c.Validate()
+	if err == nil {
+		t.Fatal("want errors")
+	}
+	for _, want := range []string{
+		"TrialsAllowed: must be at least 1",
+		"RetryIfMatches[0]",
+		"tests.txt:2: minpasses=3 exceeds trials=2",
+		"tests.txt:3: duplicate test ./eth TestSync, first listed at " + f + ":1",
+		"tests.txt:4: dir:",
+		"tests.txt:5: unknown option: nope",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+
+	if err := (&Config{TestsFiles: []string{"./example.txt"}, TrialsAllowed: 1}).Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// duplicates across files
+	err = (&Config{TestsFiles: []string{"./example.txt", "./example.txt"}, TrialsAllowed: 1}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "duplicate test") {
+		t.Errorf("got: %v, want duplicate test error", err)
+	}
+
+	// a missing go binary is caught up front
+	missing := filepath.Join(dir, "go")
+	err = (&Config{TestsFiles: []string{"./example.txt"}, TrialsAllowed: 1, GoBinary: missing}).Validate()
+	if err == nil || !strings.Contains(err.Error(), "GoBinary: ") || !strings.Contains(err.Error(), "PATH") {
+		t.Errorf("got: %v, want missing go binary error", err)
+	}
+	if err := checkGoBinary(defaultGoPath); err != nil {
+		t.Errorf("default go binary: %v", err)
+	}
+}
+
+func TestGoPathEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "go1.99")
+	if err := ioutil.WriteFile(fake, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(goBinaryEnv, fake)
+	if got := getGoPath(); got != fake {
+		t.Errorf("by path: got: %s, want: %s", got, fake)
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv(goBinaryEnv, "go1.99")
+	if got := getGoPath(); got != fake {
+		t.Errorf("by name: got: %s, want: %s", got, fake)
+	}
+	t.Setenv(goBinaryEnv, "")
+	if got := getGoPath(); got == fake {
+		t.Errorf("unset: got: %s", got)
+	}
+}
+
 func TestIntegration(t *testing.T) {
 	//github.com/etcdevteam/go-schroedinger TestTest1
 	//github.com/etcdevteam/go-schroedinger/...
 	//github.com/etcdevteam/go-schroedinger
 
 	want := []*test{
-		{pkg: "github.com/ETCDEVTeam/go-schroedinger", name: "TestCat"},
-		{pkg: "github.com/ETCDEVTeam/go-schroedinger/..."},
-		{pkg: "github.com/ETCDEVTeam/go-schroedinger"},
+		{pkg: "github.com/ETCDEVTeam/go-schroedinger", name: "TestCat", file: "./example.txt", line: 3},
+		{pkg: "github.com/ETCDEVTeam/go-schroedinger/...", file: "./example.txt", line: 4},
+		{pkg: "github.com/ETCDEVTeam/go-schroedinger", file: "./example.txt", line: 5},
 	}
 
 	got, err := collectTestsFromFile("./example.txt")
@@ -100,8 +883,337 @@ func TestIntegration(t *testing.T) {
 	}
 
 	os.Setenv("thisIsOnlyATest", "WTF")
-	if e := run("./example.txt", "Cat", "", 20); e != nil {
+	var live []TestResult
+	report, e := run(&Config{
+		TestsFiles:     []string{"./example.txt"},
+		WhitelistMatch: "Cat",
+		TrialsAllowed:  20,
+		OnResult: func(r TestResult) {
+			live = append(live, r)
+		},
+	})
+	if e != nil {
 		t.Fatal(e)
 	}
+	if len(live) != 1 || live[0].Name != "TestCat" {
+		t.Errorf("got: %v, want: 1 live result for TestCat", live)
+	}
+	if len(report.Tests) != 1 || report.Tests[0].Outcome == OutcomeFail {
+		t.Errorf("got: %v, want: 1 passing test", report.Tests)
+	}
 	os.Setenv("thisIsOnlyATest", "")
 }
+
+func TestFailOnNoMatch(t *testing.T) {
+	c := &Config{
+		TestsFiles:     []string{"./example.txt"},
+		WhitelistMatch: "Dog",
+		TrialsAllowed:  1,
+		FailOnNoMatch:  true,
+	}
+	_, err := run(c)
+	if err == nil || !strings.Contains(err.Error(), `whitelist ["Dog"]`) ||
+		!strings.Contains(err.Error(), "github.com/ETCDEVTeam/go-schroedinger TestCat") {
+		t.Errorf("got: %v, want: an error naming the whitelist and the tests", err)
+	}
+
+	// opted out of
+	c.FailOnNoMatch = false
+	report, err := run(c)
+	if err != nil || len(report.Tests) != 0 {
+		t.Errorf("got: %v, %v, want: an empty run", report.Tests, err)
+	}
+}
+
+func TestRerunInheritsOptions(t *testing.T) {
+	pt := &test{pkg: filepath.FromSlash("./eth/..."), dir: "sub", serial: true, parallel: 2, trials: 1}
+	got := pt.rerun(failure{name: "TestSync"})
+	want := &test{pkg: filepath.FromSlash("./eth"), name: "TestSync", dir: "sub", serial: true, parallel: 2, trials: 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %+v, want: %+v", got, want)
+	}
+}
+
+func TestGrepPanic(t *testing.T) {
+	cases := []struct {
+		out, test, stack string
+	}{
+		{
+			out: `=== RUN   TestSync
+--- FAIL: TestSync (0.00s)
+panic: runtime error: index out of range [3] with length 3 [recovered]
+	panic: runtime error: index out of range [3] with length 3
+
+goroutine 7 [running]:
+testing.tRunner.func1.2({0x5a1f20, 0xc000018150})
+	/usr/local/go/src/testing/testing.go:1396 +0x24e
+FAIL	github.com/ethereumproject/go-ethereum/eth	0.012s
+`,
+			test: "TestSync",
+			stack: `panic: runtime error: index out of range [3] with length 3 [recovered]
+	panic: runtime error: index out of range [3] with length 3
+
+goroutine 7 [running]:
+testing.tRunner.func1.2({0x5a1f20, 0xc000018150})
+	/usr/local/go/src/testing/testing.go:1396 +0x24e`,
+		},
+		{
+			out: `=== RUN   TestDial
+fatal error: concurrent map writes
+
+goroutine 9 [running]:
+main.write()
+exit status 2
+FAIL	github.com/ethereumproject/go-ethereum/p2p	0.012s
+`,
+			test: "TestDial",
+			stack: `fatal error: concurrent map writes
+
+goroutine 9 [running]:
+main.write()`,
+		},
+		{
+			out: `--- FAIL: TestDial (0.00s)
+    dial_test.go:12: timeout
+FAIL
+FAIL	github.com/ethereumproject/go-ethereum/p2p	0.012s
+`,
+		},
+	}
+	for i, c := range cases {
+		test, stack := grepPanic([]byte(c.out))
+		if test != c.test || stack != c.stack {
+			t.Errorf("%d: got: %q %q, want: %q %q", i, test, stack, c.test, c.stack)
+		}
+	}
+}
+
+func TestMaxFailures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	lines := "a cmd=\"exit 1\"\nb cmd=\"sleep 0.2; exit 1\"\nslow cmd=\"sleep 0.5; sleep 10\"\n"
+	if err := ioutil.WriteFile(f, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 1, MaxFailures: 2}
+	start := time.Now()
+	report, err := run(c)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v, want slow killed", d)
+	}
+	var tf *ErrTestsFailed
+	if !errors.As(err, &tf) || !reflect.DeepEqual(tf.Tests, []string{"a", "b"}) {
+		t.Errorf("got: %v, want a and b failed", err)
+	}
+	if report.Stopped == "" || !reflect.DeepEqual(report.NotRun, []string{"slow"}) {
+		t.Errorf("got stopped: %q, not run: %v", report.Stopped, report.NotRun)
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	lines := "a cmd=\"exit 1\"\nb cmd=\"sleep 0.2; exit 1\"\nslow cmd=\"sleep 0.5\"\n"
+	if err := ioutil.WriteFile(f, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 1, MaxFailures: 1, KeepGoing: true}
+	report, err := run(c)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("got: %v, want the errors of a and b", err)
+	}
+	var failed []string
+	for _, e := range joined.Unwrap() {
+		var tf *ErrTestsFailed
+		if !errors.As(e, &tf) {
+			t.Fatalf("got: %v", e)
+		}
+		failed = append(failed, tf.Tests...)
+	}
+	sort.Strings(failed)
+	if !reflect.DeepEqual(failed, []string{"a", "b"}) {
+		t.Errorf("got: %v, want a and b failed", err)
+	}
+	if report.Stopped != "" || len(report.Tests) != 3 || exitCode(c, report, err) != ExitFailed {
+		t.Errorf("got stopped: %q, %d tests", report.Stopped, len(report.Tests))
+	}
+}
+
+func TestRunCancelKillsTrials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses /proc")
+	}
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	// the trial leaves a child behind, as go test leaves the test binary
+	tests := "a cmd=\"sleep 30 & echo $! > " + pidFile + ".tmp; mv " + pidFile + ".tmp " + pidFile + "; wait\"\nb cmd=true\n"
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte(tests), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if _, err := os.Stat(pidFile); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 3, MaxParallel: 1}
+	report, err := runContext(ctx, c)
+	if !errors.Is(err, context.Canceled) || exitCode(c, report, err) != ExitCancelled {
+		t.Fatalf("got: %v", err)
+	}
+	// b may have run first, tests run in random order
+	if report.Stopped != "cancelled" || len(report.NotRun) == 0 || report.NotRun[0] != "a" {
+		t.Errorf("got stopped: %q, not run: %v", report.Stopped, report.NotRun)
+	}
+	pid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// gone, or a zombie left for init to reap, once the kill lands
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		stat, err := ioutil.ReadFile("/proc/" + strings.TrimSpace(string(pid)) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("child still running: %s", stat)
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	f := filepath.Join(t.TempDir(), "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("a cmd=\"sleep 10\"\nb cmd=\"sleep 10\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 3, MaxParallel: 1, Timeout: 300 * time.Millisecond}
+	start := time.Now()
+	report, err := run(c)
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v, want cut short", d)
+	}
+	if !errors.Is(err, ErrDeadlineExceeded) || exitCode(c, report, err) != ExitCancelled {
+		t.Errorf("got: %v, want: %v", err, ErrDeadlineExceeded)
+	}
+	// one of them never started
+	if report.Stopped == "" || len(report.NotRun) == 0 {
+		t.Errorf("got stopped: %q, not run: %v", report.Stopped, report.NotRun)
+	}
+}
+
+// fakeGo writes a go into dir which prints out and exits with code, and
+// makes it the one tests run with until the test ends
+func fakeGo(t *testing.T, dir, out string, code int) {
+	fake := filepath.Join(dir, "go")
+	script := fmt.Sprintf("#!/bin/sh\ncat <<'EOF'\n%sEOF\nexit %d\n", out, code)
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p := goExecutablePath
+	t.Cleanup(func() { goExecutablePath = p })
+	goExecutablePath = fake
+}
+
+func TestMustFail(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	cases := []struct {
+		name        string
+		out         string
+		code        int
+		want        Outcome
+		trials      int
+		buildFailed bool
+	}{
+		{"passes", "=== RUN   TestBug\n--- PASS: TestBug (0.00s)\nPASS\nok  \t./eth\t0.01s\n", 0, OutcomeFail, 1, false},
+		{"fails", "=== RUN   TestBug\n--- FAIL: TestBug (0.00s)\nFAIL\nFAIL\t./eth\t0.01s\n", 1, OutcomePass, 3, false},
+		{"fails in a subtest", "--- FAIL: TestBug (0.00s)\n    --- FAIL: TestBug/fast (0.00s)\nFAIL\n", 1, OutcomePass, 3, false},
+		{"other test fails", "--- FAIL: TestOther (0.00s)\nFAIL\n", 1, OutcomeFail, 1, false},
+		{"does not build", "# ./eth\neth/sync.go:3:2: undefined: x\nFAIL\t./eth [build failed]\n", 1, OutcomeFail, 1, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			fakeGo(t, dir, c.out, c.code)
+			ch := make(chan *TestResult, 1)
+			tryMustFailTest(&test{pkg: "./eth", name: "TestBug", dir: dir, trialsAllowed: 3, mustFail: true}, ch)
+			r := <-ch
+			if r.Outcome != c.want || r.Trials != c.trials || r.BuildFailed != c.buildFailed {
+				t.Errorf("got: %s after %d trials, build failed: %v", r.Outcome, r.Trials, r.BuildFailed)
+			}
+		})
+	}
+
+	// no go at all is no failure of the test either
+	ch := make(chan *TestResult, 1)
+	p := goExecutablePath
+	defer func() { goExecutablePath = p }()
+	goExecutablePath = filepath.Join(t.TempDir(), "go")
+	tryMustFailTest(&test{pkg: "./eth", name: "TestBug", trialsAllowed: 3, mustFail: true}, ch)
+	if r := <-ch; r.Outcome != OutcomeFail || r.Trials != 1 {
+		t.Errorf("without go: got: %s after %d trials", r.Outcome, r.Trials)
+	}
+}
+
+func TestMinPasses(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	pass := "=== RUN   TestSync\n--- PASS: TestSync (0.00s)\nPASS\n"
+	fail := "=== RUN   TestSync\n--- FAIL: TestSync (0.00s)\nFAIL\n"
+	skip := "=== RUN   TestSync\n--- SKIP: TestSync (0.00s)\nPASS\n"
+	cases := []struct {
+		name   string
+		trials []string
+		want   Outcome
+		passes int
+	}{
+		{"all pass", []string{pass, pass, pass, pass}, OutcomePass, 4},
+		{"enough pass", []string{pass, fail, pass, pass}, OutcomeFlaky, 3},
+		{"below threshold", []string{pass, fail, fail, pass}, OutcomeFail, 2},
+		{"skips don't count", []string{pass, skip, skip, pass}, OutcomeFail, 2},
+		{"all skip", []string{skip, skip, skip, skip}, OutcomeSkip, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			// a go printing the output of the next trial, failing as it does
+			script := "#!/bin/sh\nn=$(cat " + filepath.Join(dir, "n") + " 2>/dev/null || echo 0)\necho $((n+1)) > " + filepath.Join(dir, "n") + "\n"
+			for i, o := range c.trials {
+				code := 0
+				if o == fail {
+					code = 1
+				}
+				script += fmt.Sprintf("if [ $n = %d ]; then printf '%%s' '%s'; exit %d; fi\n", i, o, code)
+			}
+			fake := filepath.Join(dir, "go")
+			if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			p := goExecutablePath
+			defer func() { goExecutablePath = p }()
+			goExecutablePath = fake
+
+			ch := make(chan *TestResult, 1)
+			tryThresholdTest(&test{pkg: "./eth", name: "TestSync", dir: dir, trialsAllowed: 4, minPasses: 3}, ch)
+			r := <-ch
+			if r.Outcome != c.want || r.Passes != c.passes || r.Trials != 4 {
+				t.Errorf("got: %s, %d passes of %d trials", r.Outcome, r.Passes, r.Trials)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// shardTests returns the tests falling in shard i of n, by a stable hash of
+// their package and name, so a shard always runs the same tests. The
+// failures discovered in a package are rerun by the shard running the package.
+func shardTests(tests []*test, i, n int) []*test {
+	var out []*test
+	for _, t := range tests {
+		if shardOf(t, n) == i {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// shardOf returns the shard of n which t falls in
+func shardOf(t *test, n int) int {
+	h := fnv.New32a()
+	// the same on every OS
+	h.Write([]byte(filepath.ToSlash(t.pkg) + " " + t.name))
+	return int(h.Sum32() % uint32(n))
+}
+
+// ReadReport reads a JSON report written with Report.WriteFile.
+func ReadReport(path string) (*Report, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if r.Schema != reportSchema {
+		return nil, fmt.Errorf("%s: report schema %d, want %d", path, r.Schema, reportSchema)
+	}
+	return r, nil
+}
+
+// MergeReports combines the reports of several shards into one.
+// The merged duration is that of the longest shard.
+func MergeReports(reports ...*Report) (*Report, error) {
+	if len(reports) == 0 {
+		return nil, errors.New("no reports to merge")
+	}
+	m := &Report{
+		Schema:        reportSchema,
+		Whitelist:     reports[0].Whitelist,
+		Blacklist:     reports[0].Blacklist,
+		TrialsAllowed: reports[0].TrialsAllowed,
+		Start:         reports[0].Start,
+		Tests:         []*TestResult{},
+	}
+	files := make(map[string]bool)
+	var errs []string
+	var shards []string
+	for _, r := range reports {
+		for _, f := range r.TestsFiles {
+			if !files[f] {
+				files[f] = true
+				m.TestsFiles = append(m.TestsFiles, f)
+			}
+		}
+		if r.Start.Before(m.Start) {
+			m.Start = r.Start
+		}
+		if r.Duration > m.Duration {
+			m.Duration = r.Duration
+		}
+		m.TrialsDuration += r.TrialsDuration
+		m.Tests = append(m.Tests, r.Tests...)
+		if r.Error != "" {
+			errs = append(errs, r.Error)
+		}
+		if r.Shard != "" {
+			shards = append(shards, r.Shard)
+		}
+	}
+	// the order of the tests files isn't known here
+	m.sortTests(nil)
+	m.Failures = m.GroupFailures()
+	m.Error = strings.Join(errs, "\n")
+	m.Shard = strings.Join(shards, ",")
+	return m, nil
+}
@@ -0,0 +1,77 @@
+package schroedinger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShardTests(t *testing.T) {
+	var tests []*test
+	for i := 0; i < 100; i++ {
+		tests = append(tests, &test{pkg: "./eth", name: fmt.Sprintf("Test%d", i)})
+	}
+	seen := make(map[*test]int)
+	for i := 0; i < 3; i++ {
+		shard := shardTests(tests, i, 3)
+		if len(shard) == 0 {
+			t.Errorf("shard %d empty", i)
+		}
+		for _, tt := range shard {
+			seen[tt]++
+		}
+		// stable
+		if again := shardTests(tests, i, 3); len(again) != len(shard) {
+			t.Errorf("shard %d: got %d then %d tests", i, len(shard), len(again))
+		}
+	}
+	for _, tt := range tests {
+		if seen[tt] != 1 {
+			t.Errorf("%v in %d shards, want 1", tt, seen[tt])
+		}
+	}
+}
+
+func TestMergeReports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	a := newReport([]string{"a.txt"}, nil, nil, 3)
+	a.Start, a.Duration, a.Shard = now, time.Minute, "0/2"
+	a.Tests = []*TestResult{{Package: "./eth", Outcome: OutcomePass}}
+	b := newReport([]string{"a.txt"}, nil, nil, 3)
+	b.Start, b.Duration, b.Shard = now.Add(-time.Second), 2*time.Minute, "1/2"
+	b.Tests = []*TestResult{{Package: "./p2p", Outcome: OutcomeFail}}
+	b.Error = "FAIL ./p2p"
+
+	pa, pb := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	if err := a.WriteFile(pa); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WriteFile(pb); err != nil {
+		t.Fatal(err)
+	}
+	ra, err := ReadReport(pa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb, err := ReadReport(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := MergeReports(ra, rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tests) != 2 || m.Duration != 2*time.Minute || !m.Start.Equal(b.Start) ||
+		len(m.TestsFiles) != 1 || m.Shard != "0/2,1/2" || m.Error != "FAIL ./p2p" {
+		t.Errorf("got: %+v", m)
+	}
+}
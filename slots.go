@@ -0,0 +1,71 @@
+package schroedinger
+
+import "context"
+
+// slots bounds the number of go test processes running at once, by
+// Config.MaxParallel or the adaptive limit instead: those of the tests
+// started, and those of the reruns of a package's failing tests, which it
+// gives up its own slot to. A nil *slots never waits.
+type slots struct {
+	fixed    chan struct{}
+	adaptive *adaptivePool
+}
+
+func newSlots(max int) *slots {
+	if max <= 0 {
+		return nil
+	}
+	return &slots{fixed: make(chan struct{}, max)}
+}
+
+func newAdaptiveSlots(p *adaptivePool) *slots {
+	if p == nil {
+		return nil
+	}
+	return &slots{adaptive: p}
+}
+
+// acquire blocks until a slot is free, or ctx is done
+func (s *slots) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	if s.adaptive != nil {
+		return s.adaptive.acquire(ctx)
+	}
+	select {
+	case s.fixed <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slots) release() {
+	if s == nil {
+		return
+	}
+	if s.adaptive != nil {
+		s.adaptive.release()
+		return
+	}
+	<-s.fixed
+}
+
+// acquireSlot takes a slot for t to run in, which it holds until
+// releaseSlot
+func (t *test) acquireSlot() error {
+	if err := t.slots.acquire(t.context()); err != nil {
+		return err
+	}
+	t.slotHeld = true
+	return nil
+}
+
+// releaseSlot gives up t's slot, if it still holds it
+func (t *test) releaseSlot() {
+	if t.slotHeld {
+		t.slotHeld = false
+		t.slots.release()
+	}
+}
@@ -0,0 +1,73 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// overlapGo writes a go whose package runs fail in three tests, and whose
+// reruns pass, noting in dir/overlaps whenever one started while another
+// was going
+func overlapGo(t *testing.T, dir string) string {
+	fake := filepath.Join(dir, "go")
+	script := `#!/bin/sh
+case "$*" in
+*-run*)
+	mkdir ` + filepath.Join(dir, "lock") + ` 2>/dev/null || echo "$*" >> ` + filepath.Join(dir, "overlaps") + `
+	sleep 0.2
+	rmdir ` + filepath.Join(dir, "lock") + ` 2>/dev/null
+	echo "--- PASS: $6 (0.00s)"
+	;;
+*)
+	printf -- '--- FAIL: TestA (0.00s)\n--- FAIL: TestB (0.00s)\n--- FAIL: TestC (0.00s)\nFAIL\n'
+	exit 1
+	;;
+esac
+`
+	if err := ioutil.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// which loadTests sets
+	p := goExecutablePath
+	t.Cleanup(func() { goExecutablePath = p })
+	return fake
+}
+
+func TestRerunsTakeSlots(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	cases := []struct {
+		name     string
+		parallel int
+		adaptive float64
+	}{
+		{"max parallel", 1, 0},
+		// which starts at half of max parallel
+		{"adaptive parallel", 2, 0.5},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f := filepath.Join(dir, "tests.txt")
+			if err := ioutil.WriteFile(f, []byte("./eth\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := &Config{TestsFiles: []string{f}, GoBinary: overlapGo(t, dir), WorkDir: dir, TrialsAllowed: 3,
+				MaxParallel: c.parallel, AdaptiveParallel: c.adaptive}
+			report, err := run(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Tests) != 1 || len(report.Tests[0].Reruns) != 3 || report.Tests[0].Outcome != OutcomeFlaky {
+				t.Fatalf("got: %+v", report.Tests)
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(dir, "overlaps")); !os.IsNotExist(err) {
+				t.Errorf("reruns overlapped with one slot: %s", b)
+			}
+		})
+	}
+}
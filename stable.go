@@ -0,0 +1,160 @@
+package schroedinger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stableSet remembers the tests which passed on their first trial, along
+// with a hash of their packages' files, so that later runs can skip them
+// until those change; see Config.SkipStable.
+type stableSet struct {
+	// keyed by package and name
+	Tests map[string]stableTest `json:"tests"`
+
+	// the hash of the packages of each directory and package in this run,
+	// once looked up; "" if they couldn't be hashed
+	hashes map[string]string
+}
+
+type stableTest struct {
+	Hash   string    `json:"hash"`
+	Passed time.Time `json:"passed"`
+}
+
+// readStable reads the stable file at path. A missing file is an empty set.
+func readStable(path string) (*stableSet, error) {
+	s := &stableSet{Tests: make(map[string]stableTest), hashes: make(map[string]string)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Tests == nil {
+		s.Tests = make(map[string]stableTest)
+	}
+	return s, nil
+}
+
+// stable reports whether t passed on its first trial in an earlier run,
+// and its packages haven't changed since
+func (s *stableSet) stable(t *test) bool {
+	// hashed either way, for update
+	h := s.hash(t)
+	st, ok := s.Tests[t.pkg+" "+t.name]
+	return ok && h != "" && h == st.Hash
+}
+
+// hash returns the hash of the files of t's packages, "" for cmd= tests
+// and packages which can't be found
+func (s *stableSet) hash(t *test) string {
+	if t.command != "" {
+		return ""
+	}
+	dir, pkg := t.goArgs()
+	key := dir + "\x00" + pkg
+	if h, ok := s.hashes[key]; ok {
+		return h
+	}
+	h, _ := packageHash(t)
+	s.hashes[key] = h
+	return h
+}
+
+// packageHash hashes the names and contents of the files in the
+// directories of t's packages, and in their testdata directories
+func packageHash(t *test) (string, error) {
+	dir, pkg := t.goArgs()
+	cmd := exec.Command(goExecutablePath, "list", "-f", "{{.Dir}}", pkg)
+	cmd.Dir = dir
+	cmd.Env = t.environ()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	var files []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		pdir := strings.TrimSpace(scanner.Text())
+		if pdir == "" {
+			continue
+		}
+		entries, err := ioutil.ReadDir(pdir)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range entries {
+			if e.Mode().IsRegular() {
+				files = append(files, filepath.Join(pdir, e.Name()))
+			}
+		}
+		testdata := filepath.Join(pdir, "testdata")
+		filepath.Walk(testdata, func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	for _, f := range files {
+		io.WriteString(h, f+"\x00")
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+		io.WriteString(h, "\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// update records the tests which passed on their first trial, with the
+// hash of their packages from when the run started, and forgets those
+// which were flaky or failed. Tests not run keep their entries.
+func (s *stableSet) update(tests []*test, results []*TestResult, now time.Time) {
+	byKey := make(map[string]*test)
+	for _, t := range tests {
+		byKey[t.pkg+" "+t.name] = t
+	}
+	for _, r := range results {
+		key := r.Package + " " + r.Name
+		switch r.Outcome {
+		case OutcomePass:
+			t := byKey[key]
+			if t == nil || r.Trials != 1 || r.MustFail {
+				continue
+			}
+			if h := s.hash(t); h != "" {
+				s.Tests[key] = stableTest{Hash: h, Passed: now}
+			}
+		case OutcomeFlaky, OutcomeFail:
+			delete(s.Tests, key)
+		}
+	}
+}
+
+func (s *stableSet) write(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,71 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStableSet(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkg := filepath.Join(dir, "eth")
+	if err := os.Mkdir(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(pkg, "eth_test.go")
+	if err := ioutil.WriteFile(src, []byte("package eth\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "stable.json")
+	s, err := readStable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sync := &test{pkg: "./eth", name: "TestSync", dir: dir}
+	fetch := &test{pkg: "./eth", name: "TestFetch", dir: dir}
+	cmd := &test{pkg: "./eth", name: "TestCmd", dir: dir, command: "true"}
+	tests := []*test{sync, fetch, cmd}
+	for _, tt := range tests {
+		if s.stable(tt) {
+			t.Fatalf("%s: stable in an empty set", tt)
+		}
+	}
+	if s.hash(sync) == "" {
+		t.Fatal("no hash")
+	}
+	s.update(tests, []*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomePass, Trials: 1},
+		{Package: "./eth", Name: "TestFetch", Outcome: OutcomePass, Trials: 2},
+		{Package: "./eth", Name: "TestCmd", Outcome: OutcomePass, Trials: 1},
+	}, time.Now())
+	if err := s.write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err = readStable(path); err != nil {
+		t.Fatal(err)
+	}
+	if !s.stable(sync) || s.stable(fetch) || s.stable(cmd) {
+		t.Errorf("got: %v", s.Tests)
+	}
+	// a flaky run forgets the test
+	s.update(tests, []*TestResult{{Package: "./eth", Name: "TestSync", Outcome: OutcomeFlaky, Trials: 2}}, time.Now())
+	if s.stable(sync) {
+		t.Error("flaky test still stable")
+	}
+
+	// changing the package's files invalidates the set
+	s.update(tests, []*TestResult{{Package: "./eth", Name: "TestSync", Outcome: OutcomePass, Trials: 1}}, time.Now())
+	if err := ioutil.WriteFile(src, []byte("package eth\n\n// changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.hashes = make(map[string]string)
+	if s.stable(sync) {
+		t.Error("stable after its package changed")
+	}
+}
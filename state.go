@@ -0,0 +1,65 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// state remembers which tests passed in previous runs, so that a
+// resumed run can skip them.
+type state struct {
+	// keyed by package and name
+	Passed map[string]time.Time `json:"passed"`
+}
+
+// readState reads the state file at path. A missing file is an empty state.
+func readState(path string) (*state, error) {
+	s := &state{Passed: make(map[string]time.Time)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	if s.Passed == nil {
+		s.Passed = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// fresh reports whether t passed within ttl of now. A zero ttl never expires.
+func (s *state) fresh(t *test, ttl time.Duration, now time.Time) bool {
+	at, ok := s.Passed[t.pkg+" "+t.name]
+	if !ok {
+		return false
+	}
+	return ttl == 0 || now.Sub(at) <= ttl
+}
+
+// update records the passes and forgets the failures of the given results.
+// Resumed results keep their original timestamp.
+func (s *state) update(results []*TestResult, now time.Time) {
+	for _, r := range results {
+		key := r.Package + " " + r.Name
+		switch r.Outcome {
+		case OutcomePass, OutcomeFlaky:
+			s.Passed[key] = now
+		case OutcomeFail:
+			delete(s.Passed, key)
+		}
+	}
+}
+
+func (s *state) write(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
@@ -0,0 +1,50 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schroedinger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "state.json")
+
+	s, err := readState(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.update([]*TestResult{
+		{Package: "./eth", Name: "TestSync", Outcome: OutcomeFlaky},
+		{Package: "./eth", Name: "TestFetch", Outcome: OutcomeFail},
+	}, now)
+	if err := s.write(p); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = readState(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passed := &test{pkg: "./eth", name: "TestSync"}
+	failed := &test{pkg: "./eth", name: "TestFetch"}
+	if !s.fresh(passed, time.Hour, now.Add(time.Minute)) {
+		t.Error("want passed test fresh within ttl")
+	}
+	if s.fresh(passed, time.Hour, now.Add(2*time.Hour)) {
+		t.Error("want passed test stale after ttl")
+	}
+	if !s.fresh(passed, 0, now.Add(1000*time.Hour)) {
+		t.Error("want zero ttl to never expire")
+	}
+	if s.fresh(failed, 0, now) {
+		t.Error("want failed test not fresh")
+	}
+}
@@ -0,0 +1,150 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// how often the status file is rewritten
+var statusInterval = 5 * time.Second
+
+// Status is a snapshot of a run in progress, as written to
+// Config.StatusFile. Durations are in nanoseconds.
+type Status struct {
+	Start   time.Time `json:"start"`
+	Updated time.Time `json:"updated"`
+	// the run is over, and the file won't change again
+	Complete bool            `json:"complete"`
+	Queued   int             `json:"queued"`
+	Running  int             `json:"running"`
+	Done     int             `json:"done"`
+	Counts   map[Outcome]int `json:"counts"`
+	Tests    []RunningTest   `json:"tests"`
+}
+
+// RunningTest is a test of a Status which has started but not finished.
+type RunningTest struct {
+	Test    string        `json:"test"`
+	Elapsed time.Duration `json:"elapsed"`
+	// the trial running, or last run: of the test, or of the rerun of one of
+	// the failing tests of a package, named by Rerun
+	Trial int    `json:"trial"`
+	Rerun string `json:"rerun,omitempty"`
+}
+
+// trialStarted notes the trial t is about to start, of the test running
+// as t.progressKey
+func (p *progress) trialStarted(t *test) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.running[t.progressKey]; !ok {
+		return
+	}
+	cur := currentTrial{trial: t.trials + 1}
+	if key := t.pkg + " " + t.name; key != t.progressKey {
+		cur.rerun = strings.TrimSpace(key)
+	}
+	p.trials[t.progressKey] = cur
+}
+
+// snapshot returns the status of the run started at start
+func (p *progress) snapshot(start, now time.Time) *Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := &Status{
+		Start:   start,
+		Updated: now,
+		Queued:  p.queued,
+		Running: len(p.running),
+		Done:    p.done,
+		Counts:  make(map[Outcome]int),
+		Tests:   []RunningTest{},
+	}
+	for o, n := range p.counts {
+		s.Counts[o] = n
+	}
+	for key, since := range p.running {
+		cur := p.trials[key]
+		s.Tests = append(s.Tests, RunningTest{
+			Test:    strings.TrimSpace(key),
+			Elapsed: now.Sub(since),
+			Trial:   cur.trial,
+			Rerun:   cur.rerun,
+		})
+	}
+	sort.Slice(s.Tests, func(i, j int) bool {
+		if s.Tests[i].Elapsed != s.Tests[j].Elapsed {
+			return s.Tests[i].Elapsed > s.Tests[j].Elapsed
+		}
+		return s.Tests[i].Test < s.Tests[j].Test
+	})
+	return s
+}
+
+// writeStatus writes s to path atomically, by renaming a temporary file
+// over it, so that readers never see a partial file
+func writeStatus(path string, s *Status) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// writeStatuses rewrites the status file at path every statusInterval
+// until the returned func is called, which writes it a last time, marked
+// complete
+func (p *progress) writeStatuses(path string, start time.Time) func() {
+	write := func(complete bool) {
+		s := p.snapshot(start, time.Now())
+		s.Complete = complete
+		if err := writeStatus(path, s); err != nil {
+			p.log.Printf("could not write status file: %v", err)
+		}
+	}
+	write(false)
+	ticker := time.NewTicker(statusInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				write(false)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		write(true)
+	}
+}
@@ -0,0 +1,66 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProgressSnapshot(t *testing.T) {
+	now := time.Now()
+	p := newProgress(4, nil)
+	sync := &test{pkg: "./eth", name: "TestSync", progressKey: "./eth TestSync"}
+	pkg := &test{pkg: "./p2p/...", progressKey: "./p2p/... ", progress: p}
+	p.started(sync, now.Add(-time.Minute))
+	p.started(pkg, now.Add(-2*time.Minute))
+	sync.trials = 1
+	p.trialStarted(sync)
+	p.trialStarted(pkg.rerun(failure{pkg: "./p2p/discover", name: "TestPing"}))
+	p.started(&test{pkg: "./les"}, now)
+	p.finished(&TestResult{Package: "./les", Outcome: OutcomeFlaky})
+
+	s := p.snapshot(now.Add(-time.Hour), now)
+	want := []RunningTest{
+		{Test: "./p2p/...", Elapsed: 2 * time.Minute, Trial: 2, Rerun: "./p2p/discover TestPing"},
+		{Test: "./eth TestSync", Elapsed: time.Minute, Trial: 2},
+	}
+	if s.Queued != 1 || s.Running != 2 || s.Done != 1 || s.Counts[OutcomeFlaky] != 1 {
+		t.Errorf("got: %+v", s)
+	}
+	if !reflect.DeepEqual(s.Tests, want) {
+		t.Errorf("got: %+v\nwant: %+v", s.Tests, want)
+	}
+}
+
+func TestWriteStatuses(t *testing.T) {
+	defer func(d time.Duration) { statusInterval = d }(statusInterval)
+	statusInterval = time.Millisecond
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status.json")
+	p := newProgress(1, nil)
+	stop := p.writeStatuses(path, time.Now())
+	time.Sleep(10 * time.Millisecond)
+	p.started(&test{pkg: "./eth"}, time.Now())
+	p.finished(&TestResult{Package: "./eth", Outcome: OutcomePass})
+	stop()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Status
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Complete || s.Done != 1 || s.Counts[OutcomePass] != 1 {
+		t.Errorf("got: %+v", s)
+	}
+	// no temporary files are left behind
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("got %d files", len(files))
+	}
+}
@@ -0,0 +1,251 @@
+package schroedinger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StressResult is the outcome of Stress: how often a test passed and
+// failed, and its failures grouped by signature.
+type StressResult struct {
+	Test   string
+	Runs   int
+	Passes int
+	Skips  int
+	Fails  int
+	// whether the runs stopped early, at Config.StressMaxFailures
+	Stopped bool
+	// whether the runs were cut short by an interrupt
+	Interrupted bool
+	// distinct failures, most frequent first
+	Signatures []StressSignature
+	// for a package, the tests failing in its runs, most frequent first
+	Cases    []StressCase
+	Duration time.Duration
+}
+
+// StressCase is a test which failed in runs of its package, and how often.
+type StressCase struct {
+	Name  string
+	Fails int
+}
+
+// StressSignature is a distinct way a test failed, as told by the first
+// error or panic line of its output, and how often it did.
+type StressSignature struct {
+	Signature string
+	Count     int
+	// the output of the first run which failed this way
+	Output string `json:"-"`
+}
+
+// findStressTest returns the test of the tests files named name, given as
+// 'TestName' or 'package TestName'
+func findStressTest(tests []*test, name string) (*test, error) {
+	var found []*test
+	for _, t := range tests {
+		if t.name != "" && (t.name == name || t.pkg+" "+t.name == name) {
+			found = append(found, t)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("no test %s in the tests files", name)
+	case 1:
+		return found[0], nil
+	}
+	var names []string
+	for _, t := range found {
+		names = append(names, t.pkg+" "+t.name)
+	}
+	return nil, fmt.Errorf("%s is ambiguous, give its package: %s", name, strings.Join(names, ", "))
+}
+
+// Stress runs the test name of the tests files n times, rather than until
+// it passes, to see how flaky it is, and writes the distribution of its
+// outcomes to w: the count of passes and failures, and a histogram of its
+// failures by signature. The name is a test's name, or 'package name' to
+// tell apart tests of the same name.
+//
+// Up to Config.MaxParallel runs go at once, one at a time if unset, and the
+// runs stop early once Config.StressMaxFailures have failed, if set. The go
+// test cache is always disabled. An interrupt kills the runs going, and the
+// outcome of those done is written and returned, along with
+// context.Canceled.
+func Stress(c *Config, name string, n int, w io.Writer) (*StressResult, error) {
+	ctx, stop := interruptContext()
+	defer stop()
+	return stressContext(ctx, c, name, n, w)
+}
+
+// stressContext is Stress, stopping the runs once ctx is done
+func stressContext(ctx context.Context, c *Config, name string, n int, w io.Writer) (*StressResult, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if n < 1 {
+		return nil, errors.New("stress: runs must be at least 1")
+	}
+	tests, err := c.loadTests()
+	if err != nil {
+		return nil, err
+	}
+	t, err := findStressTest(tests, name)
+	if err != nil {
+		return nil, err
+	}
+	bins, err := c.precompile([]*test{t})
+	if err != nil {
+		return nil, err
+	}
+	defer bins.remove()
+	res := c.stress(ctx, t, n)
+	res.write(w)
+	if res.Interrupted {
+		return res, fmt.Errorf("stress: %w", ctx.Err())
+	}
+	return res, nil
+}
+
+// stress runs t n times, up to Config.MaxParallel at once, until parent is
+// done
+func (c *Config) stress(parent context.Context, t *test, n int) *StressResult {
+	t.disableCache = true
+	t.trialsAllowed = n
+
+	parallel := c.MaxParallel
+	if parallel < 1 {
+		parallel = 1
+	}
+	c.logf("* stressing %s: %d runs, %d at once", t, n, parallel)
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	res := &StressResult{Test: strings.TrimSpace(t.String())}
+	bySig := make(map[string]*StressSignature)
+	byCase := make(map[string]int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	runs := make(chan int)
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				// each run gets its own copy, as runTest counts trials
+				tt := *t
+				tt.ctx = ctx
+				tt.trials = 0
+				o, e := runTest(&tt)
+				if errors.Is(e, context.Canceled) {
+					continue
+				}
+				var cases []failure
+				if e != nil && t.name == "" && t.command == "" {
+					cases, _ = tt.parseFailures(o)
+				}
+				mu.Lock()
+				res.Runs++
+				switch {
+				case e == nil && tt.skipped(o):
+					res.Skips++
+					logTrialf(t, "- SKIP run %d", run)
+				case e == nil:
+					res.Passes++
+					logTrialf(t, "- PASS run %d", run)
+				default:
+					res.Fails++
+					sig := failureSignature(o, e)
+					logTrialf(t, "- FAIL run %d: %s", run, sig)
+					s := bySig[sig]
+					if s == nil {
+						s = &StressSignature{Signature: sig, Output: string(o)}
+						bySig[sig] = s
+					}
+					s.Count++
+					for _, f := range cases {
+						byCase[f.name]++
+					}
+					if c.StressMaxFailures > 0 && res.Fails >= c.StressMaxFailures && !res.Stopped {
+						res.Stopped = true
+						cancel()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := 1; i <= n; i++ {
+		select {
+		case runs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(runs)
+	wg.Wait()
+	res.Duration = time.Since(start)
+	res.Interrupted = parent.Err() != nil
+
+	for _, s := range bySig {
+		res.Signatures = append(res.Signatures, *s)
+	}
+	sort.SliceStable(res.Signatures, func(i, j int) bool {
+		a, b := res.Signatures[i], res.Signatures[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Signature < b.Signature
+	})
+	for name, k := range byCase {
+		res.Cases = append(res.Cases, StressCase{Name: name, Fails: k})
+	}
+	sort.Slice(res.Cases, func(i, j int) bool {
+		a, b := res.Cases[i], res.Cases[j]
+		if a.Fails != b.Fails {
+			return a.Fails > b.Fails
+		}
+		return a.Name < b.Name
+	})
+	return res
+}
+
+// write writes the outcome of the runs and a histogram of the failures
+func (r *StressResult) write(w io.Writer) {
+	fmt.Fprintf(w, "STRESS %s: %d runs in %v\n", r.Test, r.Runs, r.Duration.Round(time.Millisecond))
+	if r.Stopped {
+		fmt.Fprintf(w, "stopped early after %d failures\n", r.Fails)
+	}
+	if r.Interrupted {
+		fmt.Fprintf(w, "interrupted after %d runs\n", r.Runs)
+	}
+	pct := func(k int) float64 {
+		if r.Runs == 0 {
+			return 0
+		}
+		return 100 * float64(k) / float64(r.Runs)
+	}
+	fmt.Fprintf(w, "pass: %d (%.1f%%), fail: %d (%.1f%%), skip: %d\n", r.Passes, pct(r.Passes), r.Fails, pct(r.Fails), r.Skips)
+	if len(r.Signatures) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "FAILURES")
+	// bars are scaled to the most frequent failure
+	const width = 40
+	most := r.Signatures[0].Count
+	for _, s := range r.Signatures {
+		bar := s.Count * width / most
+		if bar == 0 {
+			bar = 1
+		}
+		fmt.Fprintf(w, "%5d %-*s %s\n", s.Count, width, strings.Repeat("#", bar), s.Signature)
+	}
+}
@@ -0,0 +1,125 @@
+package schroedinger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	// passes, then fails each of two ways in turn
+	script := `n=$(cat count 2>/dev/null || echo 0); n=$((n+1)); echo $n > count
+case $((n % 3)) in
+1) echo ok;;
+2) echo "    sync_test.go:42: got $n peers"; exit 1;;
+0) echo "panic: boom"; exit 2;;
+esac`
+	if err := ioutil.WriteFile(filepath.Join(dir, "stress.sh"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync dir=. cmd=./stress.sh\n./eth TestFetch cmd=true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{f}, TrialsAllowed: 1}
+
+	var out bytes.Buffer
+	res, err := Stress(c, "TestSync", 7, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Runs != 7 || res.Passes != 3 || res.Fails != 4 || res.Stopped {
+		t.Errorf("got: %+v", res)
+	}
+	if len(res.Signatures) != 2 || res.Signatures[1].Signature != "sync_test.go:42: got N peers" || res.Signatures[0].Count != 2 || res.Signatures[1].Count != 2 {
+		t.Errorf("signatures: %+v", res.Signatures)
+	}
+	if !strings.Contains(out.String(), "pass: 3 (42.9%), fail: 4 (57.1%)") {
+		t.Errorf("output:\n%s", out.String())
+	}
+
+	c.StressMaxFailures = 2
+	if res, err = Stress(c, "./eth TestSync", 100, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Stopped || res.Fails != 2 || res.Runs > 6 {
+		t.Errorf("got: %+v", res)
+	}
+
+	if _, err := Stress(c, "TestDial", 1, &out); err == nil {
+		t.Error("no error for a missing test")
+	}
+}
+
+// leaveChild returns a cmd= test running a trial which leaves a child
+// behind, as go test leaves the test binary, writing its pid to pidFile
+func leaveChild(pidFile string) string {
+	return "cmd=\"sleep 30 & echo $! > " + pidFile + ".tmp; mv " + pidFile + ".tmp " + pidFile + "; wait\""
+}
+
+// cancelOnFile cancels once path exists
+func cancelOnFile(cancel context.CancelFunc, path string) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			cancel()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitKilled waits for the process of pidFile to be gone, or a zombie left
+// for init to reap, once the kill lands
+func waitKilled(t *testing.T, pidFile string) {
+	pid, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		stat, err := ioutil.ReadFile("/proc/" + strings.TrimSpace(string(pid)) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			return
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("child still running: %s", stat)
+		}
+	}
+}
+
+func TestStressCancelKillsRuns(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses /proc")
+	}
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	f := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(f, []byte("./eth TestSync "+leaveChild(pidFile)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancelOnFile(cancel, pidFile)
+	var out bytes.Buffer
+	start := time.Now()
+	res, err := stressContext(ctx, &Config{TestsFiles: []string{f}, TrialsAllowed: 1}, "TestSync", 5, &out)
+	if !errors.Is(err, context.Canceled) || res == nil || !res.Interrupted {
+		t.Fatalf("got: %+v, %v", res, err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("took %v", d)
+	}
+	if !strings.Contains(out.String(), "interrupted after 0 runs") {
+		t.Errorf("output:\n%s", out.String())
+	}
+	waitKilled(t, pidFile)
+}
@@ -0,0 +1,221 @@
+package schroedinger
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// table fields naming the subtest of each case, by convention
+var subtestNameFields = map[string]bool{"name": true, "Name": true, "desc": true, "description": true}
+
+// splitFileLine splits 'path/to/foo_test.go:42' into the path and line, 0
+// if there is none
+func splitFileLine(spec string) (string, int, error) {
+	i := strings.LastIndex(spec, ":")
+	if i < 0 {
+		return spec, 0, nil
+	}
+	n, err := strconv.Atoi(spec[i+1:])
+	if err != nil {
+		// eg. a drive letter
+		return spec, 0, nil
+	}
+	if n < 1 {
+		return "", 0, fmt.Errorf("%s: bad line", spec)
+	}
+	return spec[:i], n, nil
+}
+
+// resolveTestFile returns the package of the test file given as
+// 'path/to/foo_test.go[:line]', relative to dir where possible, eg. './eth',
+// and the tests to run: those of the file, or the one around the line.
+// Around the line of a t.Run with a literal name, or of a case of a table
+// of subtests with a literal name field, the test is the subtest.
+func resolveTestFile(spec, dir string) (pkg string, names []string, err error) {
+	path, line, err := splitFileLine(spec)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.HasSuffix(path, "_test.go") {
+		return "", nil, fmt.Errorf("%s: not a test file", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", nil, err
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return "", nil, err
+	}
+
+	abs, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", nil, err
+	}
+	pkg = relativePackage(abs, dir)
+
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || !isTestFunc(fn) {
+			continue
+		}
+		if line == 0 {
+			names = append(names, fn.Name.Name)
+			continue
+		}
+		if fset.Position(fn.Pos()).Line <= line && line <= fset.Position(fn.End()).Line {
+			return pkg, []string{fn.Name.Name + subtestAt(fset, fn, line)}, nil
+		}
+	}
+	if line != 0 {
+		return "", nil, fmt.Errorf("%s:%d: not in a test function", path, line)
+	}
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("%s: no test functions", path)
+	}
+	return pkg, names, nil
+}
+
+// relativePackage returns the package in directory abs relative to dir,
+// eg. './eth', or abs if it's outside of dir
+func relativePackage(abs, dir string) string {
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return abs
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return abs
+	}
+	if rel == "." {
+		return "."
+	}
+	return "./" + filepath.ToSlash(rel)
+}
+
+// isTestFunc reports whether fn is a func TestXxx(*testing.T)
+func isTestFunc(fn *ast.FuncDecl) bool {
+	name := fn.Name.Name
+	if fn.Recv != nil || !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(name[len("Test"):]); unicode.IsLower(r) {
+		return false
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "T"
+}
+
+// subtestAt returns the path of the subtest of fn around line, eg.
+// '/fast/small', or "" if it isn't in one
+func subtestAt(fset *token.FileSet, fn *ast.FuncDecl, line int) string {
+	covers := func(n ast.Node) bool {
+		return fset.Position(n.Pos()).Line <= line && line <= fset.Position(n.End()).Line
+	}
+	var path string
+	var hasRun bool
+	var tableCase string
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Run" || len(n.Args) != 2 {
+				return true
+			}
+			hasRun = true
+			// outer t.Runs are visited first
+			if name, ok := stringLit(n.Args[0]); ok && covers(n) {
+				path += "/" + subtestName(name)
+			}
+		case *ast.CompositeLit:
+			if !covers(n) {
+				return true
+			}
+			for _, e := range n.Elts {
+				kv, ok := e.(*ast.KeyValueExpr)
+				if !ok {
+					continue
+				}
+				key, ok := kv.Key.(*ast.Ident)
+				if !ok || !subtestNameFields[key.Name] {
+					continue
+				}
+				if name, ok := stringLit(kv.Value); ok {
+					tableCase = name
+				}
+			}
+		}
+		return true
+	})
+	if path == "" && hasRun && tableCase != "" {
+		return "/" + subtestName(tableCase)
+	}
+	return path
+}
+
+func stringLit(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// subtestName rewrites a t.Run name as go test reports it
+func subtestName(name string) string {
+	return strings.Replace(name, " ", "_", -1)
+}
+
+// collectFileTests returns the tests of Config.Files. A test listed in the
+// tests files is taken from there, with its options; any other is run as
+// a plain 'package name' line would be.
+func (c *Config) collectFileTests(listed []*test) ([]*test, error) {
+	dir := c.WorkDir
+	if dir == "" {
+		dir = "."
+	}
+	var tests []*test
+	var errs []error
+	added := make(map[string]bool)
+	for _, spec := range c.Files {
+		pkg, names, err := resolveTestFile(spec, dir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		path, line, _ := splitFileLine(spec)
+	names:
+		for _, name := range names {
+			if added[pkg+" "+name] {
+				continue
+			}
+			added[pkg+" "+name] = true
+			for _, t := range listed {
+				if t.name == name && filepath.Clean(t.pkg) == filepath.Clean(pkg) {
+					tests = append(tests, t)
+					continue names
+				}
+			}
+			tests = append(tests, &test{pkg: pkg, name: name, file: path, line: line})
+		}
+	}
+	return tests, errors.Join(errs...)
+}
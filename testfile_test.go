@@ -0,0 +1,90 @@
+package schroedinger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const sampleTestFile = `package eth
+
+import "testing"
+
+func TestSync(t *testing.T) {
+	cases := []struct {
+		name string
+		n    int
+	}{
+		{name: "one peer", n: 1},
+		{name: "many", n: 9},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	t.Run("fast", func(t *testing.T) {
+		t.Run("small", func(t *testing.T) {
+		})
+	})
+}
+
+func Testable(t *testing.T) {}
+
+func helper(t *testing.T) {}
+`
+
+func TestResolveTestFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "eth"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f := filepath.Join(dir, "eth", "sync_test.go")
+	if err := ioutil.WriteFile(f, []byte(sampleTestFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		spec  string
+		names []string
+	}{
+		{f, []string{"TestSync", "TestFetch"}},
+		{f + ":5", []string{"TestSync"}},
+		{f + ":10", []string{"TestSync/one_peer"}},
+		{f + ":11", []string{"TestSync/many"}},
+		{f + ":18", []string{"TestFetch"}},
+		{f + ":19", []string{"TestFetch/fast"}},
+		{f + ":20", []string{"TestFetch/fast/small"}},
+	}
+	for _, c := range cases {
+		pkg, names, err := resolveTestFile(c.spec, dir)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if pkg != "./eth" || !reflect.DeepEqual(names, c.names) {
+			t.Errorf("%s: got: %s %v, want: ./eth %v", c.spec, pkg, names, c.names)
+		}
+	}
+	for _, spec := range []string{f + ":3", f + ":27", filepath.Join(dir, "eth", "sync.go"), f + ":0"} {
+		if _, _, err := resolveTestFile(spec, dir); err == nil {
+			t.Errorf("%s: no error", spec)
+		}
+	}
+
+	// a listed test keeps its options
+	tf := filepath.Join(dir, "tests.txt")
+	if err := ioutil.WriteFile(tf, []byte("./eth TestFetch trials=7\n./p2p TestDial\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{TestsFiles: []string{tf}, Files: []string{f, f + ":5"}, WorkDir: dir, TrialsAllowed: 1}
+	tests, err := c.collectTests()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tests) != 2 || tests[0].name != "TestSync" || tests[1].name != "TestFetch" || tests[1].trialsAllowed != 7 {
+		t.Errorf("got: %v", tests)
+	}
+}
@@ -0,0 +1,229 @@
+package schroedinger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// how often the live view is redrawn
+var tuiInterval = 250 * time.Millisecond
+
+// tuiRow is a test as the live view shows it
+type tuiRow struct {
+	test      *test
+	status    string
+	trials    string
+	elapsed   time.Duration
+	rerun     string
+	startedAt time.Time
+}
+
+// tui redraws a table of the tests of a run in place, see Config.TUI
+type tui struct {
+	w     io.Writer
+	p     *progress
+	tests []*test
+	start time.Time
+	// lines of the last frame, to move back up over
+	lines int
+}
+
+// startTUI draws the live view of the tests on w until the returned func is
+// called. Meanwhile the log is held back, and written out once it's over.
+func startTUI(w io.Writer, p *progress, tests []*test, start time.Time) func() {
+	ui := &tui{w: w, p: p, tests: tests, start: start}
+	held := &heldLogger{}
+	logOut := p.log.swap(held)
+
+	ticker := time.NewTicker(tuiInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			ui.draw(time.Now())
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		ui.draw(time.Now())
+		p.log.swap(logOut)
+		held.mu.Lock()
+		defer held.mu.Unlock()
+		for _, m := range held.msgs {
+			logOut.Printf("%s", m)
+		}
+	}
+}
+
+// heldLogger keeps what is logged while the live view is shown
+type heldLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (h *heldLogger) Printf(format string, v ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, fmt.Sprintf(format, v...))
+}
+
+// draw replaces the last frame with the current one
+func (ui *tui) draw(now time.Time) {
+	lines := ui.frame(now, tuiHeight())
+	var b bytes.Buffer
+	if ui.lines > 0 {
+		// to the start of the last frame, and clear it
+		fmt.Fprintf(&b, "\x1b[%dF\x1b[J", ui.lines)
+	}
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+	ui.w.Write(b.Bytes())
+	ui.lines = len(lines)
+}
+
+// frame returns the lines of the view at now, no more than height: a line
+// of counts, and then the tests, those running or retrying first, then
+// those which failed or were flaky, the rest of those done and those
+// queued last, as many as fit
+func (ui *tui) frame(now time.Time, height int) []string {
+	rows := ui.rows(now)
+	p := ui.p
+	p.mu.Lock()
+	header := fmt.Sprintf("schroedinger %v  running: %d, queued: %d, done: %d  pass: %d, flaky: %d, fail: %d, skip: %d",
+		now.Sub(ui.start).Round(time.Second), len(p.running), p.queued, p.done,
+		p.counts[OutcomePass], p.counts[OutcomeFlaky], p.counts[OutcomeFail], p.counts[OutcomeSkip])
+	p.mu.Unlock()
+
+	lines := []string{header, fmt.Sprintf("%-9s %-7s %8s  %s", "STATUS", "TRIALS", "ELAPSED", "TEST")}
+	room := height - len(lines)
+	if room < 1 {
+		room = 1
+	}
+	more := 0
+	if len(rows) > room {
+		more = len(rows) - room + 1
+		rows = rows[:room-1]
+	}
+	for _, r := range rows {
+		name := strings.TrimSpace(r.test.String())
+		if r.rerun != "" {
+			name += " > " + r.rerun
+		}
+		elapsed := ""
+		if r.elapsed > 0 {
+			elapsed = r.elapsed.Round(100 * time.Millisecond).String()
+		}
+		lines = append(lines, fmt.Sprintf("%s%-9s%s %-7s %8s  %s", tuiColor(r.status), r.status, ansiReset, r.trials, elapsed, name))
+	}
+	if more > 0 {
+		lines = append(lines, fmt.Sprintf("%s... and %d more%s", ansiGray, more, ansiReset))
+	}
+	return lines
+}
+
+// rows returns the rows of the tests, in the order of frame
+func (ui *tui) rows(now time.Time) []tuiRow {
+	p := ui.p
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var rows []tuiRow
+	for _, t := range ui.tests {
+		key := t.pkg + " " + t.name
+		row := tuiRow{test: t, status: "queued"}
+		if r, ok := p.results[key]; ok {
+			row.status = tuiStatus(r.Outcome)
+			row.trials = strconv.Itoa(r.Trials)
+			row.elapsed = r.Duration
+		} else if since, ok := p.running[key]; ok {
+			cur := p.trials[key]
+			if cur.trial == 0 {
+				// not yet noted
+				cur.trial = 1
+			}
+			row.status = "running"
+			if cur.trial > 1 || cur.rerun != "" {
+				row.status = "retrying"
+			}
+			row.trials = fmt.Sprintf("%d/%d", cur.trial, t.trialsAllowed)
+			row.rerun = cur.rerun
+			row.elapsed = now.Sub(since)
+			row.startedAt = since
+		}
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		ri, rj := tuiRank(rows[i].status), tuiRank(rows[j].status)
+		if ri != rj {
+			return ri < rj
+		}
+		return rows[i].startedAt.Before(rows[j].startedAt)
+	})
+	return rows
+}
+
+func tuiStatus(o Outcome) string {
+	switch o {
+	case OutcomePass:
+		return "passed"
+	case OutcomeFail:
+		return "failed"
+	case OutcomeSkip:
+		return "skipped"
+	}
+	return string(o)
+}
+
+// tuiRank orders statuses in the view
+func tuiRank(status string) int {
+	switch status {
+	case "running", "retrying":
+		return 0
+	case "failed":
+		return 1
+	case "flaky":
+		return 2
+	case "queued":
+		return 4
+	}
+	return 3
+}
+
+func tuiColor(status string) string {
+	switch status {
+	case "passed":
+		return ansiGreen
+	case "flaky", "retrying":
+		return ansiYellow
+	case "failed":
+		return ansiRed
+	case "running":
+		return ""
+	}
+	return ansiGray
+}
+
+// tuiHeight is the height of the terminal, from LINES, less a line to keep
+// the view from scrolling
+func tuiHeight() int {
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 2 {
+		return n - 1
+	}
+	return 23
+}
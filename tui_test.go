@@ -0,0 +1,54 @@
+package schroedinger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTUIFrame(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sync := &test{pkg: "./eth", name: "TestSync", trialsAllowed: 3}
+	dial := &test{pkg: "./p2p", name: "TestDial", trialsAllowed: 3}
+	les := &test{pkg: "./les", trialsAllowed: 3}
+	core := &test{pkg: "./core", trialsAllowed: 3}
+	tests := []*test{core, les, sync, dial}
+	p := newProgress(len(tests), nil)
+	for _, tt := range tests {
+		tt.progress, tt.progressKey = p, tt.pkg+" "+tt.name
+	}
+	p.started(dial, start)
+	p.finished(&TestResult{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFail, Trials: 3, Duration: 1500 * time.Millisecond})
+	p.started(sync, start.Add(time.Second))
+	sync.trials = 1
+	p.trialStarted(sync)
+	p.started(les, start.Add(2*time.Second))
+
+	ui := &tui{p: p, tests: tests, start: start}
+	now := start.Add(5 * time.Second)
+	got := strings.Join(ui.frame(now, 20), "\n")
+	want := strings.Join([]string{
+		"schroedinger 5s  running: 2, queued: 1, done: 1  pass: 0, flaky: 0, fail: 1, skip: 0",
+		"STATUS    TRIALS   ELAPSED  TEST",
+		ansiYellow + "retrying " + ansiReset + " 2/3           4s  ./eth TestSync",
+		"running  " + ansiReset + " 1/3           3s  ./les",
+		ansiRed + "failed   " + ansiReset + " 3           1.5s  ./p2p TestDial",
+		ansiGray + "queued   " + ansiReset + "                   ./core",
+	}, "\n")
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if lines := ui.frame(now, 4); len(lines) != 4 || lines[3] != ansiGray+"... and 3 more"+ansiReset {
+		t.Errorf("got: %q", lines)
+	}
+
+	var b bytes.Buffer
+	ui.w = &b
+	ui.draw(now)
+	ui.draw(now)
+	if !strings.Contains(b.String(), "\x1b[6F\x1b[J") {
+		t.Errorf("got no redraw in place: %q", b.String())
+	}
+}
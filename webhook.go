@@ -0,0 +1,135 @@
+package schroedinger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook formats.
+const (
+	// {"text": ..., "pass": N, ..., "flakyTests": [...], "failedTests": [...]}
+	WebhookJSON = "json"
+	// Slack incoming webhook, {"text": ...}
+	WebhookSlack = "slack"
+)
+
+// When a Webhook is notified.
+const (
+	// after every run
+	WebhookAlways = "always"
+	// after runs with flaky or failed tests, or which failed otherwise
+	WebhookFlaky = "flaky"
+	// after runs with failed tests, or which failed otherwise
+	WebhookFail = "fail"
+)
+
+const defaultWebhookTemplate = `schroedinger {{join .TestsFiles ", "}}: {{.Pass}} passed, {{.Flaky}} flaky, {{.Fail}} failed, {{.Skip}} skipped ({{.Duration}})
+{{- if .FlakyTests}}
+flaky: {{join .FlakyTests ", "}}{{end}}
+{{- if .FailedTests}}
+failed: {{join .FailedTests ", "}}{{end}}`
+
+// Webhook is POSTed a summary of the run when it finishes.
+type Webhook struct {
+	URL string
+	// WebhookJSON (default) or WebhookSlack
+	Format string
+	// text/template for the message text, executed with a WebhookData
+	Template string
+	// WebhookAlways (default), WebhookFlaky or WebhookFail
+	When string
+}
+
+// WebhookData is the data a Webhook's Template is executed with.
+type WebhookData struct {
+	TestsFiles  []string `json:"testsFiles"`
+	Pass        int      `json:"pass"`
+	Flaky       int      `json:"flaky"`
+	Fail        int      `json:"fail"`
+	Skip        int      `json:"skip"`
+	Duration    string   `json:"duration"`
+	FlakyTests  []string `json:"flakyTests"`
+	FailedTests []string `json:"failedTests"`
+	Error       string   `json:"error,omitempty"`
+	Text        string   `json:"text"`
+}
+
+func newWebhookData(r *Report) *WebhookData {
+	counts := r.Counts()
+	return &WebhookData{
+		TestsFiles:  r.TestsFiles,
+		Pass:        counts[OutcomePass] + counts[OutcomeResumed] + counts[OutcomeStable],
+		Flaky:       counts[OutcomeFlaky],
+		Fail:        counts[OutcomeFail],
+		Skip:        counts[OutcomeSkip],
+		Duration:    r.Duration.Round(time.Millisecond).String(),
+		FlakyTests:  r.Names(OutcomeFlaky),
+		FailedTests: r.Names(OutcomeFail),
+		Error:       r.Error,
+	}
+}
+
+func (w *Webhook) payload(r *Report) ([]byte, error) {
+	tmpl := w.Template
+	if tmpl == "" {
+		tmpl = defaultWebhookTemplate
+	}
+	t, err := template.New("webhook").Funcs(template.FuncMap{"join": strings.Join}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	data := newWebhookData(r)
+	var text bytes.Buffer
+	if err := t.Execute(&text, data); err != nil {
+		return nil, err
+	}
+	data.Text = text.String()
+
+	switch w.Format {
+	case "", WebhookJSON:
+		return json.Marshal(data)
+	case WebhookSlack:
+		return json.Marshal(map[string]string{"text": data.Text})
+	}
+	return nil, fmt.Errorf("unknown webhook format: %s", w.Format)
+}
+
+// wants reports whether w is to be notified of the run r, by w.When
+func (w *Webhook) wants(r *Report) (bool, error) {
+	counts := r.Counts()
+	failed := counts[OutcomeFail] > 0 || r.Error != ""
+	switch w.When {
+	case "", WebhookAlways:
+		return true, nil
+	case WebhookFlaky:
+		return failed || counts[OutcomeFlaky] > 0, nil
+	case WebhookFail:
+		return failed, nil
+	}
+	return false, fmt.Errorf("unknown webhook condition: %s", w.When)
+}
+
+func (w *Webhook) notify(r *Report) error {
+	if ok, err := w.wants(r); !ok {
+		return err
+	}
+	body, err := w.payload(r)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", w.URL, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package schroedinger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	report := &Report{
+		TestsFiles: []string{"tests.txt"},
+		Tests: []*TestResult{
+			{Package: "./eth", Name: "TestSync", Outcome: OutcomeFlaky},
+			{Package: "./p2p", Name: "TestDial", Outcome: OutcomeFail},
+			{Package: "./core", Outcome: OutcomePass},
+		},
+	}
+
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(b, &got)
+	}))
+	defer srv.Close()
+
+	w := &Webhook{URL: srv.URL, Format: WebhookSlack}
+	if err := w.notify(report); err != nil {
+		t.Fatal(err)
+	}
+	want := "schroedinger tests.txt: 1 passed, 1 flaky, 1 failed, 0 skipped (0s)\nflaky: ./eth TestSync\nfailed: ./p2p TestDial"
+	if got["text"] != want || len(got) != 1 {
+		t.Errorf("got: %v, want text: %q", got, want)
+	}
+
+	w = &Webhook{URL: srv.URL, Template: "{{.Fail}} failed"}
+	if err := w.notify(report); err != nil {
+		t.Fatal(err)
+	}
+	if got["text"] != "1 failed" || got["fail"] != float64(1) {
+		t.Errorf("got: %v", got)
+	}
+}
+
+func TestWebhookWhen(t *testing.T) {
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { posts++ }))
+	defer srv.Close()
+
+	pass := &Report{Tests: []*TestResult{{Package: "./core", Outcome: OutcomePass}}}
+	flaky := &Report{Tests: []*TestResult{{Package: "./eth", Outcome: OutcomeFlaky}}}
+	failed := &Report{Error: "run: context deadline exceeded"}
+	cases := []struct {
+		when  string
+		r     *Report
+		posts int
+	}{
+		{"", pass, 1},
+		{WebhookFlaky, pass, 0},
+		{WebhookFlaky, flaky, 1},
+		{WebhookFail, flaky, 0},
+		{WebhookFail, failed, 1},
+	}
+	for _, c := range cases {
+		posts = 0
+		w := &Webhook{URL: srv.URL, When: c.when}
+		if err := w.notify(c.r); err != nil {
+			t.Fatal(err)
+		}
+		if posts != c.posts {
+			t.Errorf("%q: got %d posts, want %d", c.when, posts, c.posts)
+		}
+	}
+	if err := (&Webhook{URL: srv.URL, When: "sometimes"}).notify(pass); err == nil {
+		t.Error("got no error for a bad condition")
+	}
+}